@@ -1,13 +1,46 @@
 package main
 
 import (
+	"context"
 	"hamsterbot/internal/pkg/app"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout - сколько ждать обработчиков и задач при остановке
+const shutdownTimeout = 30 * time.Second
+
 func main() {
-	_, err := app.New()
+	// go run cmd/main/main.go migrate [up|down [n]|status]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := app.Migrate(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	a, err := app.New()
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err = a.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	// повторный сигнал во время остановки завершает процесс сразу
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err = a.Shutdown(shutdownCtx); err != nil {
+		log.Fatal(err)
+	}
 }
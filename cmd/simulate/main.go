@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/internal/app/services/plays"
+	"hamsterbot/pkg/fair"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+const playerID int64 = 2
+
+// memUser - реализация пользователей в памяти: только балансы одного чата, без БД и кэша
+type memUser struct {
+	balances map[int64]int64
+}
+
+func (u *memUser) GetUserByUsername(chatID int64, username string) (models.User, error) {
+	return models.User{}, errors.New("не поддерживается в симуляции")
+}
+
+func (u *memUser) GetUserBalance(chatID, id int64) (int64, error) {
+	balance, ok := u.balances[id]
+	if !ok {
+		return 0, errors.New("пользователь не зарегистрирован")
+	}
+	return balance, nil
+}
+
+func (u *memUser) Transfer(t models.Transaction) (int64, int64, error) {
+	if t.From != constants.SystemID {
+		if u.balances[t.From] < t.Amount {
+			return u.balances[t.From], 0, errors.New(constants.ErrLackBalance)
+		}
+		u.balances[t.From] -= t.Amount
+	}
+	if t.To != constants.SystemID {
+		u.balances[t.To] += t.Amount
+	}
+	return u.balances[t.From], u.balances[t.To], nil
+}
+
+// TransferWith в памяти нечего откатывать: fn вызывается без транзакции, и её ошибка возвращает перевод
+// и балансы до него
+func (u *memUser) TransferWith(t models.Transaction, fn func(tx *sqlx.Tx) error) (int64, int64, error) {
+	fromBalance, toBalance, err := u.Transfer(t)
+	if err != nil || fn == nil {
+		return fromBalance, toBalance, err
+	}
+	if err = fn(nil); err != nil {
+		toBalance, fromBalance, _ = u.Transfer(models.Transaction{From: t.To, To: t.From, Amount: t.Amount})
+		return fromBalance, toBalance, err
+	}
+	return fromBalance, toBalance, nil
+}
+
+// TransferBatch проводит операции по порядку и при ошибке возвращает уже проведённые в обратном порядке
+func (u *memUser) TransferBatch(ts []models.Transaction, fn func(tx *sqlx.Tx) error) (map[int64]int64, error) {
+	before := make(map[int64]int64, len(u.balances))
+	for id, balance := range u.balances {
+		before[id] = balance
+	}
+
+	var err error
+	for _, t := range ts {
+		if _, _, err = u.Transfer(t); err != nil {
+			break
+		}
+	}
+	if err == nil && fn != nil {
+		err = fn(nil)
+	}
+	if err != nil {
+		u.balances = before
+		return before, err
+	}
+	return u.balances, nil
+}
+
+func (u *memUser) GetUserMute(chatID, id int64, kind string) (models.Mute, error) {
+	return models.Mute{}, nil
+}
+
+// memSeed выдаёт генераторы с последовательными nonce и не хранит раунды
+type memSeed struct {
+	serverSeed string
+	nonce      int64
+	rounds     int64
+}
+
+func (s *memSeed) Next(userID int64) (*fair.RNG, models.Round, error) {
+	s.nonce++
+	return fair.New(s.serverSeed, "simulate", s.nonce), models.Round{UserID: userID, Nonce: s.nonce}, nil
+}
+
+func (s *memSeed) ReserveRound() (int64, error) {
+	s.rounds++
+	return s.rounds, nil
+}
+
+func (s *memSeed) SaveRound(tx *sqlx.Tx, round models.Round) error {
+	return nil
+}
+
+func (s *memSeed) GetRound(userID, roundID int64) (models.Round, models.Seed, error) {
+	return models.Round{}, models.Seed{}, errors.New("не поддерживается в симуляции")
+}
+
+type scenario struct {
+	game          games.Game
+	choice        int64
+	casinoBalance int64
+	bet           int64
+}
+
+type stats struct {
+	scenario
+	rounds      int64
+	skipped     int64 // раунды, которые казино не смогло оплатить
+	wagered     int64
+	paid        int64
+	hits        int64
+	sumSquares  float64
+	finalCasino int64
+}
+
+func (st stats) rtp() float64 {
+	if st.wagered == 0 {
+		return 0
+	}
+	return float64(st.paid) / float64(st.wagered)
+}
+
+// variance - дисперсия выплаты в единицах ставки
+func (st stats) variance() float64 {
+	played := st.rounds - st.skipped
+	if played == 0 {
+		return 0
+	}
+	mean := st.rtp()
+	return st.sumSquares/float64(played) - mean*mean
+}
+
+func (st stats) hitFrequency() float64 {
+	played := st.rounds - st.skipped
+	if played == 0 {
+		return 0
+	}
+	return float64(st.hits) / float64(played)
+}
+
+func run(sc scenario, rounds int64, serverSeed string) stats {
+	user := &memUser{balances: map[int64]int64{
+		constants.CasinoID: sc.casinoBalance,
+		playerID:           math.MaxInt64 / 4,
+	}}
+	service := plays.New(user, nil, &memSeed{serverSeed: serverSeed}, nil, nil)
+
+	st := stats{scenario: sc, rounds: rounds}
+	bet := games.Bet{Amount: sc.bet, Choice: sc.choice}
+	for i := int64(0); i < rounds; i++ {
+		result, err := service.Play(sc.game, playerID, 0, bet)
+		if err != nil {
+			st.skipped++
+			continue
+		}
+
+		st.wagered += sc.bet
+		st.paid += result.Outcome.Payout
+		if result.Outcome.Payout > 0 {
+			st.hits++
+		}
+		r := float64(result.Outcome.Payout) / float64(sc.bet)
+		st.sumSquares += r * r
+	}
+	st.finalCasino = user.balances[constants.CasinoID]
+
+	return st
+}
+
+func parseInts(s string) ([]int64, error) {
+	var values []int64
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверное число %q: %w", part, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func main() {
+	rounds := flag.Int64("rounds", 1000000, "количество раундов в каждом сценарии")
+	gameNames := flag.String("games", "", "игры через запятую (по умолчанию все)")
+	casino := flag.String("casino", "25000,50000,100000,1000000", "начальные балансы казино через запятую")
+	bets := flag.String("bets", "10,100,1000", "размеры ставок через запятую")
+	choices := flag.String("choices", "rln=17,rlc=1,dice=7,rsp=1", "выбор игрока для игр с выбором: игра=значение через запятую")
+	paytable := flag.String("paytable", "config/paytable.json", "путь к таблице выплат")
+	format := flag.String("format", "table", "формат вывода: table или csv")
+	serverSeed := flag.String("seed", "", "серверный сид (по умолчанию случайный)")
+	flag.Parse()
+
+	pt, err := games.LoadPaytable(*paytable)
+	if err != nil {
+		log.Fatalf("Ошибка при загрузке таблицы выплат: %v", err)
+	}
+	games.SetPaytable(pt)
+
+	if *serverSeed == "" {
+		*serverSeed, err = fair.NewSeed(32)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	casinoBalances, err := parseInts(*casino)
+	if err != nil {
+		log.Fatal(err)
+	}
+	betSizes, err := parseInts(*bets)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	choiceByGame := map[string]int64{}
+	for _, part := range strings.Split(*choices, ",") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			log.Fatalf("неверный формат выбора %q, ожидается игра=значение", part)
+		}
+		choiceByGame[name], err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatalf("неверный выбор для игры %s: %v", name, err)
+		}
+	}
+
+	selected := games.All()
+	if *gameNames != "" {
+		selected = nil
+		for _, name := range strings.Split(*gameNames, ",") {
+			g := games.Get(name)
+			if g == nil {
+				log.Fatalf("неизвестная игра %s", name)
+			}
+			selected = append(selected, g)
+		}
+	}
+
+	var scenarios []scenario
+	for _, g := range selected {
+		for _, balance := range casinoBalances {
+			for _, bet := range betSizes {
+				scenarios = append(scenarios, scenario{game: g, choice: choiceByGame[g.Name()], casinoBalance: balance, bet: bet})
+			}
+		}
+	}
+
+	// сценарии независимы, поэтому считаются параллельно
+	results := make([]stats, len(scenarios))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, sc := range scenarios {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, sc scenario) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = run(sc, *rounds, *serverSeed)
+		}(i, sc)
+	}
+	wg.Wait()
+
+	header := []string{"game", "choice", "casino", "bet", "rounds", "skipped", "rtp", "variance", "hit_freq", "casino_final", "casino_drift"}
+	rows := make([][]string, 0, len(results))
+	for _, st := range results {
+		rows = append(rows, []string{
+			st.game.Name(),
+			strconv.FormatInt(st.choice, 10),
+			strconv.FormatInt(st.casinoBalance, 10),
+			strconv.FormatInt(st.bet, 10),
+			strconv.FormatInt(st.rounds, 10),
+			strconv.FormatInt(st.skipped, 10),
+			fmt.Sprintf("%.4f", st.rtp()),
+			fmt.Sprintf("%.4f", st.variance()),
+			fmt.Sprintf("%.4f", st.hitFrequency()),
+			strconv.FormatInt(st.finalCasino, 10),
+			strconv.FormatInt(st.finalCasino-st.casinoBalance, 10),
+		})
+	}
+
+	switch *format {
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write(header)
+		_ = w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			log.Fatal(err)
+		}
+	case "table":
+		fmt.Print(pt.Report() + "\n")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, strings.Join(header, "\t")+"\t")
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t")+"\t")
+		}
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("неизвестный формат %s", *format)
+	}
+}
@@ -4,13 +4,23 @@ import (
 	"github.com/caarlos0/env"
 	"github.com/joho/godotenv"
 	"log"
+	"time"
 )
 
 type Configuration struct {
-	TelegramAPI string `env:"TELEGRAM_API,required"`
-	LoggerLevel string `env:"LOGGER_LEVEL" envDefault:"debug"`
-	DB          DB
-	Redis       Redis
+	TelegramAPI   string `env:"TELEGRAM_API,required"`
+	LoggerLevel   string `env:"LOGGER_LEVEL" envDefault:"debug"`
+	PaytablePath  string `env:"PAYTABLE_PATH" envDefault:"config/paytable.json"`
+	DefaultChatID int64  `env:"DEFAULT_CHAT_ID" envDefault:"-1002138316635"`
+	OwnerID       int64  `env:"OWNER_ID" envDefault:"1230045591"`
+	// ключ подписи inline-кнопок, по умолчанию используется токен бота
+	CallbackSecret string `env:"CALLBACK_SECRET"`
+	// адрес HTTP-сервера с /metrics, на нём же принимается вебхук
+	HTTPListen string `env:"HTTP_LISTEN" envDefault:":4000"`
+	DB         DB
+	Redis      Redis
+	Schedule   Schedule
+	Webhook    Webhook
 }
 
 type DB struct {
@@ -26,6 +36,38 @@ type Redis struct {
 	RedisUsername string `env:"REDIS_USERNAME,required"`
 	RedisPassword string `env:"REDIS_PASSWORD,required"`
 	RedisDBId     int    `env:"REDIS_DB_ID,required"`
+	// время жизни пользователей в Redis и их копий в памяти реплики, отрицательный RedisLocalTTL отключает копии
+	RedisCacheTTL time.Duration `env:"REDIS_CACHE_TTL" envDefault:"24h"`
+	RedisLocalTTL time.Duration `env:"REDIS_LOCAL_TTL" envDefault:"5s"`
+	// очередь отложенной записи в базу
+	QueueBatchSize  int64         `env:"QUEUE_BATCH_SIZE" envDefault:"100"`
+	QueueInterval   time.Duration `env:"QUEUE_FLUSH_INTERVAL" envDefault:"1s"`
+	QueueMaxRetries int64         `env:"QUEUE_MAX_RETRIES" envDefault:"5"`
+}
+
+// Schedule - расписания фоновых задач в формате cron (см. scheduler.Parse)
+type Schedule struct {
+	Income   string `env:"SCHEDULE_INCOME" envDefault:"@hourly"`
+	Interest string `env:"SCHEDULE_INTEREST" envDefault:"@hourly"`
+	Tops     string `env:"SCHEDULE_TOPS" envDefault:"0 4 * * *"`
+	Mutes    string `env:"SCHEDULE_MUTES" envDefault:"*/10 * * * *"`
+	// часовой пояс cron-выражений в формате базы IANA
+	TZ string `env:"SCHEDULE_TZ" envDefault:"Europe/Moscow"`
+}
+
+// Webhook - получение обновлений вебхуком вместо long polling. Обновления принимаются HTTP-сервером
+// метрик по пути из PublicURL
+type Webhook struct {
+	Enabled bool `env:"WEBHOOK_ENABLED" envDefault:"false"`
+	// адрес, на который Telegram отправляет обновления, например https://bot.example.com/telegram
+	PublicURL string `env:"WEBHOOK_PUBLIC_URL"`
+	// значение заголовка X-Telegram-Bot-Api-Secret-Token, по умолчанию выводится из токена бота
+	Secret string `env:"WEBHOOK_SECRET"`
+	// сертификат и ключ, с которыми HTTP-сервер работает по TLS без обратного прокси.
+	// Самоподписанный сертификат (WEBHOOK_SELF_SIGNED) дополнительно загружается в Telegram
+	Cert       string `env:"WEBHOOK_CERT"`
+	Key        string `env:"WEBHOOK_KEY"`
+	SelfSigned bool   `env:"WEBHOOK_SELF_SIGNED" envDefault:"false"`
 }
 
 func NewConfig(files ...string) (*Configuration, error) {
@@ -44,6 +86,17 @@ func NewConfig(files ...string) (*Configuration, error) {
 		return nil, err
 	}
 	err = env.Parse(&cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	err = env.Parse(&cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	err = env.Parse(&cfg.Webhook)
+	if err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
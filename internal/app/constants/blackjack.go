@@ -0,0 +1,9 @@
+package constants
+
+import "time"
+
+const (
+	BlackjackTimeout   = time.Minute // через сколько без хода раздача завершается автоматическим stand
+	BlackjackDecks     = 6           // колод в башмаке чата
+	BlackjackReshuffle = 78          // при скольких оставшихся картах башмак перемешивается заново
+)
@@ -0,0 +1,23 @@
+package constants
+
+// Состояния вклада
+const (
+	DepositOpen   = "open"
+	DepositClosed = "closed"
+)
+
+// Ставки и штрафы вкладов - в сотых долях процента в день
+const (
+	DepositDemandRate = 100  // вклад до востребования, 1% в день
+	DepositPenalty    = 1000 // штраф за снятие со срочного вклада до окончания срока, 10% снимаемой суммы
+
+	DepositMinAmount = 100 // минимальная сумма открытия и пополнения вклада
+	DepositMaxOpen   = 5   // сколько вкладов пользователь может держать открытыми в одном чате
+)
+
+// DepositTermRates - ставки срочных вкладов по сроку в днях. Срочный вклад нельзя пополнить,
+// а после окончания срока на него начисляется ставка вклада до востребования
+var DepositTermRates = map[int64]int64{
+	7:  200,
+	30: 300,
+}
@@ -0,0 +1,16 @@
+package constants
+
+import "time"
+
+// Состояния дуэли: вызов ждёт ответа соперника, дуэль разыграна, отклонена или отменена вызвавшим,
+// истекла без ответа
+const (
+	DuelPending  = "pending"
+	DuelFinished = "finished"
+	DuelDeclined = "declined"
+	DuelCanceled = "canceled"
+	DuelExpired  = "expired"
+)
+
+// DuelTimeout - сколько вызов на дуэль ждёт ответа соперника
+const DuelTimeout = 2 * time.Minute
@@ -5,4 +5,6 @@ const (
 	ErrNegativeAmount = "сумма не может быть отрицательной"
 	ErrNegativeRln    = "число должно находиться в диапазоне от 1 до 36"
 	ErrLessAmount     = "сумма не может быть меньше 10 зеток"
+	ErrLoanDefault    = "у вас просроченный кредит, игры недоступны до его погашения (/loan status)"
+	ErrTableClosed    = "стол закрыт, откройте раунд командой /table"
 )
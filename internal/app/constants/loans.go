@@ -0,0 +1,24 @@
+package constants
+
+import "time"
+
+// Состояния кредита: выдан, просрочен (игры заблокированы до погашения), погашен
+const (
+	LoanActive    = "active"
+	LoanDefaulted = "defaulted"
+	LoanRepaid    = "repaid"
+)
+
+const (
+	LoanRate        = 200                // дневная ставка на остаток долга в сотых долях процента, 2% в день
+	LoanTerm        = 7 * 24 * time.Hour // через сколько непогашенный кредит становится просроченным
+	LoanMinAmount   = 100
+	LoanLvlLimit    = 1000 // кредитный лимит за каждый уровень
+	LoanIncomeHours = 24   // плюс доход за столько часов
+	// Залог в процентах от суммы кредита: списывается с баланса заёмщика на счёт EscrowID при выдаче,
+	// возвращается при погашении и уходит казино в счёт долга при просрочке
+	LoanCollateralShare = 25
+	// Доля почасового дохода в процентах, которая уходит на погашение: пока кредит в срок и после просрочки
+	LoanIncomeShare  = 50
+	LoanDefaultShare = 100
+)
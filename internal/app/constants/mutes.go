@@ -0,0 +1,14 @@
+package constants
+
+// Виды мутов: мут от другого пользователя и самомут
+const (
+	MuteKind     = "mute"
+	SelfMuteKind = "selfmute"
+)
+
+// Способы применения мута: ограничение прав в чате через Telegram
+// или удаление сообщений ботом, если у него нет прав администратора
+const (
+	MuteModeRestrict = "restrict"
+	MuteModeDelete   = "delete"
+)
@@ -0,0 +1,32 @@
+package constants
+
+// Роли администрации бота, от старшей к младшей
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// Права, которыми проверяется доступ к административным командам
+const (
+	PermPay      = "pay"      // /payd - выпуск и списание зеток
+	PermSend     = "send"     // /send - сообщения от имени бота
+	PermSteal    = "steal"    // /steal всегда успешен
+	PermPaytable = "paytable" // /paytable reload
+	PermSettings = "settings" // /settings - изменение настроек чата
+	PermRoles    = "roles"    // /admin add|remove - назначение ролей младше своей
+)
+
+// RoleRanks - старшинство ролей: назначать и снимать можно только роли младше своей
+var RoleRanks = map[string]int{
+	RoleOwner:     3,
+	RoleAdmin:     2,
+	RoleModerator: 1,
+}
+
+// RolePermissions - права каждой роли
+var RolePermissions = map[string][]string{
+	RoleOwner:     {PermPay, PermSend, PermSteal, PermPaytable, PermSettings, PermRoles},
+	RoleAdmin:     {PermPay, PermSend, PermPaytable, PermSettings, PermRoles},
+	RoleModerator: {PermSettings},
+}
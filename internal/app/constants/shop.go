@@ -0,0 +1,11 @@
+package constants
+
+// Кривая магазина улучшений (/shop, /upgrade). Переход с уровня lvl на lvl+1 стоит
+// UpgradeBasePrice * UpgradePriceGrowth^(lvl-1) зеток и прибавляет к доходу UpgradeIncomeStep * (lvl+1) зеток в час,
+// так что каждый следующий уровень окупается дольше предыдущего
+const (
+	UpgradeBasePrice   int64   = 2000
+	UpgradePriceGrowth float64 = 1.5
+	UpgradeIncomeStep  int64   = 50
+	MaxLvl             int64   = 50
+)
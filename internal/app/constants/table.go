@@ -0,0 +1,10 @@
+package constants
+
+import "time"
+
+// Длительность приёма ставок на столе рулетки: по умолчанию и допустимые пределы для /table <секунды>
+const (
+	TableDuration    = time.Minute
+	TableMinDuration = 15 * time.Second
+	TableMaxDuration = 5 * time.Minute
+)
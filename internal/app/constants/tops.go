@@ -0,0 +1,14 @@
+package constants
+
+// Показатели, по которым строятся топы чата (/top <показатель>)
+const (
+	TopBalance = "balance"
+	TopLvl     = "lvl"
+	TopIncome  = "income"
+)
+
+// TopMetrics - все показатели топов в порядке вывода
+var TopMetrics = []string{TopBalance, TopLvl, TopIncome}
+
+// TopPageSize - сколько строк топа выводится на одной странице
+const TopPageSize = 10
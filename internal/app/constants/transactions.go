@@ -0,0 +1,30 @@
+package constants
+
+const (
+	SystemID   int64 = 0 // служебный счёт для эмиссии и списания зеток
+	CasinoID   int64 = 1 // счёт казино
+	EscrowID   int64 = 2 // счёт, на котором ставки дуэлей ждут розыгрыша, а залоги кредитов - погашения
+	DepositsID int64 = 3 // счёт, на котором лежат деньги вкладов
+
+	MaxServiceID = DepositsID // счета с id не больше этого - служебные и не участвуют в топах
+)
+
+// Виды операций в журнале transactions
+const (
+	TxPay        = "pay"
+	TxAdmin      = "admin"
+	TxCasino     = "casino"
+	TxIncome     = "income"
+	TxBank       = "bank"
+	TxGame       = "game"
+	TxSteal      = "steal"
+	TxMute       = "mute"
+	TxUnmute     = "unmute"
+	TxSelfMute   = "selfmute"
+	TxSelfUnmute = "selfunmute"
+	TxUpgrade    = "upgrade"
+	TxDuel       = "duel"
+	TxInterest   = "interest"
+	TxLoan       = "loan"
+	TxRefund     = "refund" // возврат непринятой ставки
+)
@@ -0,0 +1,101 @@
+package admins
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+	"strings"
+	"time"
+)
+
+type Admin interface {
+	Add(actorID, targetID int64, role string) error
+	Remove(actorID, targetID int64) error
+	List() ([]models.Admin, error)
+	GetLog(limit int) ([]models.AdminAction, error)
+}
+
+type User interface {
+	GetUserByUsername(chatID int64, username string) (models.User, error)
+}
+
+type Endpoint struct {
+	Admin Admin
+	User  User
+}
+
+func (e *Endpoint) AdminHandler(c telebot.Context) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /admin add <username> <роль>, /admin remove <username>, /admin list или /admin log.")
+	}
+
+	switch {
+	case args[0] == "add" && len(args) == 3: // /admin add <username> <роль>
+		data, err := e.User.GetUserByUsername(c.Chat().ID, args[1])
+		if err != nil {
+			return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+		}
+
+		err = e.Admin.Add(c.Sender().ID, data.ID, args[2])
+		if err != nil {
+			return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+		}
+
+		logger.Infof(fmt.Sprintf("Пользователь @%s (%d) назначил пользователю @%s роль %s", c.Sender().Username, c.Sender().ID, strings.Trim(args[1], "@"), args[2]),
+			c.Chat().ID, c.Chat().Title, zap.Int64("target", data.ID))
+		return c.Send(fmt.Sprintf("✅ Пользователю @%s назначена роль %s", strings.Trim(args[1], "@"), args[2]))
+	case args[0] == "remove" && len(args) == 2: // /admin remove <username>
+		data, err := e.User.GetUserByUsername(c.Chat().ID, args[1])
+		if err != nil {
+			return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+		}
+
+		err = e.Admin.Remove(c.Sender().ID, data.ID)
+		if err != nil {
+			return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+		}
+
+		logger.Infof(fmt.Sprintf("Пользователь @%s (%d) снял роль с пользователя @%s", c.Sender().Username, c.Sender().ID, strings.Trim(args[1], "@")),
+			c.Chat().ID, c.Chat().Title, zap.Int64("target", data.ID))
+		return c.Send(fmt.Sprintf("✅ С пользователя @%s снята роль", strings.Trim(args[1], "@")))
+	case args[0] == "list" && len(args) == 1: // /admin list
+		admins, err := e.Admin.List()
+		if err != nil {
+			return c.Send("Ошибка: " + err.Error())
+		}
+
+		resultMsg := "🛡 Администрация бота:\n\n"
+		for _, admin := range admins {
+			resultMsg += fmt.Sprintf("👉 %s - %s (назначил %d)\n", displayName(admin.Username, admin.UserID), admin.Role, admin.GrantedBy)
+		}
+		return c.Send(resultMsg)
+	case args[0] == "log" && len(args) == 1: // /admin log
+		actions, err := e.Admin.GetLog(20)
+		if err != nil {
+			return c.Send("Ошибка: " + err.Error())
+		}
+		if len(actions) == 0 {
+			return c.Send("Журнал ролей пуст.")
+		}
+
+		location := time.FixedZone("UTC+3", 3*60*60)
+		resultMsg := "📜 Журнал ролей:\n\n"
+		for _, action := range actions {
+			resultMsg += fmt.Sprintf("#%d %s %d %s %d %s\n", action.ID, action.CreatedAt.In(location).Format("02.01 15:04"),
+				action.ActorID, action.Action, action.TargetID, action.Role)
+		}
+		return c.Send(resultMsg)
+	default:
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /admin add <username> <роль>, /admin remove <username>, /admin list или /admin log.")
+	}
+}
+
+func displayName(username string, id int64) string {
+	if username == "" {
+		return fmt.Sprint(id)
+	}
+	return "@" + username
+}
@@ -0,0 +1,68 @@
+package chats
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+	"strconv"
+)
+
+type Chat interface {
+	GetChat(chatID int64, title string) (models.Chat, error)
+	SetSetting(chatID int64, name string, value int64) (models.Chat, error)
+}
+
+type Admin interface {
+	HasPermission(userID int64, permission string) bool
+}
+
+type Endpoint struct {
+	Chat  Chat
+	Admin Admin
+}
+
+func (e *Endpoint) SettingsHandler(c telebot.Context) error {
+	args := c.Args()
+
+	switch len(args) {
+	case 0: // /settings
+		chat, err := e.Chat.GetChat(c.Chat().ID, c.Chat().Title)
+		if err != nil {
+			return c.Send("Ошибка: " + err.Error())
+		}
+		return c.Send(settingsText(chat))
+	case 2: // /settings <настройка> <значение>
+		if !e.Admin.HasPermission(c.Sender().ID, constants.PermSettings) {
+			return nil
+		}
+
+		value, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return c.Send("Неверный формат значения. Пожалуйста, используйте: /settings start_balance 1500")
+		}
+
+		chat, err := e.Chat.SetSetting(c.Chat().ID, args[0], value)
+		if err != nil {
+			return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+		}
+
+		logger.Infof(fmt.Sprintf("Пользователь @%s (%d) изменил настройку чата", c.Sender().Username, c.Sender().ID),
+			c.Chat().ID, c.Chat().Title, zap.String("setting", args[0]), zap.Int64("value", value))
+		return c.Send("✅ Настройка изменена\n\n" + settingsText(chat))
+	default:
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /settings или /settings <настройка> <значение>.")
+	}
+}
+
+func settingsText(chat models.Chat) string {
+	income := "выключен"
+	if chat.IncomeEnabled {
+		income = "включен"
+	}
+
+	return fmt.Sprintf("⚙️ Настройки экономики чата:\n\n👉 Стартовый баланс (start_balance): %d зеток\n👉 Стартовый доход (start_income): %d зеток в час\n👉 Почасовой доход (income 0/1): %s\n👉 Стартовый баланс казино: %d зеток",
+		chat.StartBalance, chat.StartIncome, income, chat.CasinoBalance)
+}
@@ -4,13 +4,14 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
 	"hamsterbot/pkg/logger"
 	"strings"
 )
 
 type Mute interface {
-	Mute(from string, to string, durationStr string) (int64, int, error)
-	Unmute(from string, to string) (int64, int, error)
+	Mute(from string, to string, durationStr string, chatID int64) (int64, int, string, error)
+	Unmute(from string, to string, chatID int64) (int64, int, error)
 }
 
 type Endpoint struct {
@@ -36,7 +37,7 @@ func (e *Endpoint) MuteHandler(c telebot.Context) error {
 	//	return c.Send("Ошибка: длина мута не может быть меньше 1s.")
 	//}
 
-	balance, amount, err := e.Mute.Mute(username, c.Sender().Username, duration)
+	balance, amount, mode, err := e.Mute.Mute(username, c.Sender().Username, duration, c.Chat().ID)
 	if err != nil {
 		if err.Error() == "недостаточно средств" {
 			return c.Send(fmt.Sprintf("Ошибка: %s. Не хватает %d зеток, ваш текущий баланс: %d зеток.", err.Error(), int64(amount)-balance, balance))
@@ -45,8 +46,8 @@ func (e *Endpoint) MuteHandler(c telebot.Context) error {
 	}
 
 	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) замутил пользователя @%s", c.Sender().Username, c.Sender().ID, strings.Trim(username, "@")),
-		c.Chat().ID, c.Chat().Title, zap.String("duration", duration), zap.Int("amount", amount), zap.Int64("balance", balance))
-	return c.Send(fmt.Sprintf("Пользователь @%s замучен на %s за %d зеток. Ваш текущий баланс: %d зеток.", strings.Trim(username, "@"), duration, amount, balance))
+		c.Chat().ID, c.Chat().Title, zap.String("duration", duration), zap.String("mode", mode), zap.Int("amount", amount), zap.Int64("balance", balance))
+	return c.Send(fmt.Sprintf("Пользователь @%s замучен на %s за %d зеток. Ваш текущий баланс: %d зеток.\n\n%s", strings.Trim(username, "@"), duration, amount, balance, MuteModeText(mode)))
 }
 
 func (e *Endpoint) UnmuteHandler(c telebot.Context) error {
@@ -67,7 +68,7 @@ func (e *Endpoint) UnmuteHandler(c telebot.Context) error {
 	}
 
 	logger.Debug("Получение аргументов", zap.String("username", username))
-	balance, amount, err := e.Mute.Unmute(c.Sender().Username, username)
+	balance, amount, err := e.Mute.Unmute(c.Sender().Username, username, c.Chat().ID)
 	if err != nil {
 		if err.Error() == "недостаточно средств" {
 			return c.Send(fmt.Sprintf("Ошибка: %s. Не хватает %d зеток, ваш текущий баланс: %d зеток.", err.Error(), int64(amount)-balance, balance))
@@ -79,3 +80,11 @@ func (e *Endpoint) UnmuteHandler(c telebot.Context) error {
 		c.Chat().ID, c.Chat().Title, zap.Int("amount", amount), zap.Int64("balance", balance))
 	return c.Send(fmt.Sprintf("Пользователь @%s размучен за %d зеток. Ваш текущий баланс: %d зеток.", strings.Trim(username, "@"), amount, balance))
 }
+
+// MuteModeText описывает для пользователя, каким способом применён мут
+func MuteModeText(mode string) string {
+	if mode == constants.MuteModeRestrict {
+		return "🔇 Мут применён ограничением прав в чате."
+	}
+	return "🗑 Мут применяется удалением сообщений: у бота нет прав на ограничение участников или мут слишком короткий."
+}
@@ -0,0 +1,164 @@
+package payments
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const bankUsage = "Вклады: /bank info - ваши вклады, /bank open <сумма> [срок] - открыть вклад, " +
+	"/bank add <вклад> <сумма> - пополнить, /bank withdraw <вклад> [сумма] - снять (без суммы - всё и закрыть вклад)"
+
+func (e *Endpoint) DepositsHandler(c telebot.Context) error {
+	deposits, err := e.Deposit.GetDeposits(c.Chat().ID, c.Sender().ID)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error())
+	}
+	if len(deposits) == 0 {
+		return c.Send("У вас нет открытых вкладов.\n\n" + depositRates() + "\n\n" + bankUsage)
+	}
+
+	var total int64
+	resultMsg := fmt.Sprintf("📌 Вклады @%s:\n\n", c.Sender().Username)
+	for _, deposit := range deposits {
+		total += deposit.Balance
+		resultMsg += "👉 " + depositLine(deposit) + "\n"
+	}
+	resultMsg += fmt.Sprintf("\nВсего во вкладах: %d зеток", total)
+
+	return c.Send(resultMsg)
+}
+
+func (e *Endpoint) OpenDepositHandler(c telebot.Context, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /bank open сумма [срок в днях]")
+	}
+
+	amount, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /bank open 1000")
+	}
+
+	var termDays int64
+	if len(args) == 2 {
+		termDays, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return c.Send("Неверный формат срока. Пожалуйста, используйте правильный формат, например: /bank open 1000 30")
+		}
+	}
+
+	deposit, balance, err := e.Deposit.Open(c.Chat().ID, c.Sender().ID, amount, termDays)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), balance))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) открыл вклад", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title, zap.Int64("deposit", deposit.ID), zap.Int64("amount", amount), zap.Int64("term", termDays))
+	return c.Send(fmt.Sprintf("Вклад открыт:\n\n👉 %s\n\nВаш текущий баланс: %d зеток", depositLine(deposit), balance))
+}
+
+func (e *Endpoint) TopUpDepositHandler(c telebot.Context, args []string) error {
+	if len(args) != 2 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /bank add вклад сумма")
+	}
+
+	depositID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return c.Send("Неверный номер вклада. Номера ваших вкладов - в /bank info")
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /bank add 1 100")
+	}
+
+	deposit, balance, err := e.Deposit.TopUp(c.Chat().ID, c.Sender().ID, depositID, amount)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), balance))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) пополнил вклад", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title, zap.Int64("deposit", deposit.ID), zap.Int64("amount", amount), zap.Int64("balance", balance))
+	return c.Send(fmt.Sprintf("Вклад пополнен на %d зеток:\n\n👉 %s\n\nВаш текущий баланс: %d зеток", amount, depositLine(deposit), balance))
+}
+
+func (e *Endpoint) WithdrawDepositHandler(c telebot.Context, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /bank withdraw вклад [сумма]")
+	}
+
+	depositID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return c.Send("Неверный номер вклада. Номера ваших вкладов - в /bank info")
+	}
+
+	var amount int64
+	if len(args) == 2 {
+		amount, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || amount <= 0 {
+			return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /bank withdraw 1 100")
+		}
+	}
+
+	deposit, received, penalty, balance, err := e.Deposit.Withdraw(c.Chat().ID, c.Sender().ID, depositID, amount)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error() + ".")
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) снял деньги со вклада", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title, zap.Int64("deposit", deposit.ID), zap.Int64("received", received), zap.Int64("penalty", penalty))
+
+	resultMsg := fmt.Sprintf("Со вклада #%d снято %d зеток", deposit.ID, received)
+	if penalty > 0 {
+		resultMsg += fmt.Sprintf(" (штраф за досрочное снятие: %d зеток)", penalty)
+	}
+	if deposit.Status == constants.DepositClosed {
+		resultMsg += ", вклад закрыт"
+	} else {
+		resultMsg += fmt.Sprintf(", на вкладе осталось %d зеток", deposit.Balance)
+	}
+
+	return c.Send(resultMsg + fmt.Sprintf(". Ваш текущий баланс: %d зеток", balance))
+}
+
+func depositLine(deposit models.Deposit) string {
+	line := fmt.Sprintf("#%d: %d зеток, %s%% в день", deposit.ID, deposit.Balance, percent(deposit.Rate))
+	if deposit.MaturesAt == nil {
+		return line + ", до востребования"
+	}
+
+	location := time.FixedZone("UTC+3", 3*60*60)
+	if time.Now().Before(*deposit.MaturesAt) {
+		return line + fmt.Sprintf(", срочный на %d дн. до %s", deposit.TermDays, deposit.MaturesAt.In(location).Format("02.01 15:04"))
+	}
+	return line + fmt.Sprintf(", срок истёк %s, ставка до востребования %s%%",
+		deposit.MaturesAt.In(location).Format("02.01 15:04"), percent(constants.DepositDemandRate))
+}
+
+// depositRates - условия вкладов для /bank
+func depositRates() string {
+	rates := fmt.Sprintf("💰 Вклады с ежедневной капитализацией, проценты платит казино:\n👉 До востребования: %s%% в день\n",
+		percent(constants.DepositDemandRate))
+
+	terms := make([]int64, 0, len(constants.DepositTermRates))
+	for term := range constants.DepositTermRates {
+		terms = append(terms, term)
+	}
+	slices.Sort(terms)
+	for _, term := range terms {
+		rates += fmt.Sprintf("👉 На %d дн.: %s%% в день\n", term, percent(constants.DepositTermRates[term]))
+	}
+
+	return rates + fmt.Sprintf("Срочный вклад нельзя пополнить, за снятие до окончания срока удерживается %s%% снимаемой суммы",
+		percent(constants.DepositPenalty))
+}
+
+// percent переводит сотые доли процента в проценты
+func percent(basis int64) string {
+	return strconv.FormatFloat(float64(basis)/100, 'f', -1, 64)
+}
@@ -0,0 +1,121 @@
+package payments
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+	"strconv"
+	"time"
+)
+
+const loanUsage = "Кредиты: /loan <сумма> - взять кредит, /loan status - ваш кредит и лимит, " +
+	"/loan repay [сумма] - погасить (без суммы - весь долг)"
+
+type Loan interface {
+	LoanLimit(chatID, userID int64) (int64, error)
+	GetLoan(chatID, userID int64) (models.Loan, bool, error)
+	TakeLoan(chatID, userID, amount int64) (models.Loan, int64, error)
+	RepayLoan(chatID, userID, amount int64) (models.Loan, int64, error)
+}
+
+func (e *Endpoint) LoanHandler(c telebot.Context) error {
+	args := c.Args()
+
+	if len(args) == 0 {
+		return c.Send(loanUsage)
+	}
+
+	switch args[0] {
+	case "status": // /loan status
+		return e.LoanStatusHandler(c)
+	case "repay": // /loan repay [сумма]
+		return e.RepayLoanHandler(c, args[1:])
+	}
+
+	// /loan <сумма>
+	if len(args) != 1 {
+		return c.Send("Неверный формат команды. " + loanUsage)
+	}
+	amount, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /loan 1000")
+	}
+
+	loan, balance, err := e.Loan.TakeLoan(c.Chat().ID, c.Sender().ID, amount)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), balance))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) взял кредит", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title, zap.Int64("loan", loan.ID), zap.Int64("amount", amount))
+	return c.Send(fmt.Sprintf("Кредит выдан:\n\n👉 %s\n\n%s\n\nВаш текущий баланс: %d зеток", loanLine(loan), loanTerms(), balance))
+}
+
+func (e *Endpoint) LoanStatusHandler(c telebot.Context) error {
+	limit, err := e.Loan.LoanLimit(c.Chat().ID, c.Sender().ID)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error())
+	}
+
+	loan, ok, err := e.Loan.GetLoan(c.Chat().ID, c.Sender().ID)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error())
+	}
+	if !ok {
+		return c.Send(fmt.Sprintf("У вас нет кредита. Ваш кредитный лимит: %d зеток\n\n%s\n\n%s", limit, loanTerms(), loanUsage))
+	}
+
+	return c.Send(fmt.Sprintf("📌 Кредит @%s:\n\n👉 %s\n\n%s", c.Sender().Username, loanLine(loan), loanTerms()))
+}
+
+func (e *Endpoint) RepayLoanHandler(c telebot.Context, args []string) error {
+	if len(args) > 1 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /loan repay [сумма]")
+	}
+
+	var amount int64
+	if len(args) == 1 {
+		var err error
+		amount, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil || amount <= 0 {
+			return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /loan repay 100")
+		}
+	}
+
+	loan, balance, err := e.Loan.RepayLoan(c.Chat().ID, c.Sender().ID, amount)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), balance))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) погасил часть кредита", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title, zap.Int64("loan", loan.ID), zap.Int64("debt", loan.Debt), zap.Int64("balance", balance))
+
+	if loan.Status == constants.LoanRepaid {
+		return c.Send(fmt.Sprintf("Кредит #%d полностью погашен. Ваш текущий баланс: %d зеток", loan.ID, balance))
+	}
+	return c.Send(fmt.Sprintf("Платёж принят, остаток долга по кредиту #%d: %d зеток. Ваш текущий баланс: %d зеток",
+		loan.ID, loan.Debt, balance))
+}
+
+func loanLine(loan models.Loan) string {
+	location := time.FixedZone("UTC+3", 3*60*60)
+	line := fmt.Sprintf("#%d: взято %d зеток, долг %d зеток, %s%% в день", loan.ID, loan.Principal, loan.Debt, percent(loan.Rate))
+	if loan.Status == constants.LoanDefaulted {
+		return line + fmt.Sprintf(", просрочен с %s - залог %d зеток забран казино, игры недоступны до погашения",
+			loan.DueAt.In(location).Format("02.01 15:04"), loan.Collateral)
+	}
+	return line + fmt.Sprintf(", залог %d зеток, погасить до %s", loan.Collateral, loan.DueAt.In(location).Format("02.01 15:04"))
+}
+
+// loanTerms - условия кредитов для /loan
+func loanTerms() string {
+	return fmt.Sprintf("💳 Кредит выдаёт казино под %s%% в день с ежедневной капитализацией на %d дн. "+
+		"Лимит: %d зеток за уровень плюс доход за %d ч. При выдаче %d%% суммы кредита списывается с баланса в залог "+
+		"и возвращается после погашения. В счёт долга каждый час списывается %d%% дохода, "+
+		"после просрочки - %d%%, залог уходит казино в счёт долга, а игры блокируются до погашения",
+		percent(constants.LoanRate), int(constants.LoanTerm.Hours()/24), constants.LoanLvlLimit, constants.LoanIncomeHours,
+		constants.LoanCollateralShare, constants.LoanIncomeShare, constants.LoanDefaultShare)
+}
@@ -4,25 +4,38 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
 	"hamsterbot/pkg/logger"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Payment interface {
-	Pay(from string, to string, amount int) (int64, error)
-	PayAdm(to string, amount int) (int64, error)
+	Pay(from string, to string, amount int, chatID int64) (int64, error)
+	PayAdm(to string, amount int, chatID int64) (int64, error)
 }
 
 type User interface {
-	GetUserById(id int64) (map[string]interface{}, error)
-	GetUserByUsername(username string) (map[string]interface{}, error)
-	GetBankBalance() (map[string]interface{}, error)
+	GetUserById(chatID, id int64) (models.User, error)
+	GetUserByUsername(chatID int64, username string) (models.User, error)
+	GetBankBalance(chatID int64) (models.BankBalance, error)
+	GetUserTransactions(chatID, id int64, limit, offset int) ([]models.Transaction, error)
+}
+
+type Deposit interface {
+	GetDeposits(chatID, userID int64) ([]models.Deposit, error)
+	Open(chatID, userID, amount, termDays int64) (models.Deposit, int64, error)
+	TopUp(chatID, userID, depositID, amount int64) (models.Deposit, int64, error)
+	Withdraw(chatID, userID, depositID, amount int64) (models.Deposit, int64, int64, int64, error)
 }
 
 type Endpoint struct {
 	Payment Payment
 	User    User
+	Deposit Deposit
+	Loan    Loan
 }
 
 func (e *Endpoint) PayHandler(c telebot.Context) error {
@@ -64,7 +77,7 @@ func (e *Endpoint) PayHandler(c telebot.Context) error {
 		return c.Send("Ошибка: число не может быть отрицательным.")
 	}
 
-	balance, err := e.Payment.Pay(c.Sender().Username, username, amount)
+	balance, err := e.Payment.Pay(c.Sender().Username, username, amount, c.Chat().ID)
 	if err != nil {
 		return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), balance))
 	}
@@ -75,9 +88,6 @@ func (e *Endpoint) PayHandler(c telebot.Context) error {
 }
 
 func (e *Endpoint) PayAdmHandler(c telebot.Context) error {
-	if c.Sender().ID != 1230045591 {
-		return nil
-	}
 	logger.Debug("Вызван обработчик PayAdm")
 	var username string
 	var amount int
@@ -109,7 +119,7 @@ func (e *Endpoint) PayAdmHandler(c telebot.Context) error {
 		return c.Send("Неверный формат команды. Пожалуйста, используйте: /pay username сумма или ответьте командой /pay сумма на сообщение.")
 	}
 
-	balance, err := e.Payment.PayAdm(username, amount)
+	balance, err := e.Payment.PayAdm(username, amount, c.Chat().ID)
 	if err != nil {
 		return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), balance))
 	}
@@ -120,73 +130,85 @@ func (e *Endpoint) PayAdmHandler(c telebot.Context) error {
 func (e *Endpoint) BankHandler(c telebot.Context) error {
 	args := c.Args()
 
-	switch len(args) {
-	case 0:
-		err := e.GetBankData(c)
-		if err != nil {
-			return err
-		}
-	case 1:
-		if args[0] == "info" {
-			bank, err := e.User.GetUserByUsername(fmt.Sprintf("bank_%d_%s", c.Sender().ID, c.Sender().Username))
-			if err != nil {
-				return c.Send("Неизвестная ошибка")
-			}
-
-			return c.Send(fmt.Sprintf("📌 Информация о личном счёте @%s в банке:\n\n👉 Баланс: %d зеток\n", c.Sender().Username, bank["balance"].(int64)) + "👉 Ставка: 3% дневных")
-		}
-	case 2: // /bank pay <сумма>
-		if args[0] == "pay" {
-			amount, err := strconv.Atoi(args[1])
-			if err != nil {
-				return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /bank pay 100")
-			}
-
-			var userBalance, bankBalance int64
-			user, err := e.User.GetUserById(c.Sender().ID)
-			if err != nil {
-				return c.Send("Неизвестная ошибка")
-			}
-			bank, err := e.User.GetUserByUsername(fmt.Sprintf("bank_%d_%s", c.Sender().ID, c.Sender().Username))
-			if err != nil {
-				return c.Send("Неизвестная ошибка")
-			}
-			userBalance = user["balance"].(int64)
-			bankBalance = bank["balance"].(int64)
-
-			if amount > 0 {
-				userBalance, err = e.Payment.Pay(c.Sender().Username, fmt.Sprintf("bank_%d_%s", c.Sender().ID, c.Sender().Username), -amount)
-				if err != nil {
-					return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), userBalance))
-				}
-				bankBalance -= int64(amount)
-			} else if amount < 0 {
-				bankBalance, err = e.Payment.Pay(fmt.Sprintf("bank_%d_%s", c.Sender().ID, c.Sender().Username), c.Sender().Username, amount)
-				if err != nil {
-					return c.Send(fmt.Sprintf("Ошибка: %s. Ваш текущий баланс: %d зеток", err.Error(), userBalance))
-				}
-				userBalance -= int64(amount)
-			} else {
-				return c.Send("Ошибка: число не может быть нулевым.")
-			}
-
-			logger.Infof(fmt.Sprintf("Пользователь @%s (%d) отправил деньги в личный банк", c.Sender().Username, c.Sender().ID),
-				c.Chat().ID, c.Chat().Title, zap.Int("amount", amount), zap.Int64("userBalance", userBalance), zap.Int64("bankBalance", bankBalance))
-			return c.Send(fmt.Sprintf("Перевод на личный счет в банке на сумму %d зеток был успешно обработан. Ваш текущий баланс: %d зеток. Баланс вашего счета в банке: %d зеток", amount, userBalance, bankBalance))
+	if len(args) == 0 { // /bank
+		return e.GetBankData(c)
+	}
 
-		}
+	switch args[0] {
+	case "info", "list": // /bank info
+		return e.DepositsHandler(c)
+	case "open": // /bank open <сумма> [срок]
+		return e.OpenDepositHandler(c, args[1:])
+	case "add": // /bank add <вклад> <сумма>
+		return e.TopUpDepositHandler(c, args[1:])
+	case "withdraw": // /bank withdraw <вклад> [сумма]
+		return e.WithdrawDepositHandler(c, args[1:])
 	default:
-		return c.Send("Неизвестная команда. Для помощи напишите /help")
+		return c.Send("Неизвестная команда. " + bankUsage)
 	}
-
-	return nil
 }
 
 func (e *Endpoint) GetBankData(c telebot.Context) error {
-	data, err := e.User.GetBankBalance()
+	data, err := e.User.GetBankBalance(c.Chat().ID)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error())
+	}
+
+	return c.Send(fmt.Sprintf("📌 Информация о банке:\n\n👉 Общий баланс: %d зеток\nИз них хранятся во вкладах пользователей: %d зеток\n👉 Выпущено в обращение по журналу операций: %d зеток\n\n",
+		data.Casino+data.Users, data.Users, data.Emitted) + depositRates() + "\n\n" + bankUsage)
+}
+
+func (e *Endpoint) HistoryHandler(c telebot.Context) error {
+	limit, page := 10, 1
+	args := c.Args()
+
+	// /history [n] [страница]
+	if len(args) > 2 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /history [количество] [страница].")
+	}
+	if len(args) >= 1 {
+		var err error
+		limit, err = strconv.Atoi(args[0])
+		if err != nil || limit < 1 || limit > 50 {
+			return c.Send("Ошибка: количество операций должно находиться в диапазоне от 1 до 50.")
+		}
+	}
+	if len(args) == 2 {
+		var err error
+		page, err = strconv.Atoi(args[1])
+		if err != nil || page < 1 {
+			return c.Send("Ошибка: номер страницы должен быть положительным числом.")
+		}
+	}
+
+	history, err := e.User.GetUserTransactions(c.Chat().ID, c.Sender().ID, limit, (page-1)*limit)
 	if err != nil {
 		return c.Send("Ошибка: " + err.Error())
 	}
+	if len(history) == 0 {
+		return c.Send("Операций не найдено.")
+	}
+
+	location := time.FixedZone("UTC+3", 3*60*60)
+	resultMsg := fmt.Sprintf("📜 История операций (страница %d):\n\n", page)
+	for _, t := range history {
+		sign, counterparty := "+", t.FromUsername
+		if t.From == c.Sender().ID {
+			sign, counterparty = "-", t.ToUsername
+		}
+
+		resultMsg += fmt.Sprintf("#%d %s %s%d зеток (%s", t.ID, t.CreatedAt.In(location).Format("02.01 15:04"), sign, t.Amount, t.Kind)
+		if counterparty != "" && t.From != constants.SystemID && t.To != constants.SystemID {
+			resultMsg += ", @" + counterparty
+		}
+		if t.Reference != "" {
+			resultMsg += ", " + t.Reference
+		}
+		resultMsg += ")\n"
+	}
+	if len(history) == limit {
+		resultMsg += fmt.Sprintf("\nСледующая страница: /history %d %d", limit, page+1)
+	}
 
-	return c.Send(fmt.Sprintf("📌 Информация о банке:\n\n👉 Общий баланс: %d зеток\nИз них хранятся на счетах пользователей: %d зеток", data["bank"].(int64)+data["users"].(int64), data["users"].(int64)))
+	return c.Send(resultMsg)
 }
@@ -0,0 +1,181 @@
+package plays
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/callback"
+	"hamsterbot/pkg/logger"
+	"strconv"
+)
+
+// Кнопки раздачи блэкджека, нажать их может только сам игрок
+const bjUnique = "bj" // данные: действие|раздача
+
+const (
+	bjHit    = "h"
+	bjStand  = "s"
+	bjDouble = "d"
+)
+
+type Blackjack interface {
+	StartBlackjack(chatID, userID int64, username string, bet int64) (models.BlackjackHand, error)
+	SetHandMessage(chatID, userID, handID, messageID int64) error
+	Hit(chatID, userID, handID int64) (models.BlackjackHand, error)
+	Stand(chatID, userID, handID int64) (models.BlackjackHand, error)
+	Double(chatID, userID, handID int64) (models.BlackjackHand, error)
+	ExpireHands() ([]models.BlackjackHand, error)
+}
+
+// RegisterBlackjack регистрирует обработчик кнопок блэкджека
+func (e *Endpoint) RegisterBlackjack(b *telebot.Bot) {
+	b.Handle(&telebot.Btn{Unique: bjUnique}, e.BlackjackCallback)
+}
+
+func (e *Endpoint) BlackjackHandler(c telebot.Context) error {
+	args := c.Args()
+	if len(args) != 1 { // /bj <сумма>
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /bj сумма")
+	}
+
+	amount, err := games.ParseAmount(args[0])
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	hand, err := e.Blackjack.StartBlackjack(c.Chat().ID, c.Sender().ID, c.Sender().Username, amount)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) начал раздачу блэкджека", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title,
+		zap.Int64("hand", hand.ID),
+		zap.Int64("amount", amount),
+	)
+
+	if hand.Result != "" {
+		return c.Send(handText(hand))
+	}
+
+	msg, err := c.Bot().Send(c.Recipient(), handText(hand), handMarkup(hand))
+	if err != nil {
+		return err
+	}
+	return e.Blackjack.SetHandMessage(c.Chat().ID, c.Sender().ID, hand.ID, int64(msg.ID))
+}
+
+// BlackjackCallback - нажатие кнопки хода: сообщение раздачи обновляется, после завершения кнопки пропадают
+func (e *Endpoint) BlackjackCallback(c telebot.Context) error {
+	data, err := callback.Verify(bjUnique, c.Args(), c.Sender().ID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+	if len(data) != 2 {
+		return c.Respond(&telebot.CallbackResponse{Text: callback.ErrInvalid.Error(), ShowAlert: true})
+	}
+	handID, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: callback.ErrInvalid.Error(), ShowAlert: true})
+	}
+
+	var hand models.BlackjackHand
+	switch data[0] {
+	case bjHit:
+		hand, err = e.Blackjack.Hit(c.Chat().ID, c.Sender().ID, handID)
+	case bjStand:
+		hand, err = e.Blackjack.Stand(c.Chat().ID, c.Sender().ID, handID)
+	case bjDouble:
+		hand, err = e.Blackjack.Double(c.Chat().ID, c.Sender().ID, handID)
+	default:
+		return c.Respond(&telebot.CallbackResponse{Text: callback.ErrInvalid.Error(), ShowAlert: true})
+	}
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Ошибка: " + err.Error(), ShowAlert: true})
+	}
+
+	if err = c.Respond(); err != nil {
+		return err
+	}
+
+	if hand.Result == "" {
+		return c.Edit(handText(hand), handMarkup(hand))
+	}
+
+	logger.Infof(fmt.Sprintf("Раздача блэкджека #%d пользователя @%s (%d): %s", hand.ID, c.Sender().Username, c.Sender().ID, hand.Result),
+		c.Chat().ID, c.Chat().Title,
+		zap.Int64("bet", hand.Bet),
+		zap.Int64("payout", hand.Payout),
+	)
+
+	return c.Edit(handText(hand))
+}
+
+// ExpireHands завершает просроченные раздачи, повторяет не прошедшие выплаты и обновляет сообщения раздач. Вызывается по таймеру
+func (e *Endpoint) ExpireHands(b *telebot.Bot) error {
+	hands, err := e.Blackjack.ExpireHands()
+
+	for _, hand := range hands {
+		if hand.MessageID == 0 {
+			continue
+		}
+
+		msg := telebot.StoredMessage{MessageID: strconv.FormatInt(hand.MessageID, 10), ChatID: hand.ChatID}
+		if _, editErr := b.Edit(msg, handText(hand)); editErr != nil {
+			logger.Warn("не удалось обновить сообщение раздачи", zap.Int64("hand", hand.ID), zap.Error(editErr))
+		}
+	}
+
+	return err
+}
+
+func handText(hand models.BlackjackHand) string {
+	text := fmt.Sprintf("🃏 Блэкджек #%d, @%s, ставка %d зеток\n\n", hand.ID, hand.Username, hand.Bet)
+
+	playerTotal, _ := games.HandValue(hand.Player)
+	if hand.Result == "" {
+		// пока игрок ходит, вторая карта дилера закрыта
+		text += fmt.Sprintf("Дилер: %s 🂠\n", games.CardLabel(hand.Dealer[0]))
+		text += fmt.Sprintf("Вы: %s (%d)\n\n", games.HandLabel(hand.Player), playerTotal)
+		return text + fmt.Sprintf("Ваш ход, через %d сек. без хода раздача завершится автоматически.",
+			int(constants.BlackjackTimeout.Seconds()))
+	}
+
+	dealerTotal, _ := games.HandValue(hand.Dealer)
+	text += fmt.Sprintf("Дилер: %s (%d)\n", games.HandLabel(hand.Dealer), dealerTotal)
+	text += fmt.Sprintf("Вы: %s (%d)\n\n", games.HandLabel(hand.Player), playerTotal)
+
+	switch hand.Result {
+	case games.BlackjackNatural:
+		text += fmt.Sprintf("🎉 Блэкджек! Выигрыш: %d зеток", hand.Payout)
+	case games.BlackjackWin:
+		text += fmt.Sprintf("✅ Вы выиграли! Выигрыш: %d зеток", hand.Payout)
+	case games.BlackjackPush:
+		text += "🤝 Ничья, ставка возвращена"
+	case games.BlackjackBust:
+		text += "💥 Перебор, ставка проиграна"
+	default:
+		text += "🚫 Дилер выиграл, ставка проиграна"
+	}
+
+	return text + fmt.Sprintf("\n\nВаш баланс: %d зеток", hand.Balance)
+}
+
+func handMarkup(hand models.BlackjackHand) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+	id := strconv.FormatInt(hand.ID, 10)
+
+	btns := []telebot.Btn{
+		markup.Data("➕ Ещё", bjUnique, callback.Sign(bjUnique, hand.UserID, bjHit, id)...),
+		markup.Data("✋ Хватит", bjUnique, callback.Sign(bjUnique, hand.UserID, bjStand, id)...),
+	}
+	if len(hand.Player) == 2 && !hand.Doubled {
+		btns = append(btns, markup.Data("✖️2 Удвоить", bjUnique, callback.Sign(bjUnique, hand.UserID, bjDouble, id)...))
+	}
+
+	markup.Inline(markup.Row(btns...))
+	return markup
+}
@@ -0,0 +1,198 @@
+package plays
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/callback"
+	"hamsterbot/pkg/logger"
+	"strconv"
+	"strings"
+)
+
+// Кнопки дуэли: принять и отклонить может только соперник, отменить - только вызвавший
+const duelUnique = "duel" // данные: действие|дуэль
+
+const (
+	duelAccept  = "a"
+	duelDecline = "d"
+	duelCancel  = "c"
+)
+
+type Duel interface {
+	Challenge(chatID, challengerID int64, challengerName, opponent string, amount int64) (models.Duel, error)
+	SetDuelMessage(duelID, messageID int64) error
+	AcceptDuel(duelID, opponentID int64) (models.Duel, error)
+	DeclineDuel(duelID, userID int64) (models.Duel, error)
+	ExpireDuels() ([]models.Duel, error)
+}
+
+// RegisterDuels регистрирует обработчик кнопок дуэли
+func (e *Endpoint) RegisterDuels(b *telebot.Bot) {
+	b.Handle(&telebot.Btn{Unique: duelUnique}, e.DuelCallback)
+}
+
+func (e *Endpoint) DuelHandler(c telebot.Context) error {
+	var username string
+	var amount int64
+	var err error
+	args := c.Args()
+
+	if len(args) == 2 { // /duel <username> <сумма>
+		username = args[0]
+		amount, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /duel username 100")
+		}
+	} else if len(args) == 1 && c.Message().ReplyTo != nil { // /duel <сумма>
+		username = c.Message().ReplyTo.Sender.Username
+		amount, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return c.Send("Неверный формат суммы. Пожалуйста, используйте правильный формат, например: /duel username 100")
+		}
+	} else {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /duel username сумма или ответьте командой /duel сумма на сообщение.")
+	}
+
+	if amount < 0 {
+		return c.Send("Ошибка: " + constants.ErrNegativeAmount)
+	} else if amount < 10 {
+		return c.Send("Ошибка: " + constants.ErrLessAmount)
+	}
+
+	duel, err := e.Duel.Challenge(c.Chat().ID, c.Sender().ID, c.Sender().Username, username, amount)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	resultMsg := fmt.Sprintf("⚔️ Дуэль #%d: @%s вызывает @%s на %d зеток!\n\n"+
+		"Ставки переводятся на счёт дуэлей, победитель забирает обе. У @%s есть %d мин., чтобы ответить.\n\n"+
+		"🔐 Хэш серверного сида: %s",
+		duel.ID, duel.ChallengerName, duel.OpponentName, duel.Amount,
+		duel.OpponentName, int(constants.DuelTimeout.Minutes()), duel.ServerSeedHash)
+
+	msg, err := c.Bot().Send(c.Recipient(), resultMsg, duelMarkup(duel))
+	if err != nil {
+		return err
+	}
+	if err = e.Duel.SetDuelMessage(duel.ID, int64(msg.ID)); err != nil {
+		return err
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) вызвал на дуэль пользователя @%s", c.Sender().Username, c.Sender().ID, duel.OpponentName),
+		c.Chat().ID, c.Chat().Title,
+		zap.Int64("duel", duel.ID),
+		zap.Int64("amount", duel.Amount),
+	)
+
+	return nil
+}
+
+// DuelCallback - нажатие кнопки под вызовом на дуэль
+func (e *Endpoint) DuelCallback(c telebot.Context) error {
+	data, err := callback.Verify(duelUnique, c.Args(), c.Sender().ID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+	if len(data) != 2 {
+		return c.Respond(&telebot.CallbackResponse{Text: callback.ErrInvalid.Error(), ShowAlert: true})
+	}
+	duelID, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: callback.ErrInvalid.Error(), ShowAlert: true})
+	}
+
+	var duel models.Duel
+	switch data[0] {
+	case duelAccept:
+		duel, err = e.Duel.AcceptDuel(duelID, c.Sender().ID)
+	case duelDecline, duelCancel:
+		duel, err = e.Duel.DeclineDuel(duelID, c.Sender().ID)
+	default:
+		return c.Respond(&telebot.CallbackResponse{Text: callback.ErrInvalid.Error(), ShowAlert: true})
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Respond(&telebot.CallbackResponse{Text: "Дуэль уже завершена или истекла.", ShowAlert: true})
+	} else if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Ошибка: " + err.Error(), ShowAlert: true})
+	}
+
+	if err = c.Respond(); err != nil {
+		return err
+	}
+
+	logger.Infof(fmt.Sprintf("Дуэль #%d между @%s и @%s: %s", duel.ID, duel.ChallengerName, duel.OpponentName, duel.Status),
+		c.Chat().ID, c.Chat().Title,
+		zap.Int64("amount", duel.Amount),
+		zap.String("result", duel.Result),
+	)
+
+	return c.Edit(duelResult(duel))
+}
+
+// ExpireDuels закрывает просроченные дуэли и обновляет их сообщения. Вызывается по таймеру
+func (e *Endpoint) ExpireDuels(b *telebot.Bot) error {
+	duels, err := e.Duel.ExpireDuels()
+
+	for _, duel := range duels {
+		if duel.MessageID == 0 {
+			continue
+		}
+
+		msg := telebot.StoredMessage{MessageID: strconv.FormatInt(duel.MessageID, 10), ChatID: duel.ChatID}
+		if _, editErr := b.Edit(msg, duelResult(duel)); editErr != nil {
+			logger.Warn("не удалось обновить сообщение дуэли", zap.Int64("duel", duel.ID), zap.Error(editErr))
+		}
+	}
+
+	return err
+}
+
+func duelResult(duel models.Duel) string {
+	header := fmt.Sprintf("⚔️ Дуэль #%d: @%s против @%s на %d зеток\n\n", duel.ID, duel.ChallengerName, duel.OpponentName, duel.Amount)
+
+	switch duel.Status {
+	case constants.DuelFinished:
+		winner, loser := duel.ChallengerName, duel.OpponentName
+		if duel.WinnerID != nil && *duel.WinnerID == duel.OpponentID {
+			winner, loser = loser, winner
+		}
+
+		// бросок записан как "кубики вызвавшего:кубики соперника", при ничьей броски повторяются через запятую
+		var throws string
+		for _, throw := range strings.Split(duel.Result, ",") {
+			sides := strings.SplitN(throw, ":", 2)
+			if len(sides) == 2 {
+				throws += fmt.Sprintf("🎲 @%s: %s, @%s: %s\n", duel.ChallengerName, sides[0], duel.OpponentName, sides[1])
+			}
+		}
+
+		return header + throws + fmt.Sprintf("\n🏆 @%s побеждает @%s и забирает %d зеток!\n\n"+
+			"🔐 Серверный сид: %s\nКлиентский сид: %s, nonce: %d",
+			winner, loser, 2*duel.Amount, duel.ServerSeed, duel.ClientSeed, duel.ID)
+	case constants.DuelDeclined:
+		return header + fmt.Sprintf("🚫 @%s отклонил вызов, ставка возвращена @%s.", duel.OpponentName, duel.ChallengerName)
+	case constants.DuelCanceled:
+		return header + fmt.Sprintf("🚫 @%s отменил вызов, ставка возвращена.", duel.ChallengerName)
+	case constants.DuelExpired:
+		return header + "⌛ Время на ответ истекло, ставки возвращены."
+	default:
+		return header
+	}
+}
+
+func duelMarkup(duel models.Duel) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+	id := strconv.FormatInt(duel.ID, 10)
+
+	accept := markup.Data("✅ Принять", duelUnique, callback.Sign(duelUnique, duel.OpponentID, duelAccept, id)...)
+	decline := markup.Data("❌ Отклонить", duelUnique, callback.Sign(duelUnique, duel.OpponentID, duelDecline, id)...)
+	cancel := markup.Data("🚫 Отменить", duelUnique, callback.Sign(duelUnique, duel.ChallengerID, duelCancel, id)...)
+
+	markup.Inline(markup.Row(accept, decline), markup.Row(cancel))
+	return markup
+}
@@ -0,0 +1,154 @@
+package plays
+
+import (
+	"fmt"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/pkg/callback"
+	"strconv"
+)
+
+// Кнопки игр: выбор (число, цвет и т.п.), выбор суммы ставки и повтор раунда с той же ставкой.
+// Данные кнопок подписаны через callback.Sign, нажать их может только тот, кто начал игру
+const (
+	choiceUnique = "gchoice" // данные: игра|выбор
+	betUnique    = "gbet"    // данные: игра|выбор|сумма
+)
+
+// betPresets - суммы ставок на клавиатуре
+var betPresets = []int64{10, 50, 100, 500, 1000, 5000}
+
+// RegisterKeyboards регистрирует обработчики кнопок игр
+func (e *Endpoint) RegisterKeyboards(b *telebot.Bot) {
+	b.Handle(&telebot.Btn{Unique: choiceUnique}, e.ChoiceCallback)
+	b.Handle(&telebot.Btn{Unique: betUnique}, e.BetCallback)
+}
+
+// sendKeyboard отвечает на команду игры без аргументов клавиатурой: выбором, если он есть в игре, иначе суммой ставки.
+// Шанс выигрыша показывается до ставки
+func (e *Endpoint) sendKeyboard(c telebot.Context, g games.Game) error {
+	odds := games.CurrentPaytable().Odds(g)
+	if chooser, ok := g.(games.Chooser); ok {
+		return c.Send(fmt.Sprintf("🎰 %s\n%s\n\nСделайте выбор:", g.Title(), odds), choiceMarkup(g, chooser, c.Sender().ID))
+	}
+
+	return c.Send(fmt.Sprintf("🎰 %s\n%s\n\nВыберите сумму ставки:", g.Title(), odds), betMarkup(g, 0, c.Sender().ID))
+}
+
+// ChoiceCallback - нажатие кнопки выбора: сообщение меняется на выбор суммы ставки
+func (e *Endpoint) ChoiceCallback(c telebot.Context) error {
+	g, choice, _, err := parseCallback(c, choiceUnique, 2)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+
+	label, _ := games.ChoiceLabel(g, choice)
+	chance := g.Chance(games.CurrentPaytable(), games.Bet{Choice: choice})
+	text := fmt.Sprintf("🎰 %s\nШанс выигрыша: %.2f%%\n\nВыберите сумму ставки:", g.Title(), chance*100)
+	if label != "" {
+		text = fmt.Sprintf("🎰 %s, ваш выбор: %s\nШанс выигрыша: %.2f%%\n\nВыберите сумму ставки:", g.Title(), label, chance*100)
+	}
+
+	if err = c.Respond(); err != nil {
+		return err
+	}
+	return c.Edit(text, betMarkup(g, choice, c.Sender().ID))
+}
+
+// BetCallback - нажатие кнопки ставки или повтора: раунд играется и результат приходит новым сообщением
+func (e *Endpoint) BetCallback(c telebot.Context) error {
+	g, choice, amount, err := parseCallback(c, betUnique, 3)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+
+	if err = c.Respond(); err != nil {
+		return err
+	}
+
+	// кнопки сыгранного сообщения убираются, чтобы раунд нельзя было сыграть повторным нажатием по старой клавиатуре
+	_, _ = c.Bot().EditReplyMarkup(c.Message(), nil)
+
+	return e.playRound(c, g, games.Bet{Amount: amount, Choice: choice})
+}
+
+// parseCallback проверяет подпись кнопки и разбирает её данные: игру, выбор и, если n == 3, сумму ставки
+func parseCallback(c telebot.Context, unique string, n int) (games.Game, int64, int64, error) {
+	data, err := callback.Verify(unique, c.Args(), c.Sender().ID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if len(data) != n {
+		return nil, 0, 0, callback.ErrInvalid
+	}
+
+	g := games.Get(data[0])
+	if g == nil {
+		return nil, 0, 0, callback.ErrInvalid
+	}
+
+	choice, err := strconv.ParseInt(data[1], 10, 64)
+	if err != nil {
+		return nil, 0, 0, callback.ErrInvalid
+	}
+	if _, ok := games.ChoiceLabel(g, choice); !ok {
+		return nil, 0, 0, callback.ErrInvalid
+	}
+
+	var amount int64
+	if n == 3 {
+		amount, err = games.ParseAmount(data[2])
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	return g, choice, amount, nil
+}
+
+func choiceMarkup(g games.Game, chooser games.Chooser, userID int64) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+
+	var btns []telebot.Btn
+	for _, choice := range chooser.Choices() {
+		btns = append(btns, markup.Data(choice.Label, choiceUnique,
+			callback.Sign(choiceUnique, userID, g.Name(), strconv.FormatInt(choice.Value, 10))...))
+	}
+
+	perRow := 6
+	if len(btns) <= 3 {
+		perRow = len(btns)
+	}
+	markup.Inline(markup.Split(perRow, btns)...)
+	return markup
+}
+
+func betMarkup(g games.Game, choice, userID int64) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+
+	var btns []telebot.Btn
+	for _, amount := range betPresets {
+		btns = append(btns, betButton(markup, g, choice, amount, userID, strconv.FormatInt(amount, 10)))
+	}
+
+	markup.Inline(markup.Split(3, btns)...)
+	return markup
+}
+
+// replayMarkup - кнопки под результатом раунда: повтор с той же ставкой и смена ставки
+func replayMarkup(g games.Game, bet games.Bet, userID int64) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+
+	replay := betButton(markup, g, bet.Choice, bet.Amount, userID, fmt.Sprintf("🔁 Ещё раз (%d)", bet.Amount))
+
+	change := markup.Data("💰 Другая ставка", choiceUnique,
+		callback.Sign(choiceUnique, userID, g.Name(), strconv.FormatInt(bet.Choice, 10))...)
+
+	markup.Inline(markup.Row(replay, change))
+	return markup
+}
+
+func betButton(markup *telebot.ReplyMarkup, g games.Game, choice, amount, userID int64, text string) telebot.Btn {
+	return markup.Data(text, betUnique,
+		callback.Sign(betUnique, userID, g.Name(), strconv.FormatInt(choice, 10), strconv.FormatInt(amount, 10))...)
+}
@@ -0,0 +1,62 @@
+package plays
+
+import (
+	"errors"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/pkg/callback"
+	"strings"
+	"testing"
+)
+
+// TestParseCallback проверяет, что данные настоящей кнопки ставки разбираются обработчиком,
+// а подделанные отклоняются: тест сломается, если формат кнопки и разбор разойдутся
+func TestParseCallback(t *testing.T) {
+	callback.Init("secret")
+	bot, err := telebot.NewBot(telebot.Settings{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := games.Get("rln")
+	btn := betButton(&telebot.ReplyMarkup{}, g, 17, 1000, 42, "1000")
+
+	// replace возвращает данные кнопки с заменённым полем i
+	replace := func(i int, v string) string {
+		fields := strings.Split(btn.Data, "|")
+		fields[i] = v
+		return strings.Join(fields, "|")
+	}
+
+	tests := []struct {
+		name   string
+		unique string
+		data   string
+		userID int64
+		err    error
+	}{
+		{"valid", betUnique, btn.Data, 42, nil},
+		{"tampered amount", betUnique, replace(2, "999999"), 42, callback.ErrInvalid},
+		{"tampered choice", betUnique, replace(1, "0"), 42, callback.ErrInvalid},
+		{"choice button", choiceUnique, btn.Data, 42, callback.ErrInvalid},
+		{"foreign user", betUnique, btn.Data, 43, callback.ErrForeign},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := bot.NewContext(telebot.Update{Callback: &telebot.Callback{Data: tt.data, Sender: &telebot.User{ID: tt.userID}}})
+
+			n := 3
+			if tt.unique == choiceUnique {
+				n = 2
+			}
+			got, choice, amount, err := parseCallback(c, tt.unique, n)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("parseCallback вернул ошибку %v, ожидалось %v", err, tt.err)
+			}
+			if err == nil && (got != g || choice != 17 || amount != 1000) {
+				t.Errorf("parseCallback вернул %s, %d, %d", got.Name(), choice, amount)
+			}
+		})
+	}
+}
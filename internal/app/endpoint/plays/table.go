@@ -0,0 +1,156 @@
+package plays
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Table interface {
+	OpenTable(chatID, userID int64, username string, duration time.Duration) (models.TableRound, error)
+	SetTableMessage(chatID, roundID, messageID int64) error
+	PlaceTableBets(chatID, userID int64, username string, bets []games.TableBet) (models.TableRound, int64, error)
+	DueTables() ([]int64, error)
+	SpinTable(chatID int64) (models.TableRound, []games.TableEntry, error)
+}
+
+func (e *Endpoint) TableHandler(c telebot.Context) error {
+	args := c.Args()
+	duration := constants.TableDuration
+
+	if len(args) == 1 { // /table <секунды>
+		seconds, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return c.Send("Неверный формат времени. Пожалуйста, используйте, например: /table 60")
+		}
+		duration = time.Duration(seconds) * time.Second
+		if duration < constants.TableMinDuration || duration > constants.TableMaxDuration {
+			return c.Send(fmt.Sprintf("Ошибка: приём ставок может длиться от %d до %d секунд.",
+				int(constants.TableMinDuration.Seconds()), int(constants.TableMaxDuration.Seconds())))
+		}
+	} else if len(args) > 1 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /table [секунды]")
+	}
+
+	round, err := e.Table.OpenTable(c.Chat().ID, c.Sender().ID, c.Sender().Username, duration)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	pt := games.CurrentPaytable()
+	resultMsg := fmt.Sprintf("🎡 Стол рулетки #%d открыт @%s! Ставки принимаются %d сек.\n\n"+
+		"%s\n\n"+
+		"Выплаты: число x%d, цвет x%d, дюжина x%d, чёт/нечет x%d. На зеро проигрывают все ставки, кроме ставки на 0.\n\n"+
+		"🔐 Хэш серверного сида: %s",
+		round.ID, round.OpenedName, int(duration.Seconds()), games.TableUsage(),
+		pt.Table.Number, pt.Table.Color, pt.Table.Dozen, pt.Table.Parity, round.ServerSeedHash)
+
+	msg, err := c.Bot().Send(c.Recipient(), resultMsg)
+	if err != nil {
+		return err
+	}
+	if err = e.Table.SetTableMessage(c.Chat().ID, round.ID, int64(msg.ID)); err != nil {
+		return err
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) открыл стол рулетки", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title,
+		zap.Int64("round", round.ID),
+		zap.Duration("duration", duration),
+	)
+
+	return nil
+}
+
+func (e *Endpoint) BetHandler(c telebot.Context) error {
+	bets, err := games.ParseTableBets(c.Args())
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	round, balance, err := e.Table.PlaceTableBets(c.Chat().ID, c.Sender().ID, c.Sender().Username, bets)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	labels := make([]string, 0, len(bets))
+	for _, bet := range bets {
+		labels = append(labels, fmt.Sprintf("%s - %d", bet.Label(), bet.Amount))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) сделал ставки на столе рулетки", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title,
+		zap.Int64("round", round.ID),
+		zap.Strings("bets", labels),
+	)
+
+	return c.Send(fmt.Sprintf("🎡 Ставки на раунд #%d приняты: %s\n\nВаш баланс: %d зеток",
+		round.ID, strings.Join(labels, ", "), balance))
+}
+
+// SpinTables вращает колесо во всех чатах, где закончился приём ставок, и публикует результаты. Вызывается по таймеру
+func (e *Endpoint) SpinTables(b *telebot.Bot) error {
+	chats, err := e.Table.DueTables()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, chatID := range chats {
+		round, entries, err := e.Table.SpinTable(chatID)
+		if err != nil && err.Error() == constants.ErrTableClosed {
+			// раунд мог уже разыграть другой экземпляр бота
+			continue
+		}
+		if err != nil {
+			// результаты публикуются после всех выплат, раунд будет разыгран повторно
+			logger.Warn("не удалось разыграть стол", zap.Int64("chat", chatID), zap.Error(err))
+			errs = append(errs, err)
+			continue
+		}
+
+		opts := &telebot.SendOptions{}
+		if round.MessageID != 0 {
+			opts.ReplyTo = &telebot.Message{ID: int(round.MessageID), Chat: &telebot.Chat{ID: chatID}}
+		}
+		if _, err := b.Send(&telebot.Chat{ID: chatID}, tableResult(round, entries), opts); err != nil {
+			logger.Warn("не удалось отправить результаты стола", zap.Int64("chat", chatID), zap.Int64("round", round.ID), zap.Error(err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func tableResult(round models.TableRound, entries []games.TableEntry) string {
+	resultMsg := fmt.Sprintf("🎡 Стол рулетки #%d: выпало %s\n\n", round.ID, games.PocketLabel(round.Pocket))
+
+	if len(entries) == 0 {
+		resultMsg += "Ставок не было.\n"
+	}
+
+	var staked, paid int64
+	for _, entry := range entries {
+		staked += entry.Amount
+		paid += entry.Payout
+
+		if entry.Payout > 0 {
+			resultMsg += fmt.Sprintf("✅ @%s: %s (%d) → +%d\n", entry.Username, entry.Label(), entry.Amount, entry.Payout)
+		} else {
+			resultMsg += fmt.Sprintf("🚫 @%s: %s (%d)\n", entry.Username, entry.Label(), entry.Amount)
+		}
+	}
+	if len(entries) > 0 {
+		resultMsg += fmt.Sprintf("\nВсего ставок: %d зеток, выплачено: %d зеток\n", staked, paid)
+	}
+
+	return resultMsg + fmt.Sprintf("\n🔐 Серверный сид: %s\nКлиентский сид: %s, nonce: %d",
+		round.ServerSeed, round.ClientSeed, round.ID)
+}
@@ -0,0 +1,54 @@
+package seeds
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+)
+
+type Seed interface {
+	GetSeed(userID int64) (models.Seed, error)
+	Rotate(userID int64, clientSeed string) (models.Seed, models.Seed, error)
+}
+
+type Endpoint struct {
+	Seed Seed
+}
+
+func (e *Endpoint) SeedHandler(c telebot.Context) error {
+	args := c.Args()
+
+	switch {
+	case len(args) == 0: // /seed
+		seed, err := e.Seed.GetSeed(c.Sender().ID)
+		if err != nil {
+			return c.Send("Ошибка: " + err.Error())
+		}
+
+		return c.Send(fmt.Sprintf("🔐 Ваши сиды:\n\n👉 Хэш серверного сида: %s\n👉 Клиентский сид: %s\n👉 Сыграно раундов: %d\n\n"+
+			"Серверный сид раскрывается при смене: /seed rotate [клиентский сид]", seed.ServerSeedHash, seed.ClientSeed, seed.Nonce))
+	case args[0] == "rotate" && len(args) <= 2: // /seed rotate [клиентский сид]
+		var clientSeed string
+		if len(args) == 2 {
+			clientSeed = args[1]
+		}
+		if len(clientSeed) > 64 {
+			return c.Send("Ошибка: клиентский сид не может быть длиннее 64 символов.")
+		}
+
+		oldSeed, newSeed, err := e.Seed.Rotate(c.Sender().ID, clientSeed)
+		if err != nil {
+			return c.Send("Ошибка: " + err.Error())
+		}
+
+		logger.Infof(fmt.Sprintf("Пользователь @%s (%d) сменил сиды", c.Sender().Username, c.Sender().ID),
+			c.Chat().ID, c.Chat().Title, zap.Int64("oldSeed", oldSeed.ID), zap.Int64("newSeed", newSeed.ID))
+		return c.Send(fmt.Sprintf("🔓 Старый серверный сид раскрыт:\n\n👉 Серверный сид: %s\n👉 Хэш: %s\n👉 Клиентский сид: %s\n👉 Сыграно раундов: %d\n\n"+
+			"🔐 Новые сиды:\n\n👉 Хэш серверного сида: %s\n👉 Клиентский сид: %s\n\nТеперь прошлые раунды можно проверить командой /verify <номер раунда>",
+			oldSeed.ServerSeed, oldSeed.ServerSeedHash, oldSeed.ClientSeed, oldSeed.Nonce, newSeed.ServerSeedHash, newSeed.ClientSeed))
+	default:
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /seed или /seed rotate [клиентский сид].")
+	}
+}
@@ -0,0 +1,44 @@
+package shop
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/logger"
+)
+
+type Shop interface {
+	Offer(chatID, id int64) (models.User, models.Upgrade, error)
+	Upgrade(chatID, id int64) (models.User, models.Upgrade, error)
+}
+
+type Endpoint struct {
+	Shop Shop
+}
+
+func (e *Endpoint) ShopHandler(c telebot.Context) error {
+	user, upgrade, err := e.Shop.Offer(c.Chat().ID, c.Sender().ID)
+	if err != nil {
+		return c.Send(fmt.Sprintf("📌 Ваш уровень: %d ур., доход: %d зеток/ч\n\nОшибка: %s.", user.Lvl, user.Income, err.Error()))
+	}
+
+	return c.Send(fmt.Sprintf("🛒 Магазин улучшений\n\n👉 Ваш уровень: %d ур.\n👉 Доход: %d зеток/ч\n👉 Баланс: %d зеток\n\n"+
+		"Следующий уровень: %d ур. за %d зеток\nДоход после улучшения: %d зеток/ч (+%d)\n\nКупить: /upgrade",
+		user.Lvl, user.Income, user.Balance, upgrade.Lvl, upgrade.Price, upgrade.Income, upgrade.Bonus))
+}
+
+func (e *Endpoint) UpgradeHandler(c telebot.Context) error {
+	user, upgrade, err := e.Shop.Upgrade(c.Chat().ID, c.Sender().ID)
+	if err != nil {
+		if upgrade.Price > 0 {
+			return c.Send(fmt.Sprintf("Ошибка: %s. Улучшение стоит %d зеток, ваш баланс: %d зеток", err.Error(), upgrade.Price, user.Balance))
+		}
+		return c.Send(fmt.Sprintf("Ошибка: %s.", err.Error()))
+	}
+
+	logger.Infof(fmt.Sprintf("Пользователь @%s (%d) повысил уровень", c.Sender().Username, c.Sender().ID),
+		c.Chat().ID, c.Chat().Title, zap.Int64("lvl", user.Lvl), zap.Int64("price", upgrade.Price), zap.Int64("income", user.Income))
+	return c.Send(fmt.Sprintf("⬆️ Уровень повышен до %d ур.\n\n👉 Доход: %d зеток/ч (+%d)\n👉 Баланс: %d зеток",
+		user.Lvl, user.Income, upgrade.Bonus, user.Balance))
+}
@@ -0,0 +1,77 @@
+package tops
+
+import (
+	"fmt"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"strconv"
+)
+
+type Top interface {
+	GetTop(chatID int64, metric string, page int64) ([]models.UserTop, int64, error)
+	GetRank(chatID int64, metric string, id int64) (models.UserTop, error)
+}
+
+type Endpoint struct {
+	Top Top
+}
+
+var titles = map[string]string{
+	constants.TopBalance: "по балансу",
+	constants.TopLvl:     "по уровню",
+	constants.TopIncome:  "по доходу",
+}
+
+func (e *Endpoint) TopHandler(c telebot.Context) error {
+	args := c.Args()
+
+	// /top <показатель> [страница]
+	if len(args) == 0 || len(args) > 2 {
+		return c.Send("Неверный формат команды. Пожалуйста, используйте: /top balance/lvl/income [страница] или симлинки /topb, /topl, /topi соответственно.")
+	}
+
+	return e.TopHandlerCommand(c, args[0], args[1:])
+}
+
+// TopHandlerCommand выводит топ по показателю metric, args - необязательный номер страницы
+func (e *Endpoint) TopHandlerCommand(c telebot.Context, metric string, args []string) error {
+	title, ok := titles[metric]
+	if !ok {
+		return c.Send("Неизвестный топ. Пожалуйста, используйте: /top balance/lvl/income [страница].")
+	}
+
+	page := int64(1)
+	if len(args) > 0 {
+		var err error
+		page, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil || page < 1 {
+			return c.Send("Неверный номер страницы. Пожалуйста, используйте, например: /top balance 2")
+		}
+	}
+
+	data, total, err := e.Top.GetTop(c.Chat().ID, metric, page)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error())
+	}
+
+	pages := max((total+constants.TopPageSize-1)/constants.TopPageSize, 1)
+	if len(data) == 0 {
+		return c.Send(fmt.Sprintf("В топе всего %d стр.", pages))
+	}
+
+	resultMsg := fmt.Sprintf("🎰 Топ игроков %s (стр. %d из %d):\n\n", title, page, pages)
+	for _, topValue := range data {
+		resultMsg += fmt.Sprintf("%d. %s: %d\n", topValue.Rank, topValue.Username, topValue.Value)
+	}
+
+	own, err := e.Top.GetRank(c.Chat().ID, metric, c.Sender().ID)
+	if err != nil {
+		return c.Send("Ошибка: " + err.Error())
+	}
+	if own.Rank > 0 {
+		resultMsg += fmt.Sprintf("\n👉 Ваше место: %d из %d (%d)", own.Rank, total, own.Value)
+	}
+
+	return c.Send(resultMsg)
+}
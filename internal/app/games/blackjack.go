@@ -0,0 +1,116 @@
+package games
+
+import (
+	"hamsterbot/pkg/fair"
+	"strings"
+)
+
+// Блэкджек - игра с состоянием: раздача живёт между нажатиями кнопок, поэтому она не реализует Game,
+// а здесь собраны только правила. Карта - число от 0 до 51: масть - card/13, достоинство - card%13 (0 - туз)
+
+// Исходы раздачи
+const (
+	BlackjackNatural = "blackjack" // блэкджек игрока, выплата 3:2
+	BlackjackWin     = "win"
+	BlackjackPush    = "push" // ничья, ставка возвращается
+	BlackjackLose    = "lose"
+	BlackjackBust    = "bust" // перебор игрока
+)
+
+var (
+	cardRanks = []string{"A", "2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K"}
+	cardSuits = []string{"♠", "♥", "♦", "♣"}
+)
+
+// NewShoe возвращает перемешанный на генераторе rng башмак из decks колод
+func NewShoe(rng *fair.RNG, decks int) []int {
+	shoe := make([]int, 0, decks*52)
+	for i := 0; i < decks; i++ {
+		for card := 0; card < 52; card++ {
+			shoe = append(shoe, card)
+		}
+	}
+
+	for i := len(shoe) - 1; i > 0; i-- {
+		j := rng.Intn(i + 1)
+		shoe[i], shoe[j] = shoe[j], shoe[i]
+	}
+	return shoe
+}
+
+func CardLabel(card int) string {
+	return cardRanks[card%13] + cardSuits[card/13%4]
+}
+
+func HandLabel(cards []int) string {
+	labels := make([]string, len(cards))
+	for i, card := range cards {
+		labels[i] = CardLabel(card)
+	}
+	return strings.Join(labels, " ")
+}
+
+// HandValue возвращает очки руки и признак мягкой руки (туз считается за 11)
+func HandValue(cards []int) (int, bool) {
+	var total, aces int
+	for _, card := range cards {
+		rank := card%13 + 1
+		switch {
+		case rank == 1:
+			aces++
+			total++
+		case rank >= 10:
+			total += 10
+		default:
+			total += rank
+		}
+	}
+
+	if aces > 0 && total+10 <= 21 {
+		return total + 10, true
+	}
+	return total, false
+}
+
+// IsBlackjack - 21 очко с двух карт
+func IsBlackjack(cards []int) bool {
+	total, _ := HandValue(cards)
+	return len(cards) == 2 && total == 21
+}
+
+// DealerHits - дилер берёт карту до 17 очков и на мягких 17
+func DealerHits(cards []int) bool {
+	total, soft := HandValue(cards)
+	return total < 17 || (total == 17 && soft)
+}
+
+// BlackjackMaxPayout - наибольшая выплата раздачи со ставкой bet: блэкджек игрока, а после удвоения - обычный выигрыш
+func BlackjackMaxPayout(bet int64, doubled bool) int64 {
+	if doubled {
+		return 2 * bet
+	}
+	return bet + bet*3/2
+}
+
+// BlackjackSettle возвращает исход раздачи и выплату с учётом ставки bet
+func BlackjackSettle(player, dealer []int, bet int64) (string, int64) {
+	playerTotal, _ := HandValue(player)
+	dealerTotal, _ := HandValue(dealer)
+
+	switch {
+	case playerTotal > 21:
+		return BlackjackBust, 0
+	case IsBlackjack(player) && IsBlackjack(dealer):
+		return BlackjackPush, bet
+	case IsBlackjack(player):
+		return BlackjackNatural, bet + bet*3/2
+	case IsBlackjack(dealer):
+		return BlackjackLose, 0
+	case dealerTotal > 21 || playerTotal > dealerTotal:
+		return BlackjackWin, 2 * bet
+	case playerTotal == dealerTotal:
+		return BlackjackPush, bet
+	default:
+		return BlackjackLose, 0
+	}
+}
@@ -0,0 +1,54 @@
+package games
+
+import "strconv"
+
+// Chooser - игра с выбором игрока (число, цвет и т.п.). Для таких игр клавиатура
+// сначала предлагает выбор, а затем сумму ставки
+type Chooser interface {
+	Choices() []Choice
+}
+
+type Choice struct {
+	Label string
+	Value int64
+}
+
+func (RouletteNum) Choices() []Choice {
+	return numberChoices(1, 36)
+}
+
+func (RouletteColor) Choices() []Choice {
+	return []Choice{{"⬛ Чёрное", PocketBlack}, {"🟥 Красное", PocketRed}, {"🟩 Зелёное", PocketGreen}}
+}
+
+func (RockPaperScissors) Choices() []Choice {
+	return []Choice{{"🪨 Камень", 1}, {"✂️ Ножницы", 2}, {"📄 Бумага", 3}}
+}
+
+func (Dice) Choices() []Choice {
+	return numberChoices(2, 12)
+}
+
+// ChoiceLabel возвращает подпись выбора value в игре g и признак того, что такой выбор в игре есть.
+// Для игр без выбора допустим только выбор 0
+func ChoiceLabel(g Game, value int64) (string, bool) {
+	chooser, ok := g.(Chooser)
+	if !ok {
+		return "", value == 0
+	}
+
+	for _, choice := range chooser.Choices() {
+		if choice.Value == value {
+			return choice.Label, true
+		}
+	}
+	return "", false
+}
+
+func numberChoices(from, to int64) []Choice {
+	choices := make([]Choice, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		choices = append(choices, Choice{strconv.FormatInt(n, 10), n})
+	}
+	return choices
+}
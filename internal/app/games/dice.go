@@ -0,0 +1,82 @@
+package games
+
+import (
+	"errors"
+	"fmt"
+	"hamsterbot/pkg/fair"
+	"strconv"
+)
+
+type Dice struct{}
+
+func init() {
+	Register(Dice{})
+}
+
+func (Dice) Name() string  { return "dice" }
+func (Dice) Title() string { return "Кости" }
+func (Dice) Usage() string { return "/dice <число> <сумма>" }
+
+func (Dice) Rules(pt *Paytable) string {
+	return "В игре 'Кости' игрок выбирает сумму ставки и предполагаемую сумму двух кубиков " +
+		"(от 2 до 12).\n\n\t•\tЕсли сумма чисел на кубиках совпадает с предполагаемой, игрок выигрывает " +
+		fmt.Sprintf("и получает x%d суммы ставки \n\t•\tВ противном случае, ставка считается проигранной.\n\nПример ", pt.Dice.Multiplier) +
+		"команды: /dice 12 100"
+}
+
+func (g Dice) ParseBet(args []string) (Bet, error) {
+	if len(args) != 2 {
+		return Bet{}, usageError(g)
+	}
+
+	number, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return Bet{}, usageError(g)
+	}
+	if number < 2 || number > 12 {
+		return Bet{}, errors.New("число должно находиться в диапазоне от 2 до 12")
+	}
+
+	amount, err := ParseAmount(args[1])
+	if err != nil {
+		return Bet{}, err
+	}
+
+	return Bet{Amount: amount, Choice: number}, nil
+}
+
+func (Dice) Resolve(rng *fair.RNG, pt *Paytable, bet Bet) Outcome {
+	result := []int64{int64(rng.Intn(6) + 1), int64(rng.Intn(6) + 1)}
+
+	var payout int64
+	if result[0]+result[1] == bet.Choice {
+		payout = bet.Amount * pt.Dice.Multiplier
+	}
+
+	return Outcome{Result: joinValues(result, " + "), Values: result, Payout: payout}
+}
+
+// Chance: сумму n дают 6 - |7 - n| комбинаций из 36
+func (Dice) Chance(_ *Paytable, bet Bet) float64 {
+	if bet.Choice < 2 || bet.Choice > 12 {
+		return 0
+	}
+	distance := bet.Choice - 7
+	if distance < 0 {
+		distance = -distance
+	}
+	return float64(6-distance) / 36
+}
+
+func (Dice) MaxPayout(pt *Paytable, bet Bet) int64 {
+	return bet.Amount * pt.Dice.Multiplier
+}
+
+// RTP: сумму 2 или 12 даёт 1 комбинация из 36, сумму 7 - 6 комбинаций
+func (Dice) RTP(pt *Paytable) (float64, float64) {
+	return float64(pt.Dice.Multiplier) / 36, float64(pt.Dice.Multiplier) * 6 / 36
+}
+
+func (Dice) Render(_ Bet, outcome Outcome) string {
+	return fmt.Sprintf("На 🎲№1 выпало: %d\nНа 🎲№2 выпало: %d\n\n", outcome.Values[0], outcome.Values[1])
+}
@@ -0,0 +1,116 @@
+package games
+
+import (
+	"errors"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/pkg/fair"
+	"strconv"
+	"strings"
+)
+
+// Game - мини-игра казино. Чтобы добавить игру, достаточно реализовать этот интерфейс
+// и зарегистрировать тип через Register в init(): команда и правила подключатся автоматически.
+type Game interface {
+	// Name - идентификатор игры, он же команда бота (/slots) и аргумент /rule
+	Name() string
+	Title() string
+	Usage() string
+	Rules(pt *Paytable) string
+	// ParseBet разбирает аргументы команды в ставку
+	ParseBet(args []string) (Bet, error)
+	// Resolve разыгрывает раунд на генераторе rng по таблице выплат pt. Исход зависит только от генератора и ставки
+	Resolve(rng *fair.RNG, pt *Paytable, bet Bet) Outcome
+	// Chance возвращает вероятность выигрыша ставки bet
+	Chance(pt *Paytable, bet Bet) float64
+	// MaxPayout возвращает наибольшую возможную выплату по ставке bet. Казино принимает ставку, только если может её покрыть
+	MaxPayout(pt *Paytable, bet Bet) int64
+	// RTP возвращает теоретический возврат игроку по таблице pt: минимум и максимум по выбору игрока
+	RTP(pt *Paytable) (float64, float64)
+	// Render возвращает строку с результатом раунда для сообщения
+	Render(bet Bet, outcome Outcome) string
+}
+
+type Bet struct {
+	Amount int64
+	Choice int64 // выбор игрока: число, цвет и т.п. Для игр без выбора - 0
+}
+
+type Outcome struct {
+	Result string  // каноничная запись результата, сохраняется в раунде и сверяется в /verify
+	Values []int64 // выпавшие значения для Render
+	Payout int64   // выплата с учётом ставки, 0 при проигрыше
+}
+
+type Result struct {
+	Bet     Bet
+	Outcome Outcome
+	RoundID int64
+	Balance int64
+}
+
+var registry []Game
+
+func Register(g Game) {
+	if Get(g.Name()) != nil {
+		panic("игра " + g.Name() + " уже зарегистрирована")
+	}
+	registry = append(registry, g)
+}
+
+func Get(name string) Game {
+	for _, g := range registry {
+		if g.Name() == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func All() []Game {
+	return registry
+}
+
+// ParseAmount разбирает и проверяет сумму ставки
+func ParseAmount(s string) (int64, error) {
+	amount, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("неверный формат суммы")
+	}
+
+	if amount < 0 {
+		return 0, errors.New(constants.ErrNegativeAmount)
+	} else if amount < 10 {
+		return 0, errors.New(constants.ErrLessAmount)
+	}
+
+	return amount, nil
+}
+
+// ChanceRange возвращает наименьший и наибольший шанс выигрыша в игре g по выбору игрока
+func ChanceRange(g Game, pt *Paytable) (float64, float64) {
+	chooser, ok := g.(Chooser)
+	if !ok {
+		chance := g.Chance(pt, Bet{})
+		return chance, chance
+	}
+
+	minChance, maxChance := 1.0, 0.0
+	for _, choice := range chooser.Choices() {
+		chance := g.Chance(pt, Bet{Choice: choice.Value})
+		minChance = min(minChance, chance)
+		maxChance = max(maxChance, chance)
+	}
+	return minChance, maxChance
+}
+
+func usageError(g Game) error {
+	return errors.New("неверный формат команды. Пожалуйста, используйте: " + g.Usage())
+}
+
+func joinValues(values []int64, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatInt(v, 10)
+	}
+	return strings.Join(parts, sep)
+}
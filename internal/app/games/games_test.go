@@ -0,0 +1,193 @@
+package games
+
+import (
+	"hamsterbot/pkg/fair"
+	"math"
+	"testing"
+)
+
+// resolveUntil разыгрывает раунды игры g с nonce 0, 1, ... и возвращает первый исход, для которого ok вернула true
+func resolveUntil(t *testing.T, g Game, bet Bet, ok func(Outcome) bool) Outcome {
+	t.Helper()
+
+	pt := DefaultPaytable()
+	for nonce := int64(0); nonce < 10000; nonce++ {
+		outcome := g.Resolve(fair.New("server", "client", nonce), pt, bet)
+		if ok(outcome) {
+			return outcome
+		}
+	}
+	t.Fatalf("%s: за 10000 раундов не выпал нужный исход", g.Name())
+	return Outcome{}
+}
+
+func TestResolve(t *testing.T) {
+	pt := DefaultPaytable()
+	tests := []struct {
+		game   string
+		bet    Bet
+		wins   func(Outcome) bool // выигрышный ли исход по правилам игры
+		payout int64              // ожидаемая выплата выигрыша, 0 - проверяется только, что она больше ставки
+	}{
+		{"dice", Bet{Amount: 100, Choice: 7}, func(o Outcome) bool { return o.Values[0]+o.Values[1] == 7 }, 100 * pt.Dice.Multiplier},
+		{"rln", Bet{Amount: 100, Choice: 17}, func(o Outcome) bool { return o.Values[0] == 17 }, 100 * pt.RouletteNum.Multiplier},
+		{"rlc", Bet{Amount: 100, Choice: PocketBlack}, func(o Outcome) bool { return PocketColor(o.Values[0]) == PocketBlack }, 100 * pt.RouletteColor.Multiplier},
+		{"rlc", Bet{Amount: 100, Choice: PocketRed}, func(o Outcome) bool { return PocketColor(o.Values[0]) == PocketRed }, 100 * pt.RouletteColor.Multiplier},
+		{"rlc", Bet{Amount: 100, Choice: PocketGreen}, func(o Outcome) bool { return o.Values[0] == 0 }, 100 * pt.RouletteColor.GreenMultiplier},
+		{"rsp", Bet{Amount: 100, Choice: 1}, func(o Outcome) bool { return o.Values[0] == 1 }, 100 * pt.RockPaperScissors.Multiplier},
+		{"slots", Bet{Amount: 100}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		g := Get(tt.game)
+		if g == nil {
+			t.Fatalf("игра %s не зарегистрирована", tt.game)
+		}
+
+		t.Run(tt.game+"/win", func(t *testing.T) {
+			outcome := resolveUntil(t, g, tt.bet, func(o Outcome) bool { return o.Payout > 0 })
+			if tt.wins != nil && !tt.wins(outcome) {
+				t.Errorf("выплата %d за проигрышный исход %q", outcome.Payout, outcome.Result)
+			}
+			if tt.payout != 0 && outcome.Payout != tt.payout {
+				t.Errorf("выплата %d, ожидалось %d", outcome.Payout, tt.payout)
+			}
+			if outcome.Payout <= tt.bet.Amount {
+				t.Errorf("выплата %d не больше ставки %d", outcome.Payout, tt.bet.Amount)
+			}
+			if max := g.MaxPayout(pt, tt.bet); outcome.Payout > max {
+				t.Errorf("выплата %d больше MaxPayout %d", outcome.Payout, max)
+			}
+		})
+
+		t.Run(tt.game+"/lose", func(t *testing.T) {
+			outcome := resolveUntil(t, g, tt.bet, func(o Outcome) bool { return o.Payout == 0 })
+			if tt.wins != nil && tt.wins(outcome) {
+				t.Errorf("нет выплаты за выигрышный исход %q", outcome.Result)
+			}
+		})
+
+		// доля выигрышей на честном генераторе должна сходиться к объявленному шансу: исход ничем не подкручивается
+		t.Run(tt.game+"/chance", func(t *testing.T) {
+			const rounds = 20000
+			var wins int
+			for nonce := int64(0); nonce < rounds; nonce++ {
+				if g.Resolve(fair.New("server", "client", nonce), pt, tt.bet).Payout > 0 {
+					wins++
+				}
+			}
+			chance := g.Chance(pt, tt.bet)
+			if got := float64(wins) / rounds; math.Abs(got-chance) > 0.01 {
+				t.Errorf("доля выигрышей %.4f, объявленный шанс %.4f", got, chance)
+			}
+		})
+	}
+}
+
+// TestResolveReproducible проверяет, что /verify пересчитает тот же исход по раскрытым сидам
+func TestResolveReproducible(t *testing.T) {
+	pt := DefaultPaytable()
+	for _, g := range All() {
+		bet := Bet{Amount: 100, Choice: 1}
+		if g.Name() == "dice" {
+			bet.Choice = 7
+		}
+
+		for nonce := int64(0); nonce < 50; nonce++ {
+			first := g.Resolve(fair.New("server", "client", nonce), pt, bet)
+			second := g.Resolve(fair.New("server", "client", nonce), pt, bet)
+			if first.Result != second.Result || first.Payout != second.Payout {
+				t.Fatalf("%s, nonce %d: %q/%d и %q/%d", g.Name(), nonce, first.Result, first.Payout, second.Result, second.Payout)
+			}
+		}
+	}
+}
+
+func TestBlackjackSettle(t *testing.T) {
+	// карта c: ранг c%13+1, 0 - туз, 9-12 - десятки и картинки
+	const (
+		ace   = 0
+		five  = 4
+		seven = 6
+		nine  = 8
+		ten   = 9
+		king  = 12
+	)
+
+	tests := []struct {
+		name           string
+		player, dealer []int
+		result         string
+		payout         int64
+	}{
+		{"natural", []int{ace, king}, []int{ten, nine}, BlackjackNatural, 250},
+		{"win", []int{ten, nine}, []int{ten, seven}, BlackjackWin, 200},
+		{"dealer bust", []int{ten, five}, []int{ten, five, king}, BlackjackWin, 200},
+		{"push", []int{ten, seven}, []int{king, seven}, BlackjackPush, 100},
+		{"lose", []int{ten, seven}, []int{ten, nine}, BlackjackLose, 0},
+		{"bust", []int{ten, five, king}, []int{ten, seven}, BlackjackBust, 0},
+		{"dealer natural", []int{ten, five, five + 1}, []int{ace, ten}, BlackjackLose, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, payout := BlackjackSettle(tt.player, tt.dealer, 100)
+			if result != tt.result || payout != tt.payout {
+				t.Errorf("BlackjackSettle = %s, %d, ожидалось %s, %d", result, payout, tt.result, tt.payout)
+			}
+			if max := BlackjackMaxPayout(100, false); payout > max {
+				t.Errorf("выплата %d больше BlackjackMaxPayout %d", payout, max)
+			}
+		})
+	}
+}
+
+func TestTableBetWin(t *testing.T) {
+	pt := DefaultPaytable()
+	tests := []struct {
+		name   string
+		bet    TableBet
+		pocket int64
+		payout int64
+	}{
+		{"number", TableBet{Kind: TableNumber, Value: 17, Amount: 10}, 17, 10 * pt.Table.Number},
+		{"number miss", TableBet{Kind: TableNumber, Value: 17, Amount: 10}, 18, 0},
+		{"zero", TableBet{Kind: TableNumber, Value: 0, Amount: 10}, 0, 10 * pt.Table.Number},
+		{"red", TableBet{Kind: TableColor, Value: 2, Amount: 10}, 1, 10 * pt.Table.Color},
+		{"black on red", TableBet{Kind: TableColor, Value: 1, Amount: 10}, 1, 0},
+		{"dozen", TableBet{Kind: TableDozen, Value: 3, Amount: 10}, 25, 10 * pt.Table.Dozen},
+		{"even", TableBet{Kind: TableParity, Value: 1, Amount: 10}, 36, 10 * pt.Table.Parity},
+		{"even on zero", TableBet{Kind: TableParity, Value: 1, Amount: 10}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if payout := tt.bet.Win(pt, tt.pocket); payout != tt.payout {
+				t.Errorf("Win(%d) = %d, ожидалось %d", tt.pocket, payout, tt.payout)
+			}
+		})
+	}
+}
+
+// TestPocketColor проверяет, что /rlc и стол /table видят у каждого выпавшего числа один и тот же цвет
+func TestPocketColor(t *testing.T) {
+	counts := map[int64]int{}
+	for pocket := int64(0); pocket < tablePockets; pocket++ {
+		counts[PocketColor(pocket)]++
+	}
+	if counts[PocketRed] != 18 || counts[PocketBlack] != 18 || counts[PocketGreen] != 1 {
+		t.Errorf("на колесе %d красных, %d чёрных и %d зелёных, ожидалось 18, 18 и 1", counts[PocketRed], counts[PocketBlack], counts[PocketGreen])
+	}
+
+	pt := DefaultPaytable()
+	for _, choice := range []int64{PocketBlack, PocketRed} {
+		bet := Bet{Amount: 10, Choice: choice}
+		for nonce := int64(0); nonce < 500; nonce++ {
+			outcome := RouletteColor{}.Resolve(fair.New("server", "client", nonce), pt, bet)
+			table := TableBet{Kind: TableColor, Value: choice, Amount: 10}.Wins(outcome.Values[0])
+			if (outcome.Payout > 0) != table {
+				t.Fatalf("число %d: /rlc выиграл = %v, стол выиграл = %v", outcome.Values[0], outcome.Payout > 0, table)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package games
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Paytable - таблица выплат и настройки казино. Загружается из файла при старте и по команде администратора
+type Paytable struct {
+	Version string `json:"-"`
+
+	Slots struct {
+		Pair    int64        `json:"pair"`
+		Symbols []SlotSymbol `json:"symbols"`
+	} `json:"slots"`
+
+	RouletteNum struct {
+		Multiplier int64 `json:"multiplier"`
+	} `json:"rln"`
+
+	RouletteColor struct {
+		Multiplier      int64 `json:"multiplier"`
+		GreenMultiplier int64 `json:"green_multiplier"`
+	} `json:"rlc"`
+
+	Dice struct {
+		Multiplier int64 `json:"multiplier"`
+	} `json:"dice"`
+
+	RockPaperScissors struct {
+		Multiplier int64 `json:"multiplier"`
+	} `json:"rsp"`
+
+	// Table - множители ставок стола рулетки (/table)
+	Table struct {
+		Number int64 `json:"number"`
+		Color  int64 `json:"color"`
+		Dozen  int64 `json:"dozen"`
+		Parity int64 `json:"parity"`
+	} `json:"table"`
+}
+
+type SlotSymbol struct {
+	Symbol string `json:"symbol"`
+	Weight int    `json:"weight"`
+	Triple int64  `json:"triple"` // множитель за три одинаковых символа
+}
+
+var current atomic.Pointer[Paytable]
+
+func init() {
+	current.Store(DefaultPaytable())
+}
+
+// DefaultPaytable - исходные значения, которые были зашиты в код до появления таблицы выплат
+func DefaultPaytable() *Paytable {
+	pt := &Paytable{}
+	pt.Slots.Pair = 2
+	pt.Slots.Symbols = []SlotSymbol{
+		{Symbol: "🍒", Weight: 5, Triple: 10},
+		{Symbol: "🍋", Weight: 5, Triple: 10},
+		{Symbol: "🍉", Weight: 5, Triple: 10},
+		{Symbol: "🍇", Weight: 5, Triple: 10},
+		{Symbol: "🔔", Weight: 3, Triple: 20},
+		{Symbol: "7️⃣", Weight: 1, Triple: 100},
+	}
+	pt.RouletteNum.Multiplier = 35
+	pt.RouletteColor.Multiplier = 2
+	pt.RouletteColor.GreenMultiplier = 35
+	pt.Dice.Multiplier = 12
+	pt.RockPaperScissors.Multiplier = 3
+	pt.Table.Number = 36
+	pt.Table.Color = 2
+	pt.Table.Dozen = 3
+	pt.Table.Parity = 2
+	pt.Version, _ = pt.version()
+	return pt
+}
+
+// CurrentPaytable возвращает действующую таблицу выплат
+func CurrentPaytable() *Paytable {
+	return current.Load()
+}
+
+// SetPaytable атомарно заменяет действующую таблицу выплат
+func SetPaytable(pt *Paytable) {
+	current.Store(pt)
+}
+
+// LoadPaytable читает таблицу выплат из JSON-файла и проверяет её
+func LoadPaytable(path string) (*Paytable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePaytable(data)
+}
+
+func ParsePaytable(data []byte) (*Paytable, error) {
+	pt := &Paytable{}
+	if err := json.Unmarshal(data, pt); err != nil {
+		return nil, fmt.Errorf("ошибка разбора таблицы выплат: %w", err)
+	}
+
+	if err := pt.Validate(); err != nil {
+		return nil, err
+	}
+
+	version, err := pt.version()
+	if err != nil {
+		return nil, err
+	}
+	pt.Version = version
+
+	return pt, nil
+}
+
+// version - короткий хэш содержимого, по нему раунд связывается с таблицей, по которой был сыгран
+func (pt *Paytable) version() (string, error) {
+	data, err := json.Marshal(pt)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12], nil
+}
+
+func (pt *Paytable) Validate() error {
+	if len(pt.Slots.Symbols) < 2 {
+		return errors.New("slots: должно быть хотя бы два символа")
+	}
+	seen := make(map[string]bool, len(pt.Slots.Symbols))
+	for _, s := range pt.Slots.Symbols {
+		if s.Symbol == "" || seen[s.Symbol] {
+			return fmt.Errorf("slots: символ %q пустой или повторяется", s.Symbol)
+		}
+		if s.Weight <= 0 || s.Triple <= 0 {
+			return fmt.Errorf("slots: вес и множитель символа %s должны быть положительными", s.Symbol)
+		}
+		seen[s.Symbol] = true
+	}
+
+	multipliers := map[string]int64{
+		"slots.pair":           pt.Slots.Pair,
+		"rln.multiplier":       pt.RouletteNum.Multiplier,
+		"rlc.multiplier":       pt.RouletteColor.Multiplier,
+		"rlc.green_multiplier": pt.RouletteColor.GreenMultiplier,
+		"dice.multiplier":      pt.Dice.Multiplier,
+		"rsp.multiplier":       pt.RockPaperScissors.Multiplier,
+		"table.number":         pt.Table.Number,
+		"table.color":          pt.Table.Color,
+		"table.dozen":          pt.Table.Dozen,
+		"table.parity":         pt.Table.Parity,
+	}
+	for name, m := range multipliers {
+		if m <= 0 {
+			return fmt.Errorf("%s должен быть положительным", name)
+		}
+	}
+
+	return nil
+}
+
+// Report возвращает теоретический RTP каждой игры. Для игр, где RTP зависит от выбора игрока, выводится диапазон.
+func (pt *Paytable) Report() string {
+	report := fmt.Sprintf("Таблица выплат %s (теоретический RTP)\n", pt.Version)
+	for _, g := range All() {
+		min, max := g.RTP(pt)
+		report += rtpLine(g.Title(), min, max)
+	}
+	min, max := TableRTP(pt)
+	report += rtpLine("Стол рулетки", min, max)
+	return report
+}
+
+// Odds возвращает шанс выигрыша и RTP игры g по таблице pt для /rule и клавиатуры ставок
+func (pt *Paytable) Odds(g Game) string {
+	minChance, maxChance := ChanceRange(g, pt)
+	minRTP, maxRTP := g.RTP(pt)
+
+	odds := fmt.Sprintf("Шанс выигрыша: %.2f%%", maxChance*100)
+	if minChance != maxChance {
+		odds = fmt.Sprintf("Шанс выигрыша: от %.2f%% до %.2f%% в зависимости от выбора", minChance*100, maxChance*100)
+	}
+	if minRTP == maxRTP {
+		odds += fmt.Sprintf(", RTP %.2f%%", maxRTP*100)
+	} else {
+		odds += fmt.Sprintf(", RTP от %.2f%% до %.2f%%", minRTP*100, maxRTP*100)
+	}
+	return odds + ". Исход не зависит от баланса казино: если казино не может покрыть выигрыш, ставка не принимается"
+}
+
+func rtpLine(title string, min, max float64) string {
+	var line string
+	if min == max {
+		line = fmt.Sprintf("👉 %s: RTP %.2f%%", title, max*100)
+	} else {
+		line = fmt.Sprintf("👉 %s: RTP от %.2f%% до %.2f%%", title, min*100, max*100)
+	}
+	if max > 1 {
+		line += " ❗ выше 100%"
+	}
+	return line + "\n"
+}
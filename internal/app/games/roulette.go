@@ -0,0 +1,191 @@
+package games
+
+import (
+	"errors"
+	"fmt"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/pkg/fair"
+	"slices"
+	"strconv"
+)
+
+type RouletteNum struct{}
+
+type RouletteColor struct{}
+
+func init() {
+	Register(RouletteNum{})
+	Register(RouletteColor{})
+}
+
+func (RouletteNum) Name() string  { return "rln" }
+func (RouletteNum) Title() string { return "Рулетка по числу" }
+func (RouletteNum) Usage() string { return "/rln <число> <сумма>" }
+
+func (RouletteNum) Rules(pt *Paytable) string {
+	return "В игре 'Рулетка по числу' игрок выбирает число от 1 до 36 и ставку в зетках.\n\n\t•\t" +
+		fmt.Sprintf("Если выпавшее число совпадает с выбранным числом, игрок выигрывает и получает x%d суммы ставки. ", pt.RouletteNum.Multiplier) +
+		"В противном случае, ставка считается проигранной.\n\nПример команды: /rln 36 100"
+}
+
+func (g RouletteNum) ParseBet(args []string) (Bet, error) {
+	if len(args) != 2 {
+		return Bet{}, usageError(g)
+	}
+
+	number, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return Bet{}, usageError(g)
+	}
+	if number < 1 || number > 36 {
+		return Bet{}, errors.New(constants.ErrNegativeRln)
+	}
+
+	amount, err := ParseAmount(args[1])
+	if err != nil {
+		return Bet{}, err
+	}
+
+	return Bet{Amount: amount, Choice: number}, nil
+}
+
+func (RouletteNum) Resolve(rng *fair.RNG, pt *Paytable, bet Bet) Outcome {
+	result := int64(rng.Intn(36) + 1)
+
+	var payout int64
+	if result == bet.Choice {
+		payout = bet.Amount * pt.RouletteNum.Multiplier
+	}
+
+	return Outcome{Result: strconv.FormatInt(result, 10), Values: []int64{result}, Payout: payout}
+}
+
+func (RouletteNum) Chance(_ *Paytable, _ Bet) float64 {
+	return 1.0 / 36
+}
+
+func (RouletteNum) MaxPayout(pt *Paytable, bet Bet) int64 {
+	return bet.Amount * pt.RouletteNum.Multiplier
+}
+
+func (RouletteNum) RTP(pt *Paytable) (float64, float64) {
+	rtp := float64(pt.RouletteNum.Multiplier) / 36
+	return rtp, rtp
+}
+
+func (RouletteNum) Render(_ Bet, outcome Outcome) string {
+	return fmt.Sprintf("Выпавшее число: %d\n\n", outcome.Values[0])
+}
+
+func (RouletteColor) Name() string  { return "rlc" }
+func (RouletteColor) Title() string { return "Рулетка по цвету" }
+func (RouletteColor) Usage() string { return "/rlc <цвет(ч/к/з)> <сумма>" }
+
+func (RouletteColor) Rules(pt *Paytable) string {
+	return "В игре 'Рулетка по цвету' игрок выбирает цвет (черный, красный или зеленый) и ставку в " +
+		fmt.Sprintf("зетках. Колесо европейское, как у стола /table: числа от 0 до 36, 0 - зелёное, красные - "+
+			"1, 3, 5, 7, 9, 12, 14, 16, 18, 19, 21, 23, 25, 27, 30, 32, 34, 36, остальные - чёрные.\n\n\t•\t"+
+			"Если выпавший цвет совпадает с выбранным, игрок выигрывает и получает x%d суммы ставки "+
+			"(x%d за зеленый)", pt.RouletteColor.Multiplier, pt.RouletteColor.GreenMultiplier) +
+		"\n\t•\tВ противном случае, ставка считается проигранной.\n\nПример команды: /rlc ч 100"
+}
+
+func (g RouletteColor) ParseBet(args []string) (Bet, error) {
+	if len(args) != 2 {
+		return Bet{}, usageError(g)
+	}
+
+	var color int64
+	switch args[0] {
+	case "ч", "черный", "черное", "чёрное", "чёрный", "black":
+		color = PocketBlack
+	case "к", "кр", "красное", "красный", "red":
+		color = PocketRed
+	case "з", "зеленое", "зелёное", "зел", "green":
+		color = PocketGreen
+	default:
+		return Bet{}, usageError(g)
+	}
+
+	amount, err := ParseAmount(args[1])
+	if err != nil {
+		return Bet{}, err
+	}
+
+	return Bet{Amount: amount, Choice: color}, nil
+}
+
+// Цвета ячеек колеса, они же выбор игрока в /rlc
+const (
+	PocketBlack int64 = 1
+	PocketRed   int64 = 2
+	PocketGreen int64 = 3
+)
+
+var redPockets = []int64{1, 3, 5, 7, 9, 12, 14, 16, 18, 19, 21, 23, 25, 27, 30, 32, 34, 36}
+
+// PocketColor возвращает цвет ячейки европейского колеса: 0 - зелёное, красные - по redPockets, остальные - чёрные.
+// По нему считают и /rlc, и стол /table, поэтому одно число в чате всегда одного цвета
+func PocketColor(pocket int64) int64 {
+	switch {
+	case pocket == 0:
+		return PocketGreen
+	case slices.Contains(redPockets, pocket):
+		return PocketRed
+	default:
+		return PocketBlack
+	}
+}
+
+// PocketLabel - выпавшее число с цветом для сообщения
+func PocketLabel(pocket int64) string {
+	switch PocketColor(pocket) {
+	case PocketGreen:
+		return fmt.Sprintf("🟩%d", pocket)
+	case PocketRed:
+		return fmt.Sprintf("🟥%d", pocket)
+	default:
+		return fmt.Sprintf("⬛%d", pocket)
+	}
+}
+
+func (RouletteColor) Resolve(rng *fair.RNG, pt *Paytable, bet Bet) Outcome {
+	result := int64(rng.Intn(37))
+
+	var payout int64
+	if PocketColor(result) == bet.Choice {
+		if result == 0 { // зеленое
+			payout = bet.Amount * pt.RouletteColor.GreenMultiplier
+		} else { // черное или красное
+			payout = bet.Amount * pt.RouletteColor.Multiplier
+		}
+	}
+
+	return Outcome{Result: PocketLabel(result), Values: []int64{result}, Payout: payout}
+}
+
+// Chance: чёрное и красное - по 18 чисел из 37, зелёное - одно
+func (RouletteColor) Chance(_ *Paytable, bet Bet) float64 {
+	if bet.Choice == PocketGreen {
+		return 1.0 / 37
+	}
+	return 18.0 / 37
+}
+
+func (RouletteColor) MaxPayout(pt *Paytable, bet Bet) int64 {
+	if bet.Choice == PocketGreen {
+		return bet.Amount * pt.RouletteColor.GreenMultiplier
+	}
+	return bet.Amount * pt.RouletteColor.Multiplier
+}
+
+// RTP: выпадают числа от 0 до 36, чёрное и красное - по 18 чисел, зелёное - одно
+func (RouletteColor) RTP(pt *Paytable) (float64, float64) {
+	color := float64(pt.RouletteColor.Multiplier) * 18 / 37
+	green := float64(pt.RouletteColor.GreenMultiplier) / 37
+	return min(color, green), max(color, green)
+}
+
+func (RouletteColor) Render(_ Bet, outcome Outcome) string {
+	return fmt.Sprintf("Выпавший цвет: %s\n\n", outcome.Result)
+}
@@ -0,0 +1,81 @@
+package games
+
+import (
+	"fmt"
+	"hamsterbot/pkg/fair"
+)
+
+type RockPaperScissors struct{}
+
+func init() {
+	Register(RockPaperScissors{})
+}
+
+var rockPaperScissorsChoices = map[int64]string{
+	1: "камень",
+	2: "ножницы",
+	3: "бумага",
+}
+
+func (RockPaperScissors) Name() string  { return "rsp" }
+func (RockPaperScissors) Title() string { return "Камень-ножницы-бумага" }
+func (RockPaperScissors) Usage() string { return "/rsp <к/н/б> <сумма>" }
+
+func (RockPaperScissors) Rules(pt *Paytable) string {
+	return "В игре 'Камень-ножницы-бумага' игрок выбирает камень/ножницы/бумагу и ставку в " +
+		fmt.Sprintf("зетках.\n\n\t•\tЕсли выбор игрока совпадает с выбором компьютера, игрок выигрывает и получает x%d суммы ", pt.RockPaperScissors.Multiplier) +
+		"ставки\n\t•\tВ противном случае, ставка считается проигранной.\n\nПример команды: /rsp к 100"
+}
+
+func (g RockPaperScissors) ParseBet(args []string) (Bet, error) {
+	if len(args) != 2 {
+		return Bet{}, usageError(g)
+	}
+
+	var choice int64
+	switch args[0] {
+	case "к", "камень", "rock":
+		choice = 1
+	case "н", "ножницы", "scissors":
+		choice = 2
+	case "б", "бумага", "paper":
+		choice = 3
+	default:
+		return Bet{}, usageError(g)
+	}
+
+	amount, err := ParseAmount(args[1])
+	if err != nil {
+		return Bet{}, err
+	}
+
+	return Bet{Amount: amount, Choice: choice}, nil
+}
+
+func (RockPaperScissors) Resolve(rng *fair.RNG, pt *Paytable, bet Bet) Outcome {
+	result := int64(rng.Intn(3) + 1)
+
+	var payout int64
+	if result == bet.Choice {
+		payout = bet.Amount * pt.RockPaperScissors.Multiplier
+	}
+
+	return Outcome{Result: rockPaperScissorsChoices[result], Values: []int64{result}, Payout: payout}
+}
+
+func (RockPaperScissors) Chance(_ *Paytable, _ Bet) float64 {
+	return 1.0 / 3
+}
+
+func (RockPaperScissors) MaxPayout(pt *Paytable, bet Bet) int64 {
+	return bet.Amount * pt.RockPaperScissors.Multiplier
+}
+
+func (RockPaperScissors) RTP(pt *Paytable) (float64, float64) {
+	rtp := float64(pt.RockPaperScissors.Multiplier) / 3
+	return rtp, rtp
+}
+
+func (RockPaperScissors) Render(_ Bet, outcome Outcome) string {
+	return fmt.Sprintf("Выбор компьютера: %s\n\n", outcome.Result)
+}
@@ -0,0 +1,123 @@
+package games
+
+import (
+	"fmt"
+	"hamsterbot/pkg/fair"
+	"strings"
+)
+
+type Slots struct{}
+
+func init() {
+	Register(Slots{})
+}
+
+func (Slots) Name() string  { return "slots" }
+func (Slots) Title() string { return "Слоты" }
+func (Slots) Usage() string { return "/slots <сумма>" }
+
+func (Slots) Rules(pt *Paytable) string {
+	var triples []string
+	for _, s := range pt.Slots.Symbols {
+		triples = append(triples, fmt.Sprintf("x%d за %s", s.Triple, s.Symbol))
+	}
+
+	return "В игре 'Слоты' игрок выбирает ставку в зетках, которую он хочет сделать. " +
+		"После этого случайным образом выпадают три символа.\n\n\t•\tЕсли 2 соседних из 3 выпавших символов " +
+		fmt.Sprintf("совпадают, игрок получает x%d суммы ставки.\n\t•\tЕсли 3 выпавших символа сопадают, то ", pt.Slots.Pair) +
+		"игрок получает " + strings.Join(triples, ", ") + " суммы ставки.\n\t•\tЕсли совпадений " +
+		"нет, то ставка считается проигранной.\n\nПример команды: /slots 100"
+}
+
+func (g Slots) ParseBet(args []string) (Bet, error) {
+	if len(args) != 1 {
+		return Bet{}, usageError(g)
+	}
+
+	amount, err := ParseAmount(args[0])
+	if err != nil {
+		return Bet{}, err
+	}
+
+	return Bet{Amount: amount}, nil
+}
+
+// slotSymbol выбирает символ с учётом весов
+func slotSymbol(rng *fair.RNG, pt *Paytable) SlotSymbol {
+	var total int
+	for _, s := range pt.Slots.Symbols {
+		total += s.Weight
+	}
+
+	n := rng.Intn(total)
+	for _, s := range pt.Slots.Symbols {
+		if n < s.Weight {
+			return s
+		}
+		n -= s.Weight
+	}
+	return pt.Slots.Symbols[len(pt.Slots.Symbols)-1]
+}
+
+func (Slots) Resolve(rng *fair.RNG, pt *Paytable, bet Bet) Outcome {
+	result := []SlotSymbol{slotSymbol(rng, pt), slotSymbol(rng, pt), slotSymbol(rng, pt)}
+
+	var payout int64
+	if result[0] == result[1] || result[1] == result[2] {
+		payout = bet.Amount * pt.Slots.Pair
+
+		if result[0] == result[1] && result[1] == result[2] {
+			payout = bet.Amount * result[0].Triple
+		}
+	}
+
+	symbols := []string{result[0].Symbol, result[1].Symbol, result[2].Symbol}
+	return Outcome{Result: strings.Join(symbols, " | "), Payout: payout}
+}
+
+// Chance: пара соседних символов выпадает с вероятностью 2Σp² - Σp³, тройка входит в обе пары
+func (Slots) Chance(pt *Paytable, _ Bet) float64 {
+	var total int
+	for _, s := range pt.Slots.Symbols {
+		total += s.Weight
+	}
+
+	var squares, cubes float64
+	for _, s := range pt.Slots.Symbols {
+		p := float64(s.Weight) / float64(total)
+		squares += p * p
+		cubes += p * p * p
+	}
+	return 2*squares - cubes
+}
+
+func (Slots) MaxPayout(pt *Paytable, bet Bet) int64 {
+	multiplier := pt.Slots.Pair
+	for _, s := range pt.Slots.Symbols {
+		multiplier = max(multiplier, s.Triple)
+	}
+	return bet.Amount * multiplier
+}
+
+func (Slots) RTP(pt *Paytable) (float64, float64) {
+	var total int
+	for _, s := range pt.Slots.Symbols {
+		total += s.Weight
+	}
+
+	// P(r0 == r1) = P(r1 == r2) = Σp², P(тройка) = Σp³, пара без тройки выпадает с вероятностью 2Σp² - 2Σp³
+	var squares, cubes, triples float64
+	for _, s := range pt.Slots.Symbols {
+		p := float64(s.Weight) / float64(total)
+		squares += p * p
+		cubes += p * p * p
+		triples += p * p * p * float64(s.Triple)
+	}
+
+	rtp := (2*squares-2*cubes)*float64(pt.Slots.Pair) + triples
+	return rtp, rtp
+}
+
+func (Slots) Render(_ Bet, outcome Outcome) string {
+	return fmt.Sprintf("%s\n\n", outcome.Result)
+}
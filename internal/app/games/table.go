@@ -0,0 +1,176 @@
+package games
+
+import (
+	"errors"
+	"fmt"
+	"hamsterbot/pkg/fair"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Стол рулетки - общий раунд чата: ставки принимаются от всех, пока раунд открыт,
+// и разыгрываются одним вращением. Колесо европейское: числа от 0 до 36, 0 - зелёное
+
+// Виды ставок стола
+const (
+	TableNumber = "num"    // число от 0 до 36
+	TableColor  = "color"  // PocketBlack или PocketRed
+	TableDozen  = "dozen"  // 1 - 1-12, 2 - 13-24, 3 - 25-36
+	TableParity = "parity" // 1 - чётное, 2 - нечётное
+)
+
+const tablePockets = 37
+
+type TableBet struct {
+	Kind   string `json:"kind"`
+	Value  int64  `json:"value"`
+	Amount int64  `json:"amount"`
+}
+
+// TableEntry - ставка игрока на столе. Payout заполняется после вращения
+type TableEntry struct {
+	TableBet
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Payout   int64  `json:"-"`
+}
+
+func TableUsage() string {
+	return "/bet <ставка> <сумма> [<ставка> <сумма> ...], ставка - число 0-36, ч/к, 1-12/13-24/25-36, чет/нечет"
+}
+
+// ParseTableBets разбирает аргументы /bet: пары из ставки и суммы
+func ParseTableBets(args []string) ([]TableBet, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errors.New("неверный формат команды. Пожалуйста, используйте: " + TableUsage())
+	}
+
+	bets := make([]TableBet, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		bet, err := parseTableBet(args[i])
+		if err != nil {
+			return nil, err
+		}
+
+		bet.Amount, err = ParseAmount(args[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		bets = append(bets, bet)
+	}
+
+	return bets, nil
+}
+
+func parseTableBet(s string) (TableBet, error) {
+	switch strings.ToLower(s) {
+	case "ч", "черное", "чёрное", "черный", "чёрный", "black":
+		return TableBet{Kind: TableColor, Value: PocketBlack}, nil
+	case "к", "кр", "красное", "красный", "red":
+		return TableBet{Kind: TableColor, Value: PocketRed}, nil
+	case "1-12", "д1":
+		return TableBet{Kind: TableDozen, Value: 1}, nil
+	case "13-24", "д2":
+		return TableBet{Kind: TableDozen, Value: 2}, nil
+	case "25-36", "д3":
+		return TableBet{Kind: TableDozen, Value: 3}, nil
+	case "чет", "чёт", "even":
+		return TableBet{Kind: TableParity, Value: 1}, nil
+	case "нечет", "нечёт", "odd":
+		return TableBet{Kind: TableParity, Value: 2}, nil
+	}
+
+	number, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return TableBet{}, fmt.Errorf("неизвестная ставка %s. Пожалуйста, используйте: %s", s, TableUsage())
+	}
+	if number < 0 || number >= tablePockets {
+		return TableBet{}, errors.New("число должно находиться в диапазоне от 0 до 36")
+	}
+
+	return TableBet{Kind: TableNumber, Value: number}, nil
+}
+
+// SpinTable вращает колесо стола на генераторе rng
+func SpinTable(rng *fair.RNG) int64 {
+	return int64(rng.Intn(tablePockets))
+}
+
+// Multiplier возвращает множитель выплаты ставки по таблице pt (выплата с учётом ставки)
+func (b TableBet) Multiplier(pt *Paytable) int64 {
+	switch b.Kind {
+	case TableNumber:
+		return pt.Table.Number
+	case TableColor:
+		return pt.Table.Color
+	case TableDozen:
+		return pt.Table.Dozen
+	case TableParity:
+		return pt.Table.Parity
+	default:
+		return 0
+	}
+}
+
+// Wins проверяет, сыграла ли ставка при выпавшем числе pocket. Зеро проигрывают все ставки, кроме ставки на 0
+func (b TableBet) Wins(pocket int64) bool {
+	if b.Kind == TableNumber {
+		return b.Value == pocket
+	}
+	if pocket == 0 {
+		return false
+	}
+
+	switch b.Kind {
+	case TableColor:
+		return PocketColor(pocket) == b.Value
+	case TableDozen:
+		return (pocket-1)/12+1 == b.Value
+	case TableParity:
+		return (b.Value == 1) == (pocket%2 == 0)
+	default:
+		return false
+	}
+}
+
+// Win возвращает выплату ставки с учётом самой ставки, 0 при проигрыше
+func (b TableBet) Win(pt *Paytable, pocket int64) int64 {
+	if !b.Wins(pocket) {
+		return 0
+	}
+	return b.Amount * b.Multiplier(pt)
+}
+
+func (b TableBet) Label() string {
+	switch b.Kind {
+	case TableNumber:
+		return strconv.FormatInt(b.Value, 10)
+	case TableColor:
+		if b.Value == PocketRed {
+			return "🟥 красное"
+		}
+		return "⬛ чёрное"
+	case TableDozen:
+		return fmt.Sprintf("%d-%d", (b.Value-1)*12+1, b.Value*12)
+	case TableParity:
+		if b.Value == 1 {
+			return "чёт"
+		}
+		return "нечет"
+	default:
+		return b.Kind
+	}
+}
+
+// TableRTP возвращает теоретический возврат игроку по ставкам стола: минимум и максимум по виду ставки
+func TableRTP(pt *Paytable) (float64, float64) {
+	rtps := []float64{
+		float64(pt.Table.Number) / tablePockets,
+		float64(pt.Table.Color) * 18 / tablePockets,
+		float64(pt.Table.Dozen) * 12 / tablePockets,
+		float64(pt.Table.Parity) * 18 / tablePockets,
+	}
+	return slices.Min(rtps), slices.Max(rtps)
+}
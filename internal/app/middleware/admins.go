@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	tele "gopkg.in/telebot.v3"
+)
+
+type Admin interface {
+	HasPermission(userID int64, permission string) bool
+}
+
+// Require пропускает к обработчику только пользователей с правом permission,
+// остальным команда молча игнорируется
+func (e *Endpoint) Require(permission string) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			if !e.Admin.HasPermission(c.Sender().ID, permission) {
+				return nil
+			}
+
+			return next(c)
+		}
+	}
+}
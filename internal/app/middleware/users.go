@@ -3,19 +3,27 @@ package middleware
 import (
 	"go.uber.org/zap"
 	tele "gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
 	"hamsterbot/internal/app/models"
 	"hamsterbot/pkg/logger"
 	"strings"
 )
 
 type User interface {
-	GetUserById(id int64) (map[string]interface{}, error)
-	AddUser(id int64, username string) error
+	GetUserById(chatID, id int64) (models.User, error)
+	AddUser(chatID, id int64, username string) error
+	Touch(chatID, id int64) error
+}
+
+type Chat interface {
+	GetChat(chatID int64, title string) (models.Chat, error)
 }
 
 type Endpoint struct {
-	Bot  *tele.Bot
-	User User
+	Bot   *tele.Bot
+	User  User
+	Chat  Chat
+	Admin Admin
 }
 
 func (e *Endpoint) IsUser(next tele.HandlerFunc) tele.HandlerFunc {
@@ -29,9 +37,20 @@ func (e *Endpoint) IsUser(next tele.HandlerFunc) tele.HandlerFunc {
 		//	return nil
 		//}
 
-		data, err := e.User.GetUserById(c.Sender().ID)
+		// экономика у каждого чата своя, поэтому сначала регистрируем чат, затем пользователя в нём
+		_, err := e.Chat.GetChat(c.Chat().ID, c.Chat().Title)
+		if err != nil {
+			logger.Error("ошибка регистрации чата", zap.Error(err))
+			return err
+		}
+
+		if err := e.User.Touch(c.Chat().ID, c.Sender().ID); err != nil {
+			logger.Warn("не удалось отметить активность пользователя", zap.Int64("id", c.Sender().ID), zap.Error(err))
+		}
+
+		data, err := e.User.GetUserById(c.Chat().ID, c.Sender().ID)
 		if err != nil {
-			err := e.User.AddUser(c.Sender().ID, c.Sender().Username)
+			err := e.User.AddUser(c.Chat().ID, c.Sender().ID, c.Sender().Username)
 			if err != nil {
 				logger.Error("ошибка добавления юзера", zap.Error(err))
 				return err
@@ -40,7 +59,17 @@ func (e *Endpoint) IsUser(next tele.HandlerFunc) tele.HandlerFunc {
 			return next(c)
 		}
 
-		if data["mute"].(models.Mute) != (models.Mute{}) || data["selfmute"].(models.Mute) != (models.Mute{}) {
+		// ограничение прав не мешает нажимать inline-кнопки, поэтому в муте они не работают вовсе
+		if c.Callback() != nil {
+			if data.Mute != (models.Mute{}) || data.SelfMute != (models.Mute{}) {
+				return c.Respond(&tele.CallbackResponse{Text: "Вы в муте.", ShowAlert: true})
+			}
+			return next(c)
+		}
+
+		// мут, применённый ограничением прав, Telegram соблюдает сам, удаляем сообщения
+		// только если бот не смог ограничить пользователя в этом чате
+		if deleteMuted(data.Mute, c.Chat()) || deleteMuted(data.SelfMute, c.Chat()) {
 			err := e.Bot.Delete(c.Message())
 			if err != nil {
 				return err
@@ -57,3 +86,10 @@ func (e *Endpoint) IsUser(next tele.HandlerFunc) tele.HandlerFunc {
 		return next(c)
 	}
 }
+
+func deleteMuted(mute models.Mute, chat *tele.Chat) bool {
+	if mute == (models.Mute{}) {
+		return false
+	}
+	return mute.Mode != constants.MuteModeRestrict || chat == nil || mute.ChatID != chat.ID
+}
@@ -1,8 +1,206 @@
 package models
 
+import (
+	"fmt"
+	"time"
+)
+
+// User - счёт пользователя в чате вместе с действующими мутами
+type User struct {
+	ID       int64  `db:"id"`
+	ChatID   int64  `db:"chat_id"`
+	Username string `db:"username"`
+	Balance  int64  `db:"balance"`
+	Lvl      int64  `db:"lvl"`
+	Income   int64  `db:"income"`
+	Version  int64  `db:"version"` // растёт при каждом изменении баланса, уровня или дохода
+	Mute     Mute   `db:"-"`
+	SelfMute Mute   `db:"-"`
+}
+
+// UserTouch - сообщение пользователя в чате, по которому обновляется время его последней активности
+type UserTouch struct {
+	ChatID int64     `json:"chat_id"`
+	ID     int64     `json:"id"`
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// BankBalance - сводка по деньгам чата: счёт казино, банковские счета пользователей и чистая эмиссия
+type BankBalance struct {
+	Casino  int64
+	Users   int64
+	Emitted int64
+}
+
+// Upgrade - следующее улучшение в магазине: уровень, его цена и доход после покупки
+type Upgrade struct {
+	Lvl    int64
+	Price  int64
+	Bonus  int64
+	Income int64
+}
+
+// Duel - дуэль двух игроков. Ставки хранятся на счёте constants.EscrowID до розыгрыша,
+// серверный сид публикуется хэшем при вызове и раскрывается вместе с результатом
+type Duel struct {
+	ID             int64     `db:"id"`
+	ChatID         int64     `db:"chat_id"`
+	ChallengerID   int64     `db:"challenger_id"`
+	ChallengerName string    `db:"challenger_name"`
+	OpponentID     int64     `db:"opponent_id"`
+	OpponentName   string    `db:"opponent_name"`
+	Amount         int64     `db:"amount"`
+	Status         string    `db:"status"`
+	ServerSeed     string    `db:"server_seed"`
+	ServerSeedHash string    `db:"server_seed_hash"`
+	ClientSeed     string    `db:"client_seed"`
+	WinnerID       *int64    `db:"winner_id"`
+	Result         string    `db:"result"`
+	MessageID      int64     `db:"message_id"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+	ExpiresAt      time.Time `db:"expires_at"`
+}
+
+// TableRound - открытый раунд стола рулетки в чате. Хранится в Redis хэшем, EndsAt - unix-время вращения
+type TableRound struct {
+	ID             int64  `redis:"id"`
+	ChatID         int64  `redis:"chat_id"`
+	OpenedBy       int64  `redis:"opened_by"`
+	OpenedName     string `redis:"opened_name"`
+	ServerSeed     string `redis:"server_seed"`
+	ServerSeedHash string `redis:"server_seed_hash"`
+	ClientSeed     string `redis:"client_seed"`
+	EndsAt         int64  `redis:"ends_at"`
+	MessageID      int64  `redis:"message_id"`
+	Paytable       string `redis:"paytable"` // версия таблицы выплат, по которой принимаются ставки и считаются выигрыши
+	Pocket         int64  `redis:"-"`
+}
+
+// BlackjackHand - раздача блэкджека. Пока она идёт, хранится в Redis JSON-строкой, ExpiresAt - unix-время автоматического stand
+type BlackjackHand struct {
+	ID        int64  `json:"id"`
+	ChatID    int64  `json:"chat_id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Bet       int64  `json:"bet"`
+	Player    []int  `json:"player"`
+	Dealer    []int  `json:"dealer"`
+	Doubled   bool   `json:"doubled"`
+	Staked    bool   `json:"staked"`           // ставка списана, по раздаче можно ходить
+	Voided    bool   `json:"voided,omitempty"` // раздача без ставки закрывается, ставка возвращается, если успела списаться
+	ExpiresAt int64  `json:"expires_at"`
+	MessageID int64  `json:"message_id"`
+	Result    string `json:"result,omitempty"` // исход завершённой раздачи, пусто, пока раздача идёт
+	Payout    int64  `json:"payout,omitempty"`
+	SettledAt int64  `json:"settled_at,omitempty"` // unix-время исхода, от него считается срок повторов выплаты
+	Balance   int64  `json:"-"`
+}
+
+// Deposit - вклад пользователя. Деньги вкладов лежат на счёте constants.DepositsID, Rate - дневная ставка
+// в сотых долях процента, TermDays 0 - вклад до востребования. Проценты начислены по AccruedAt
+type Deposit struct {
+	ID        int64      `db:"id"`
+	ChatID    int64      `db:"chat_id"`
+	UserID    int64      `db:"user_id"`
+	Balance   int64      `db:"balance"`
+	Rate      int64      `db:"rate"`
+	TermDays  int64      `db:"term_days"`
+	MaturesAt *time.Time `db:"matures_at"`
+	Status    string     `db:"status"`
+	AccruedAt time.Time  `db:"accrued_at"`
+	CreatedAt time.Time  `db:"created_at"`
+	ClosedAt  *time.Time `db:"closed_at"`
+}
+
+// Loan - кредит пользователя от казино. Debt - остаток долга с процентами, Rate - дневная ставка
+// в сотых долях процента, проценты начислены по AccruedAt. Collateral - залог, он лежит на счёте
+// constants.EscrowID, пока кредит в срок
+type Loan struct {
+	ID         int64      `db:"id"`
+	ChatID     int64      `db:"chat_id"`
+	UserID     int64      `db:"user_id"`
+	Principal  int64      `db:"principal"`
+	Debt       int64      `db:"debt"`
+	Collateral int64      `db:"collateral"`
+	Rate       int64      `db:"rate"`
+	Status     string     `db:"status"`
+	AccruedAt  time.Time  `db:"accrued_at"`
+	DueAt      time.Time  `db:"due_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	RepaidAt   *time.Time `db:"repaid_at"`
+}
+
+// Chat - настройки экономики отдельного чата
+type Chat struct {
+	ChatID        int64     `db:"chat_id" json:"chat_id"`
+	Title         string    `db:"title" json:"title"`
+	StartBalance  int64     `db:"start_balance" json:"start_balance"`
+	StartIncome   int64     `db:"start_income" json:"start_income"`
+	CasinoBalance int64     `db:"casino_balance" json:"casino_balance"`
+	IncomeEnabled bool      `db:"income_enabled" json:"income_enabled"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// Admin - роль пользователя в администрации бота
+type Admin struct {
+	UserID    int64     `db:"user_id"`
+	Username  string    `db:"username"`
+	Role      string    `db:"role"`
+	GrantedBy int64     `db:"granted_by"`
+	GrantedAt time.Time `db:"granted_at"`
+}
+
+// AdminAction - запись журнала назначения и снятия ролей
+type AdminAction struct {
+	ID        int64     `db:"id"`
+	ActorID   int64     `db:"actor_id"`
+	Action    string    `db:"action"`
+	TargetID  int64     `db:"target_id"`
+	Role      string    `db:"role"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// MuteTimeLayout - формат поля StartMute, совпадает с выводом fmt.Sprint(time.Time)
+const MuteTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
 type Mute struct {
 	StartMute string `json:"start_mute"`
 	Duration  int64  `json:"duration"`
+	ChatID    int64  `json:"chat_id,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+}
+
+func NewMute(start time.Time, duration time.Duration) Mute {
+	return Mute{
+		StartMute: fmt.Sprint(start.UTC()),
+		Duration:  int64(duration),
+	}
+}
+
+// End возвращает время окончания мута
+func (m Mute) End() (time.Time, error) {
+	start, err := time.Parse(MuteTimeLayout, m.StartMute)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.Add(time.Duration(m.Duration)), nil
+}
+
+// MuteRecord - запись о муте в таблице mutes
+type MuteRecord struct {
+	ID          int64      `db:"id"`
+	Kind        string     `db:"kind"`
+	IssuerID    int64      `db:"issuer_id"`
+	TargetID    int64      `db:"target_id"`
+	ChatID      int64      `db:"chat_id"`
+	StartAt     time.Time  `db:"start_at"`
+	EndAt       time.Time  `db:"end_at"`
+	Price       int64      `db:"price"`
+	Mode        string     `db:"mode"`
+	UnmutedAt   *time.Time `db:"unmuted_at"`
+	UnmutedBy   *int64     `db:"unmuted_by"`
+	UnmutePrice *int64     `db:"unmute_price"`
 }
 
 type Payments struct {
@@ -14,7 +212,49 @@ type Payment struct {
 	Amount int   `json:"amount"`
 }
 
+// UserTop - строка топа: место пользователя (с 1) и значение показателя
 type UserTop struct {
+	Rank     int64
+	ID       int64
 	Username string
 	Value    int64
 }
+
+type Transaction struct {
+	ID           int64     `db:"id"`
+	From         int64     `db:"from_id"`
+	To           int64     `db:"to_id"`
+	FromUsername string    `db:"from_username"`
+	ToUsername   string    `db:"to_username"`
+	Amount       int64     `db:"amount"`
+	Kind         string    `db:"kind"`
+	ChatID       int64     `db:"chat_id"`
+	Reference    string    `db:"reference"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+type Seed struct {
+	ID             int64      `db:"id"`
+	UserID         int64      `db:"user_id"`
+	ServerSeed     string     `db:"server_seed"`
+	ServerSeedHash string     `db:"server_seed_hash"`
+	ClientSeed     string     `db:"client_seed"`
+	Nonce          int64      `db:"nonce"`
+	Active         bool       `db:"active"`
+	CreatedAt      time.Time  `db:"created_at"`
+	RevealedAt     *time.Time `db:"revealed_at"`
+}
+
+type Round struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	SeedID    int64     `db:"seed_id"`
+	Nonce     int64     `db:"nonce"`
+	Game      string    `db:"game"`
+	Bet       string    `db:"bet"`
+	Amount    int64     `db:"amount"`
+	Payout    int64     `db:"payout"`
+	Result    string    `db:"result"`
+	Paytable  string    `db:"paytable"`
+	CreatedAt time.Time `db:"created_at"`
+}
@@ -0,0 +1,229 @@
+package admins
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"slices"
+)
+
+// noRole кэшируется для пользователей без роли, чтобы не ходить в базу на каждую команду
+const noRole = "-"
+
+type Service struct{}
+
+func New() *Service {
+	return &Service{}
+}
+
+// EnsureOwner назначает владельца бота из конфигурации, если у него ещё нет этой роли
+func (s Service) EnsureOwner(ownerID int64) error {
+	err := s.withLog(ownerID, "add", ownerID, constants.RoleOwner, func(tx *sqlx.Tx) (bool, error) {
+		res, err := tx.Exec(`INSERT INTO admins (user_id, role, granted_by) VALUES ($1, $2, $1)
+			ON CONFLICT (user_id) DO UPDATE SET role = EXCLUDED.role WHERE admins.role <> EXCLUDED.role`, ownerID, constants.RoleOwner)
+		if err != nil {
+			logger.Error("ошибка при назначении владельца бота", zap.Error(err))
+			return false, err
+		}
+		granted, _ := res.RowsAffected()
+		return granted > 0, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return cache.Rdb.Del(cache.Ctx, roleKey(ownerID)).Err()
+}
+
+// GetRole возвращает роль пользователя или пустую строку, если роли нет
+func (s Service) GetRole(userID int64) (string, error) {
+	role, err := cache.Rdb.Get(cache.Ctx, roleKey(userID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+	if err == nil {
+		if role == noRole {
+			return "", nil
+		}
+		return role, nil
+	}
+
+	err = db.Conn.QueryRowx(`SELECT role FROM admins WHERE user_id = $1`, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		role = noRole
+	} else if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы admins", zap.Error(err))
+		return "", err
+	}
+
+	err = cache.Rdb.Set(cache.Ctx, roleKey(userID), role, 0).Err()
+	if err != nil {
+		logger.Error("ошибка при записи роли в кэш", zap.Error(err))
+	}
+
+	if role == noRole {
+		return "", nil
+	}
+	return role, nil
+}
+
+// HasPermission проверяет, есть ли у роли пользователя право permission. Ошибка чтения роли считается отказом
+func (s Service) HasPermission(userID int64, permission string) bool {
+	role, err := s.GetRole(userID)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(constants.RolePermissions[role], permission)
+}
+
+// Add назначает пользователю targetID роль role. Назначать можно только роли младше своей
+// (владелец может передать и роль владельца), а менять роль - только тем, у кого она тоже младше
+func (s Service) Add(actorID, targetID int64, role string) error {
+	if _, ok := constants.RoleRanks[role]; !ok {
+		return fmt.Errorf("неизвестная роль %s (owner/admin/moderator)", role)
+	}
+
+	err := s.checkRank(actorID, targetID, role)
+	if err != nil {
+		return err
+	}
+
+	err = s.withLog(actorID, "add", targetID, role, func(tx *sqlx.Tx) (bool, error) {
+		_, err := tx.Exec(`INSERT INTO admins (user_id, role, granted_by) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO UPDATE SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by, granted_at = now()`,
+			targetID, role, actorID)
+		if err != nil {
+			logger.Error("ошибка при добавлении записи в таблицу admins", zap.Error(err))
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return cache.Rdb.Set(cache.Ctx, roleKey(targetID), role, 0).Err()
+}
+
+// Remove снимает роль с пользователя targetID
+func (s Service) Remove(actorID, targetID int64) error {
+	role, err := s.GetRole(targetID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return errors.New("у пользователя нет роли")
+	}
+
+	err = s.checkRank(actorID, targetID, role)
+	if err != nil {
+		return err
+	}
+
+	err = s.withLog(actorID, "remove", targetID, role, func(tx *sqlx.Tx) (bool, error) {
+		_, err := tx.Exec(`DELETE FROM admins WHERE user_id = $1`, targetID)
+		if err != nil {
+			logger.Error("ошибка при удалении записи из таблицы admins", zap.Error(err))
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return cache.Rdb.Set(cache.Ctx, roleKey(targetID), noRole, 0).Err()
+}
+
+// List возвращает всех пользователей с ролями, начиная со старших
+func (s Service) List() ([]models.Admin, error) {
+	var admins []models.Admin
+	query := `SELECT a.user_id, COALESCE(u.username, '') AS username, a.role, a.granted_by, a.granted_at
+FROM admins a
+LEFT JOIN LATERAL (SELECT username FROM users WHERE id = a.user_id LIMIT 1) u ON TRUE
+ORDER BY CASE a.role WHEN $1 THEN 0 WHEN $2 THEN 1 ELSE 2 END, a.granted_at`
+	err := db.Conn.Select(&admins, query, constants.RoleOwner, constants.RoleAdmin)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы admins", zap.Error(err))
+		return nil, err
+	}
+
+	return admins, nil
+}
+
+// GetLog возвращает последние записи журнала ролей
+func (s Service) GetLog(limit int) ([]models.AdminAction, error) {
+	var actions []models.AdminAction
+	err := db.Conn.Select(&actions, `SELECT * FROM admin_log ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы admin_log", zap.Error(err))
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+func (s Service) checkRank(actorID, targetID int64, role string) error {
+	if actorID == targetID {
+		return errors.New("нельзя менять собственную роль")
+	}
+
+	actorRole, err := s.GetRole(actorID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(constants.RolePermissions[actorRole], constants.PermRoles) {
+		return errors.New("недостаточно прав")
+	}
+
+	targetRole, err := s.GetRole(targetID)
+	if err != nil {
+		return err
+	}
+
+	actorRank, rank := constants.RoleRanks[actorRole], constants.RoleRanks[role]
+	if rank > actorRank || (rank == actorRank && actorRole != constants.RoleOwner) || constants.RoleRanks[targetRole] >= actorRank {
+		return errors.New("можно управлять только ролями младше своей")
+	}
+
+	return nil
+}
+
+// withLog меняет роли через change и в той же транзакции записывает действие в журнал admin_log,
+// если change сообщила, что роль изменилась
+func (s Service) withLog(actorID int64, action string, targetID int64, role string, change func(tx *sqlx.Tx) (bool, error)) error {
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	changed, err := change(tx)
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		_, err = tx.Exec(`INSERT INTO admin_log (actor_id, action, target_id, role) VALUES ($1, $2, $3, $4)`,
+			actorID, action, targetID, role)
+		if err != nil {
+			logger.Error("ошибка при добавлении записи в таблицу admin_log", zap.Error(err))
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func roleKey(userID int64) string {
+	return fmt.Sprintf("admin:%d:role", userID)
+}
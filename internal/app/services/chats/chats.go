@@ -0,0 +1,127 @@
+package chats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+)
+
+// Settings - настройки чата, которые можно менять командой /settings, и соответствующие им столбцы таблицы chats
+var Settings = map[string]string{
+	"start_balance": "start_balance",
+	"start_income":  "start_income",
+	"income":        "income_enabled",
+}
+
+type Service struct{}
+
+func New() *Service {
+	return &Service{}
+}
+
+// GetChat возвращает настройки чата. Чат, в котором бот ещё не был, регистрируется
+// с настройками по умолчанию, и в нём открываются счёт казино со стартовым балансом, счёт дуэлей и счёт вкладов
+func (s Service) GetChat(chatID int64, title string) (models.Chat, error) {
+	var chat models.Chat
+
+	cacheValue, err := cache.Rdb.Get(cache.Ctx, chatKey(chatID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return chat, err
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(cacheValue), &chat)
+		return chat, err
+	}
+
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return chat, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO chats (chat_id, title) VALUES ($1, $2)
+		ON CONFLICT (chat_id) DO UPDATE SET title = CASE WHEN EXCLUDED.title = '' THEN chats.title ELSE EXCLUDED.title END
+		RETURNING chat_id, title, start_balance, start_income, casino_balance, income_enabled, created_at`
+	err = tx.QueryRowx(query, chatID, title).StructScan(&chat)
+	if err != nil {
+		logger.Error("ошибка при добавлении записи в таблицу chats", zap.Error(err))
+		return chat, err
+	}
+
+	// стартовый баланс казино выпускается служебным счётом и попадает в журнал операций
+	res, err := tx.Exec(`INSERT INTO users (chat_id, id, username, balance, lvl, income) VALUES ($1, $2, 'bank', $3, 0, 0)
+		ON CONFLICT (chat_id, id) DO NOTHING`, chatID, constants.CasinoID, chat.CasinoBalance)
+	if err != nil {
+		logger.Error("ошибка при открытии счёта казино", zap.Error(err))
+		return chat, err
+	}
+	if opened, _ := res.RowsAffected(); opened > 0 {
+		_, err = tx.Exec(`INSERT INTO transactions (from_id, to_id, amount, kind, chat_id) VALUES ($1, $2, $3, $4, $5)`,
+			constants.SystemID, constants.CasinoID, chat.CasinoBalance, constants.TxCasino, chatID)
+		if err != nil {
+			logger.Error("ошибка при записи операции в таблицу transactions", zap.Error(err))
+			return chat, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO users (chat_id, id, username, balance, lvl, income) VALUES ($1, $2, 'escrow', 0, 0, 0), ($1, $3, 'deposits', 0, 0, 0)
+		ON CONFLICT (chat_id, id) DO NOTHING`, chatID, constants.EscrowID, constants.DepositsID)
+	if err != nil {
+		logger.Error("ошибка при открытии служебных счетов", zap.Error(err))
+		return chat, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return chat, err
+	}
+
+	return chat, s.setCachedChat(chat)
+}
+
+// SetSetting меняет одну из настроек Settings. Для income значение 0 отключает почасовой доход, любое другое включает
+func (s Service) SetSetting(chatID int64, name string, value int64) (models.Chat, error) {
+	var chat models.Chat
+
+	column, ok := Settings[name]
+	if !ok {
+		return chat, fmt.Errorf("неизвестная настройка %s", name)
+	}
+	if value < 0 {
+		return chat, errors.New(constants.ErrNegativeAmount)
+	}
+
+	var arg interface{} = value
+	if column == "income_enabled" {
+		arg = value != 0
+	}
+
+	query := fmt.Sprintf(`UPDATE chats SET %s = $2 WHERE chat_id = $1
+		RETURNING chat_id, title, start_balance, start_income, casino_balance, income_enabled, created_at`, column)
+	err := db.Conn.QueryRowx(query, chatID, arg).StructScan(&chat)
+	if err != nil {
+		logger.Error("ошибка при обновлении записи в таблице chats", zap.Error(err))
+		return chat, err
+	}
+
+	return chat, s.setCachedChat(chat)
+}
+
+func (s Service) setCachedChat(chat models.Chat) error {
+	jsonChat, err := json.Marshal(chat)
+	if err != nil {
+		return err
+	}
+
+	return cache.Rdb.Set(cache.Ctx, chatKey(chat.ChatID), jsonChat, 0).Err()
+}
+
+func chatKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:settings", chatID)
+}
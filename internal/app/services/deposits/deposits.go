@@ -0,0 +1,278 @@
+package deposits
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"time"
+)
+
+// Деньги вкладов лежат на счёте constants.DepositsID, а в таблице deposits записано, сколько из них принадлежит
+// каждому вкладу. Вклад меняется в той же транзакции, что и перевод по журналу, поэтому баланс DepositsID
+// всегда равен сумме балансов вкладов. Все переводы вклада идут с reference "deposit #<id>"
+
+const depositColumns = `id, chat_id, user_id, balance, rate, term_days, matures_at, status, accrued_at, created_at, closed_at`
+
+type User interface {
+	TransferWith(t models.Transaction, fn func(tx *sqlx.Tx) error) (int64, int64, error)
+	TransferBatch(ts []models.Transaction, fn func(tx *sqlx.Tx) error) (map[int64]int64, error)
+}
+
+type Service struct {
+	User User
+}
+
+func New(User User) *Service {
+	return &Service{
+		User: User,
+	}
+}
+
+// GetDeposits возвращает открытые вклады пользователя
+func (s Service) GetDeposits(chatID, userID int64) ([]models.Deposit, error) {
+	var deposits []models.Deposit
+	query := `SELECT ` + depositColumns + ` FROM deposits WHERE chat_id = $1 AND user_id = $2 AND status = $3 ORDER BY id`
+	err := db.Conn.Select(&deposits, query, chatID, userID, constants.DepositOpen)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы deposits", zap.Error(err))
+		return nil, err
+	}
+	return deposits, nil
+}
+
+// Open открывает вклад на amount. termDays 0 - вклад до востребования, иначе срочный вклад на termDays дней
+func (s Service) Open(chatID, userID, amount, termDays int64) (models.Deposit, int64, error) {
+	if amount < constants.DepositMinAmount {
+		return models.Deposit{}, 0, fmt.Errorf("сумма вклада не может быть меньше %d зеток", constants.DepositMinAmount)
+	}
+
+	rate := int64(constants.DepositDemandRate)
+	var maturesAt *time.Time
+	if termDays != 0 {
+		var ok bool
+		rate, ok = constants.DepositTermRates[termDays]
+		if !ok {
+			return models.Deposit{}, 0, errors.New("такого срока вклада нет, посмотрите доступные сроки в /bank")
+		}
+		matures := time.Now().Add(time.Duration(termDays) * 24 * time.Hour)
+		maturesAt = &matures
+	}
+
+	var id int64
+	err := db.Conn.QueryRowx(`SELECT nextval('deposits_id_seq')`).Scan(&id)
+	if err != nil {
+		logger.Error("ошибка при получении номера вклада", zap.Error(err))
+		return models.Deposit{}, 0, err
+	}
+
+	// перевод блокирует строку пользователя, поэтому параллельные Open одного пользователя считают вклады
+	// по очереди и не превышают DepositMaxOpen
+	var deposit models.Deposit
+	balance, _, err := s.User.TransferWith(transaction(chatID, userID, constants.DepositsID, amount, constants.TxBank, id), func(tx *sqlx.Tx) error {
+		query := `INSERT INTO deposits (id, chat_id, user_id, balance, rate, term_days, matures_at)
+			SELECT $1, $2, $3, $4, $5, $6, $7
+			WHERE (SELECT COUNT(*) FROM deposits WHERE chat_id = $2 AND user_id = $3 AND status = $8) < $9
+			RETURNING ` + depositColumns
+		err := tx.QueryRowx(query, id, chatID, userID, amount, rate, termDays, maturesAt, constants.DepositOpen,
+			constants.DepositMaxOpen).StructScan(&deposit)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("нельзя держать больше %d вкладов", constants.DepositMaxOpen)
+		} else if err != nil {
+			logger.Error("ошибка при добавлении записи в таблицу deposits", zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return models.Deposit{}, balance, err
+	}
+
+	return deposit, balance, nil
+}
+
+// TopUp пополняет вклад до востребования
+func (s Service) TopUp(chatID, userID, depositID, amount int64) (models.Deposit, int64, error) {
+	if amount < constants.DepositMinAmount {
+		return models.Deposit{}, 0, fmt.Errorf("сумма пополнения не может быть меньше %d зеток", constants.DepositMinAmount)
+	}
+
+	deposit, err := s.getDeposit(chatID, userID, depositID)
+	if err != nil {
+		return deposit, 0, err
+	}
+	if deposit.TermDays != 0 {
+		return deposit, 0, errors.New("срочный вклад нельзя пополнить, откройте новый")
+	}
+
+	balance, _, err := s.User.TransferWith(transaction(chatID, userID, constants.DepositsID, amount, constants.TxBank, depositID), func(tx *sqlx.Tx) error {
+		query := `UPDATE deposits SET balance = balance + $3 WHERE id = $1 AND user_id = $2 AND status = $4 RETURNING ` + depositColumns
+		err := tx.QueryRowx(query, depositID, userID, amount, constants.DepositOpen).StructScan(&deposit)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("вклад уже закрыт")
+		} else if err != nil {
+			logger.Error("ошибка при обновлении записи в таблице deposits", zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return deposit, balance, err
+	}
+
+	return deposit, balance, nil
+}
+
+// Withdraw снимает amount со вклада, amount 0 - снять всё и закрыть вклад. Со срочного вклада до окончания
+// срока удерживается штраф в пользу казино. Возвращает вклад, полученную сумму, штраф и баланс пользователя
+func (s Service) Withdraw(chatID, userID, depositID, amount int64) (models.Deposit, int64, int64, int64, error) {
+	if amount < 0 {
+		return models.Deposit{}, 0, 0, 0, errors.New(constants.ErrNegativeAmount)
+	}
+
+	deposit, err := s.getDeposit(chatID, userID, depositID)
+	if err != nil {
+		return deposit, 0, 0, 0, err
+	}
+
+	if amount == 0 {
+		amount = deposit.Balance
+	}
+	if amount > deposit.Balance {
+		return deposit, 0, 0, 0, errors.New("на вкладе недостаточно средств")
+	}
+
+	var penalty int64
+	if deposit.MaturesAt != nil && time.Now().Before(*deposit.MaturesAt) {
+		penalty = amount * constants.DepositPenalty / 10000
+	}
+
+	// выплата и штраф проводятся вместе со списанием со вклада: если вклад изменился после чтения
+	// (например, начислены проценты), не проходит ничего
+	ts := []models.Transaction{transaction(chatID, constants.DepositsID, userID, amount-penalty, constants.TxBank, depositID)}
+	if penalty > 0 {
+		ts = append(ts, transaction(chatID, constants.DepositsID, constants.CasinoID, penalty, constants.TxBank, depositID))
+	}
+	balances, err := s.User.TransferBatch(ts, func(tx *sqlx.Tx) error {
+		query := `UPDATE deposits SET balance = balance - $2,
+			status = CASE WHEN balance - $2 = 0 THEN $3 ELSE status END,
+			closed_at = CASE WHEN balance - $2 = 0 THEN now() ELSE closed_at END
+			WHERE id = $1 AND status = $4 AND balance = $5 RETURNING ` + depositColumns
+		err := tx.QueryRowx(query, depositID, amount, constants.DepositClosed, constants.DepositOpen, deposit.Balance).StructScan(&deposit)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("вклад изменился, попробуйте ещё раз")
+		} else if err != nil {
+			logger.Error("ошибка при обновлении записи в таблице deposits", zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return deposit, 0, 0, 0, err
+	}
+
+	return deposit, amount - penalty, penalty, balances[userID], nil
+}
+
+// AccrueInterest начисляет проценты за каждые полные сутки с последнего начисления с ежедневной капитализацией.
+// Проценты платит казино; если у казино не хватает денег, вклад ждёт следующего запуска. Возвращает число вкладов с начислением
+func (s Service) AccrueInterest() (int, error) {
+	var deposits []models.Deposit
+	query := `SELECT ` + depositColumns + ` FROM deposits WHERE status = $1 AND accrued_at <= now() - INTERVAL '1 day'`
+	err := db.Conn.Select(&deposits, query, constants.DepositOpen)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы deposits", zap.Error(err))
+		return 0, err
+	}
+
+	var accrued int
+	for _, deposit := range deposits {
+		interest, accruedAt := Interest(deposit, time.Now())
+		if accruedAt.Equal(deposit.AccruedAt) {
+			continue
+		}
+
+		// вклад мог измениться, пока считались проценты - тогда они пересчитаются при следующем запуске
+		accrue := func(e sqlx.Execer) error {
+			res, err := e.Exec(`UPDATE deposits SET balance = balance + $2, accrued_at = $3
+				WHERE id = $1 AND status = $4 AND balance = $5 AND accrued_at = $6`,
+				deposit.ID, interest, accruedAt, constants.DepositOpen, deposit.Balance, deposit.AccruedAt)
+			if err != nil {
+				logger.Error("ошибка при обновлении записи в таблице deposits", zap.Error(err))
+				return err
+			}
+			if updated, _ := res.RowsAffected(); updated == 0 {
+				return sql.ErrNoRows
+			}
+			return nil
+		}
+
+		if interest > 0 {
+			_, _, err = s.User.TransferWith(transaction(deposit.ChatID, constants.CasinoID, constants.DepositsID, interest, constants.TxInterest, deposit.ID), func(tx *sqlx.Tx) error {
+				return accrue(tx)
+			})
+		} else {
+			err = accrue(db.Conn)
+		}
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logger.Warn("не удалось начислить проценты по вкладу", zap.Int64("deposit", deposit.ID), zap.Int64("interest", interest), zap.Error(err))
+			}
+			continue
+		}
+
+		accrued++
+	}
+
+	return accrued, nil
+}
+
+// Interest считает проценты по вкладу за полные сутки с AccruedAt до now с ежедневной капитализацией
+// и возвращает их вместе с новым временем начисления. После окончания срока действует ставка до востребования
+func Interest(deposit models.Deposit, now time.Time) (int64, time.Time) {
+	balance := deposit.Balance
+	accruedAt := deposit.AccruedAt
+
+	for !accruedAt.Add(24 * time.Hour).After(now) {
+		accruedAt = accruedAt.Add(24 * time.Hour)
+
+		rate := deposit.Rate
+		if deposit.MaturesAt != nil && accruedAt.After(*deposit.MaturesAt) {
+			rate = constants.DepositDemandRate
+		}
+		balance += balance * rate / 10000
+	}
+
+	return balance - deposit.Balance, accruedAt
+}
+
+func (s Service) getDeposit(chatID, userID, depositID int64) (models.Deposit, error) {
+	var deposit models.Deposit
+	query := `SELECT ` + depositColumns + ` FROM deposits WHERE id = $1 AND chat_id = $2 AND user_id = $3 AND status = $4`
+	err := db.Conn.QueryRowx(query, depositID, chatID, userID, constants.DepositOpen).StructScan(&deposit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return deposit, errors.New("вклад не найден")
+	} else if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы deposits", zap.Error(err))
+		return deposit, err
+	}
+	return deposit, nil
+}
+
+// transaction - перевод amount по журналу с reference вклада
+func transaction(chatID, from, to, amount int64, kind string, depositID int64) models.Transaction {
+	return models.Transaction{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Kind:      kind,
+		ChatID:    chatID,
+		Reference: depositReference(depositID),
+	}
+}
+
+func depositReference(id int64) string {
+	return fmt.Sprintf("deposit #%d", id)
+}
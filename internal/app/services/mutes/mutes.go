@@ -1,31 +1,44 @@
 package mutes
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/redis/go-redis/v9"
+	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
+	"gopkg.in/telebot.v3"
+	"hamsterbot/internal/app/constants"
 	"hamsterbot/internal/app/models"
-	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
 	"hamsterbot/pkg/logger"
 	"regexp"
 	"strconv"
 	"time"
 )
 
+// cleanupWindow - за какой срок CleanupExpired ищет закончившиеся муты, с запасом на пропущенные запуски
+const cleanupWindow = time.Hour
+
 type User interface {
-	GetUserByUsername(username string) (map[string]interface{}, error)
-	SetUserBalance(id int64, balance int64) (int64, error)
+	GetUserByUsername(chatID int64, username string) (models.User, error)
+	TransferWith(t models.Transaction, fn func(tx *sqlx.Tx) error) (int64, int64, error)
+	GetUserMute(chatID, id int64, kind string) (models.Mute, error)
+	SetCachedMute(chatID, id int64, kind string, mute models.Mute) error
+}
+
+// Bot - часть API Telegram, через которую мут применяется в чате
+type Bot interface {
+	Restrict(chat *telebot.Chat, member *telebot.ChatMember) error
 }
 
 type Service struct {
 	User User
+	Bot  Bot
 }
 
-func New(User User) *Service {
+func New(User User, Bot Bot) *Service {
 	return &Service{
 		User: User,
+		Bot:  Bot,
 	}
 }
 
@@ -97,146 +110,319 @@ func (s Service) GetAmount(typeMute string, duration time.Duration) (int, error)
 	return amount, nil
 }
 
-func (s Service) Mute(to string, from string, durationStr string) (int64, int, error) {
-	dataFrom, err := s.User.GetUserByUsername(from)
+func (s Service) Mute(to string, from string, durationStr string, chatID int64) (int64, int, string, error) {
+	dataFrom, err := s.User.GetUserByUsername(chatID, from)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
-	dataTo, err := s.User.GetUserByUsername(to)
+	dataTo, err := s.User.GetUserByUsername(chatID, to)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
 	duration, err := s.GetDuration(durationStr)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
 	amount, err := s.GetAmount("mute", duration)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
-	if dataFrom["balance"].(int64) < int64(amount) {
+	if dataFrom.Balance < int64(amount) {
 		logger.Info("У пользователя недостаточно средств", zap.Any("from", dataFrom))
-		return dataFrom["balance"].(int64), amount, errors.New("недостаточно средств")
+		return dataFrom.Balance, amount, "", errors.New("недостаточно средств")
+	}
+
+	mute, err := s.User.GetUserMute(chatID, dataTo.ID, constants.MuteKind)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	payment := models.Transaction{
+		From:      dataFrom.ID,
+		To:        constants.SystemID,
+		Amount:    int64(amount),
+		Kind:      constants.TxMute,
+		ChatID:    chatID,
+		Reference: fmt.Sprintf("@%s %s", dataTo.Username, durationStr),
 	}
+	mute, balance, _, err := s.Save(models.MuteRecord{
+		Kind:     constants.MuteKind,
+		IssuerID: dataFrom.ID,
+		TargetID: dataTo.ID,
+		ChatID:   chatID,
+		Price:    int64(amount),
+	}, mute, duration, payment)
+	if err != nil {
+		return balance, amount, "", err
+	}
+
+	return balance, amount, mute.Mode, nil
+}
 
-	var mute models.Mute
-	cacheKey := fmt.Sprintf("user:%d:mute", dataTo["id"].(int64))
-	jsonMute, err := cache.Rdb.Get(cache.Ctx, cacheKey).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
+func (s Service) Unmute(from string, to string, chatID int64) (int64, int, error) {
+	dataFrom, err := s.User.GetUserByUsername(chatID, from)
+	if err != nil {
 		return 0, 0, err
 	}
 
-	if jsonMute != "" {
-		err = json.Unmarshal([]byte(jsonMute), &mute)
-		if err != nil {
-			return 0, 0, err
-		}
+	dataTo, err := s.User.GetUserByUsername(chatID, to)
+	if err != nil {
+		return 0, 0, err
+	}
 
-		if mute != (models.Mute{}) {
-			jsonStartMute, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", mute.StartMute)
-			if err != nil {
-				return 0, 0, err
-			}
-			jsonDuration := time.Duration(mute.Duration)
-
-			startMute := time.Now().UTC()
-			oldDuration := startMute.Sub(jsonStartMute)
-
-			jsonDuration -= oldDuration
-			jsonDuration += duration
-			jsonStartMute = startMute
-
-			mute.StartMute = fmt.Sprint(jsonStartMute)
-			mute.Duration = int64(jsonDuration)
-		} else {
-			mute.StartMute = fmt.Sprint(time.Now().UTC())
-			mute.Duration = int64(duration)
-		}
-	} else {
-		mute.StartMute = fmt.Sprint(time.Now().UTC())
-		mute.Duration = int64(duration)
+	mute, err := s.User.GetUserMute(chatID, dataTo.ID, constants.MuteKind)
+	if err != nil {
+		return 0, 0, err
+	}
+	if mute == (models.Mute{}) {
+		return 0, 0, fmt.Errorf("пользователь не в муте")
+	}
+
+	end, err := mute.End()
+	if err != nil {
+		return 0, 0, err
 	}
+	mute.Duration = int64(time.Until(end))
 
-	balance, err := s.User.SetUserBalance(dataFrom["id"].(int64), dataFrom["balance"].(int64)-int64(amount))
+	amount, err := s.GetAmount("unmute", time.Duration(mute.Duration))
 	if err != nil {
 		return 0, 0, err
 	}
 
-	strMute, err := json.Marshal(mute)
-	err = cache.Rdb.Set(cache.Ctx, cacheKey, strMute, time.Duration(mute.Duration)).Err()
+	if dataFrom.Balance < int64(amount) {
+		logger.Info("У пользователя недостаточно средств", zap.Any("from", dataFrom))
+		return dataFrom.Balance, amount, errors.New("недостаточно средств")
+	}
+
+	payment := models.Transaction{
+		From:      dataFrom.ID,
+		To:        constants.SystemID,
+		Amount:    int64(amount),
+		Kind:      constants.TxUnmute,
+		ChatID:    chatID,
+		Reference: "@" + dataTo.Username,
+	}
+	balance, _, err := s.Lift(constants.MuteKind, dataTo.ID, payment)
 	if err != nil {
-		return 0, 0, errors.New("неизвестная ошибка, обратитесь к администратору")
+		return balance, amount, err
 	}
 
 	return balance, amount, nil
 }
 
-func (s Service) Unmute(from string, to string) (int64, int, error) {
-	dataFrom, err := s.User.GetUserByUsername(from)
+// Save продлевает текущий мут current на duration. Платёж payment и запись мута в таблицу mutes проводятся
+// одной транзакцией, и только после её коммита мут применяется в чате и попадает в кэш: если запись не прошла,
+// не остаётся ни списанных денег, ни ограничения в чате. Возвращает мут и балансы сторон платежа
+func (s Service) Save(record models.MuteRecord, current models.Mute, duration time.Duration, payment models.Transaction) (models.Mute, int64, int64, error) {
+	now := time.Now().UTC()
+	if current != (models.Mute{}) {
+		end, err := current.End()
+		if err != nil {
+			return current, 0, 0, err
+		}
+		if end.After(now) {
+			duration += end.Sub(now)
+		}
+	}
+
+	record.StartAt = now
+	record.EndAt = now.Add(duration)
+	record.Mode = constants.MuteModeDelete
+
+	fromBalance, toBalance, err := s.User.TransferWith(payment, func(tx *sqlx.Tx) error {
+		query := `INSERT INTO mutes (kind, issuer_id, target_id, chat_id, start_at, end_at, price, mode)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		err := tx.QueryRowx(query, record.Kind, record.IssuerID, record.TargetID, record.ChatID, record.StartAt, record.EndAt,
+			record.Price, record.Mode).Scan(&record.ID)
+		if err != nil {
+			logger.Error("ошибка при добавлении записи в таблицу mutes", zap.Error(err))
+		}
+		return err
+	})
 	if err != nil {
-		return 0, 0, err
+		return current, fromBalance, toBalance, err
 	}
 
-	dataTo, err := s.User.GetUserByUsername(to)
+	record.Mode = s.apply(record)
+
+	mute := models.NewMute(now, duration)
+	mute.ChatID = record.ChatID
+	mute.Mode = record.Mode
+
+	// платёж и мут уже закоммичены, ошибка кэша не должна выглядеть для пользователя как неудача
+	err = s.User.SetCachedMute(record.ChatID, record.TargetID, record.Kind, mute)
 	if err != nil {
-		return 0, 0, err
+		logger.Error("ошибка при записи мута в кэш", zap.Int64("mute", record.ID), zap.Error(err))
 	}
 
-	var mute models.Mute
-	cacheKey := fmt.Sprintf("user:%d:mute", dataTo["id"].(int64))
-	jsonMute, err := cache.Rdb.Get(cache.Ctx, cacheKey).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return 0, 0, err
+	return mute, fromBalance, toBalance, nil
+}
+
+// apply ограничивает пользователя в чате по уже сохранённой записи мута и отмечает в ней способ мута.
+// Если отметить не удалось, ограничение снимается: запись и чат не должны расходиться
+func (s Service) apply(record models.MuteRecord) string {
+	if s.restrict(record.ChatID, record.TargetID, record.EndAt) != constants.MuteModeRestrict {
+		return constants.MuteModeDelete
+	}
+
+	_, err := db.Conn.Exec(`UPDATE mutes SET mode = $2 WHERE id = $1`, record.ID, constants.MuteModeRestrict)
+	if err != nil {
+		logger.Error("ошибка при обновлении записи в таблице mutes, мут будет применяться удалением сообщений",
+			zap.Int64("mute", record.ID), zap.Error(err))
+		s.unrestrict(record.ChatID, record.TargetID)
+		return constants.MuteModeDelete
 	}
 
-	if jsonMute != "" {
-		err = json.Unmarshal([]byte(jsonMute), &mute)
+	return constants.MuteModeRestrict
+}
+
+// Lift досрочно снимает с пользователя targetID все действующие в чате муты вида kind. Платёж payment и снятие
+// мутов проводятся одной транзакцией: если снимать нечего, платёж не проходит. Ограничения в чате снимаются
+// после коммита. Возвращает балансы сторон платежа
+func (s Service) Lift(kind string, targetID int64, payment models.Transaction) (int64, int64, error) {
+	chatID := payment.ChatID
+
+	var records []models.MuteRecord
+	fromBalance, toBalance, err := s.User.TransferWith(payment, func(tx *sqlx.Tx) error {
+		query := `UPDATE mutes SET unmuted_at = now(), unmuted_by = $4, unmute_price = $5
+			WHERE chat_id = $1 AND target_id = $2 AND kind = $3 AND unmuted_at IS NULL AND end_at > now()
+			RETURNING id, kind, issuer_id, target_id, chat_id, start_at, end_at, price, mode`
+		err := tx.Select(&records, query, chatID, targetID, kind, payment.From, payment.Amount)
 		if err != nil {
-			return 0, 0, err
+			logger.Error("ошибка при обновлении записей в таблице mutes", zap.Error(err))
+			return err
+		}
+		if len(records) == 0 {
+			return errors.New("мут уже закончился")
 		}
+		return nil
+	})
+	if err != nil {
+		return fromBalance, toBalance, err
+	}
 
-		if mute != (models.Mute{}) {
-			jsonStartMute, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", mute.StartMute)
-			if err != nil {
-				return 0, 0, err
-			}
-			jsonDuration := time.Duration(mute.Duration)
+	// платёж и снятие уже закоммичены, дальше ошибки только записываются в лог
+	err = s.User.SetCachedMute(chatID, targetID, kind, models.Mute{})
+	if err != nil {
+		logger.Error("ошибка при сбросе мута в кэше", zap.Int64("chat", chatID), zap.Int64("user", targetID), zap.Error(err))
+	}
 
-			currentTime := time.Now().UTC()
-			duration := currentTime.Sub(jsonStartMute)
+	// ограничения в чате общие для мута и самомута, поэтому снимаем их,
+	// только если в этом чате не осталось другого мута
+	other := constants.SelfMuteKind
+	if kind == constants.SelfMuteKind {
+		other = constants.MuteKind
+	}
+	otherMute, err := s.User.GetUserMute(chatID, targetID, other)
+	if err != nil {
+		logger.Error("ошибка при проверке другого мута пользователя", zap.Int64("chat", chatID), zap.Int64("user", targetID), zap.Error(err))
+	}
 
-			mute.StartMute = ""
-			mute.Duration = int64(jsonDuration - duration)
-		} else {
-			return 0, 0, fmt.Errorf("пользователь не в муте")
+	for _, record := range records {
+		if record.Mode != constants.MuteModeRestrict {
+			continue
 		}
-	} else {
-		return 0, 0, fmt.Errorf("пользователь не в муте")
+		if otherMute.Mode == constants.MuteModeRestrict {
+			continue
+		}
+		s.unrestrict(record.ChatID, targetID)
 	}
 
-	amount, err := s.GetAmount("unmute", time.Duration(mute.Duration))
+	return fromBalance, toBalance, nil
+}
+
+// restrict ограничивает пользователя в чате до end и возвращает применённый способ мута.
+// Telegram считает until_date ближе 30 секунд или дальше 366 дней бессрочным,
+// такие муты, как и чаты без прав администратора у бота, обрабатываются удалением сообщений
+func (s Service) restrict(chatID, userID int64, end time.Time) string {
+	if s.Bot == nil || chatID >= 0 {
+		return constants.MuteModeDelete
+	}
+
+	until := time.Until(end)
+	if until < 30*time.Second || until > 366*24*time.Hour {
+		return constants.MuteModeDelete
+	}
+
+	err := s.Bot.Restrict(&telebot.Chat{ID: chatID}, &telebot.ChatMember{
+		User:            &telebot.User{ID: userID},
+		Rights:          telebot.NoRights(),
+		RestrictedUntil: end.Unix(),
+	})
 	if err != nil {
-		return 0, 0, err
+		logger.Warn("не удалось ограничить пользователя в чате, мут будет применяться удалением сообщений",
+			zap.Int64("chat", chatID), zap.Int64("user", userID), zap.Error(err))
+		return constants.MuteModeDelete
 	}
 
-	if dataFrom["balance"].(int64) < int64(amount) {
-		logger.Info("У пользователя недостаточно средств", zap.Any("from", dataFrom))
-		return dataFrom["balance"].(int64), amount, errors.New("недостаточно средств")
+	return constants.MuteModeRestrict
+}
+
+func (s Service) unrestrict(chatID, userID int64) {
+	if s.Bot == nil {
+		return
 	}
 
-	balance, err := s.User.SetUserBalance(dataFrom["id"].(int64), dataFrom["balance"].(int64)-int64(amount))
+	err := s.Bot.Restrict(&telebot.Chat{ID: chatID}, &telebot.ChatMember{
+		User:   &telebot.User{ID: userID},
+		Rights: telebot.NoRestrictions(),
+	})
 	if err != nil {
-		return 0, 0, err
+		logger.Warn("не удалось снять ограничения с пользователя в чате",
+			zap.Int64("chat", chatID), zap.Int64("user", userID), zap.Error(err))
 	}
+}
 
-	err = cache.Rdb.Del(cache.Ctx, cacheKey).Err()
+// RestoreCache восстанавливает кэш мутов в Redis по действующим записям из Postgres
+func (s Service) RestoreCache() (int, error) {
+	var records []models.MuteRecord
+	query := `SELECT DISTINCT ON (chat_id, target_id, kind) id, kind, issuer_id, target_id, chat_id, start_at, end_at, price, mode
+		FROM mutes WHERE unmuted_at IS NULL AND end_at > now()
+		ORDER BY chat_id, target_id, kind, id DESC`
+	err := db.Conn.Select(&records, query)
 	if err != nil {
-		return 0, 0, errors.New("неизвестная ошибка, обратитесь к администратору")
+		logger.Error("ошибка при выборке данных из таблицы mutes", zap.Error(err))
+		return 0, err
 	}
 
-	return balance, amount, nil
+	for _, record := range records {
+		mute := models.NewMute(record.StartAt, record.EndAt.Sub(record.StartAt))
+		mute.ChatID = record.ChatID
+		mute.Mode = record.Mode
+		err = s.User.SetCachedMute(record.ChatID, record.TargetID, record.Kind, mute)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(records), nil
+}
+
+// CleanupExpired убирает из кэша муты, закончившиеся за последний cleanupWindow, если у пользователя
+// не появилось нового мута того же вида. Закончившийся мут и так считается пустым, очистка не даёт
+// устаревшим записям копиться в кэше пользователей. Возвращает число очищенных мутов
+func (s Service) CleanupExpired() (int, error) {
+	var records []models.MuteRecord
+	query := `SELECT DISTINCT m.chat_id, m.target_id, m.kind FROM mutes m
+		WHERE m.unmuted_at IS NULL AND m.end_at <= now() AND m.end_at > now() - $1::INTERVAL
+		AND NOT EXISTS (SELECT 1 FROM mutes a WHERE a.chat_id = m.chat_id AND a.target_id = m.target_id AND a.kind = m.kind
+			AND a.unmuted_at IS NULL AND a.end_at > now())`
+	err := db.Conn.Select(&records, query, fmt.Sprintf("%d seconds", int(cleanupWindow.Seconds())))
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы mutes", zap.Error(err))
+		return 0, err
+	}
+
+	for _, record := range records {
+		err = s.User.SetCachedMute(record.ChatID, record.TargetID, record.Kind, models.Mute{})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(records), nil
 }
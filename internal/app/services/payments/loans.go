@@ -0,0 +1,362 @@
+package payments
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"time"
+)
+
+// Кредит выдаёт казино. Перевод по журналу и изменение кредита проходят в одной транзакции, поэтому деньги
+// и долг не расходятся. Все переводы кредита идут с reference "loan #<id>".
+// Проценты не переводятся, а прибавляются к долгу. При выдаче часть суммы кредита списывается с баланса
+// заёмщика в залог на счёт EscrowID: при погашении залог возвращается, а при просрочке уходит казино в счёт долга
+
+const loanColumns = `id, chat_id, user_id, principal, debt, collateral, rate, status, accrued_at, due_at, created_at, repaid_at`
+
+// Collateral - залог, который нужен для кредита на amount
+func Collateral(amount int64) int64 {
+	return amount * constants.LoanCollateralShare / 100
+}
+
+// Limit - кредитный лимит пользователя: зависит от уровня и почасового дохода
+func Limit(user models.User) int64 {
+	return user.Lvl*constants.LoanLvlLimit + user.Income*constants.LoanIncomeHours
+}
+
+// LoanLimit возвращает кредитный лимит пользователя
+func (s Service) LoanLimit(chatID, userID int64) (int64, error) {
+	user, err := s.User.GetUserById(chatID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return Limit(user), nil
+}
+
+// GetLoan возвращает непогашенный кредит пользователя, ok false - кредита нет
+func (s Service) GetLoan(chatID, userID int64) (models.Loan, bool, error) {
+	var loan models.Loan
+	query := `SELECT ` + loanColumns + ` FROM loans WHERE chat_id = $1 AND user_id = $2 AND status IN ($3, $4)`
+	err := db.Conn.QueryRowx(query, chatID, userID, constants.LoanActive, constants.LoanDefaulted).StructScan(&loan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return loan, false, nil
+	} else if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы loans", zap.Error(err))
+		return loan, false, err
+	}
+	return loan, true, nil
+}
+
+// IsDefaulted сообщает, есть ли у пользователя просроченный кредит
+func (s Service) IsDefaulted(chatID, userID int64) (bool, error) {
+	var defaulted bool
+	err := db.Conn.QueryRowx(`SELECT EXISTS(SELECT 1 FROM loans WHERE chat_id = $1 AND user_id = $2 AND status = $3)`,
+		chatID, userID, constants.LoanDefaulted).Scan(&defaulted)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы loans", zap.Error(err))
+		return false, err
+	}
+	return defaulted, nil
+}
+
+// TakeLoan выдаёт кредит на amount в пределах лимита. Возвращает кредит и новый баланс пользователя
+func (s Service) TakeLoan(chatID, userID, amount int64) (models.Loan, int64, error) {
+	user, err := s.User.GetUserById(chatID, userID)
+	if err != nil {
+		return models.Loan{}, 0, err
+	}
+
+	if amount < constants.LoanMinAmount {
+		return models.Loan{}, user.Balance, fmt.Errorf("сумма кредита не может быть меньше %d зеток", constants.LoanMinAmount)
+	}
+	if limit := Limit(user); amount > limit {
+		return models.Loan{}, user.Balance, fmt.Errorf("ваш кредитный лимит - %d зеток", limit)
+	}
+	collateral := Collateral(amount)
+	if user.Balance < collateral {
+		return models.Loan{}, user.Balance, fmt.Errorf("для такого кредита нужен залог %d зеток на балансе", collateral)
+	}
+
+	if _, ok, err := s.GetLoan(chatID, userID); err != nil {
+		return models.Loan{}, user.Balance, err
+	} else if ok {
+		return models.Loan{}, user.Balance, errors.New("у вас уже есть непогашенный кредит (/loan status)")
+	}
+
+	var id int64
+	err = db.Conn.QueryRowx(`SELECT nextval('loans_id_seq')`).Scan(&id)
+	if err != nil {
+		logger.Error("ошибка при получении номера кредита", zap.Error(err))
+		return models.Loan{}, user.Balance, err
+	}
+
+	// залог уходит с баланса до выдачи, поэтому его нельзя внести из самого кредита
+	var loan models.Loan
+	balances, err := s.User.TransferBatch([]models.Transaction{
+		loanTransaction(chatID, id, userID, constants.EscrowID, collateral),
+		loanTransaction(chatID, id, constants.CasinoID, userID, amount),
+	}, func(tx *sqlx.Tx) error {
+		query := `INSERT INTO loans (id, chat_id, user_id, principal, debt, collateral, rate, due_at)
+			VALUES ($1, $2, $3, $4, $4, $5, $6, $7) RETURNING ` + loanColumns
+		err := tx.QueryRowx(query, id, chatID, userID, amount, collateral, constants.LoanRate, time.Now().Add(constants.LoanTerm)).StructScan(&loan)
+		if err != nil {
+			// второй кредит, выданный параллельно, не пройдёт уникальный индекс, и перевод откатится вместе с ним
+			logger.Error("ошибка при добавлении записи в таблицу loans", zap.Error(err))
+			return errors.New("не удалось выдать кредит")
+		}
+		return nil
+	})
+	balance := balances[userID]
+	if err != nil {
+		if err.Error() == constants.ErrLackBalance && balance < collateral {
+			err = fmt.Errorf("для такого кредита нужен залог %d зеток на балансе", collateral)
+		} else if err.Error() == constants.ErrLackBalance {
+			err = errors.New("в казино недостаточно денег для такого кредита")
+		}
+		return models.Loan{}, balance, err
+	}
+
+	return loan, balance, nil
+}
+
+// RepayLoan погашает кредит на amount, amount 0 - весь долг. Возвращает кредит и новый баланс пользователя
+func (s Service) RepayLoan(chatID, userID, amount int64) (models.Loan, int64, error) {
+	if amount < 0 {
+		return models.Loan{}, 0, errors.New(constants.ErrNegativeAmount)
+	}
+
+	loan, ok, err := s.GetLoan(chatID, userID)
+	if err != nil {
+		return loan, 0, err
+	}
+	if !ok {
+		return loan, 0, errors.New("у вас нет непогашенного кредита")
+	}
+
+	if amount == 0 || amount > loan.Debt {
+		amount = loan.Debt
+	}
+
+	return s.repay(loan, amount)
+}
+
+// UpdateLoans начисляет проценты и отмечает просроченные кредиты, забирая их залог. Вызывается по таймеру
+// перед начислением дохода, чтобы платёж по просроченному кредиту сразу списывался по повышенной доле
+func (s Service) UpdateLoans() error {
+	if err := s.accrueLoans(); err != nil {
+		return err
+	}
+
+	return s.defaultLoans()
+}
+
+// CollectLoans списывает с заёмщиков долю только что начисленного почасового дохода в счёт долга. Выполняется
+// в транзакции начисления дохода: доход и платёж проходят вместе или не проходят вовсе. Залог кредита, погашенного
+// в срок, возвращается заёмщику тем же запросом. Возвращает число кредитов со списанием
+func (s Service) CollectLoans(tx *sqlx.Tx) (int, error) {
+	// списание идёт только там, где доход действительно начисляется, и не больше долга и баланса заёмщика.
+	// Строку пользователя запрос меняет один раз, поэтому платёж и возврат залога сведены в debit
+	query := `WITH due AS (
+    SELECT l.id, l.chat_id, l.user_id, l.status,
+        LEAST(u.income * (CASE WHEN l.status = $2 THEN $4::BIGINT ELSE $3::BIGINT END) / 100, l.debt, u.balance) AS amount,
+        CASE WHEN l.status = $1 THEN l.collateral ELSE 0 END AS collateral
+    FROM loans l
+    JOIN users u ON u.chat_id = l.chat_id AND u.id = l.user_id
+    JOIN chats c ON c.chat_id = l.chat_id
+    WHERE l.status IN ($1, $2) AND c.income_enabled AND u.income > 0
+    FOR UPDATE OF l
+), pay AS (
+    UPDATE loans l SET debt = l.debt - d.amount,
+        status = CASE WHEN l.debt = d.amount THEN $5 ELSE l.status END,
+        repaid_at = CASE WHEN l.debt = d.amount THEN now() ELSE l.repaid_at END
+    FROM due d
+    WHERE l.id = d.id AND d.amount > 0
+    RETURNING l.id, l.chat_id, l.user_id, d.amount,
+        CASE WHEN l.debt = 0 THEN d.collateral ELSE 0 END AS released
+), debit AS (
+    UPDATE users u SET balance = u.balance - p.amount + p.released FROM pay p WHERE u.chat_id = p.chat_id AND u.id = p.user_id
+), credit AS (
+    UPDATE users u SET balance = u.balance + p.total
+    FROM (SELECT chat_id, SUM(amount) AS total FROM pay GROUP BY chat_id) p
+    WHERE u.chat_id = p.chat_id AND u.id = $6
+), release AS (
+    UPDATE users u SET balance = u.balance - p.total
+    FROM (SELECT chat_id, SUM(released) AS total FROM pay GROUP BY chat_id HAVING SUM(released) > 0) p
+    WHERE u.chat_id = p.chat_id AND u.id = $8
+), journal AS (
+    INSERT INTO transactions (from_id, to_id, amount, kind, chat_id, reference)
+    SELECT user_id, $6, amount, $7, chat_id, 'loan #' || id FROM pay
+    UNION ALL
+    SELECT $8, user_id, released, $7, chat_id, 'loan #' || id FROM pay WHERE released > 0
+)
+SELECT count(*) FROM pay`
+	var collected int
+	err := tx.QueryRowx(query, constants.LoanActive, constants.LoanDefaulted, constants.LoanIncomeShare, constants.LoanDefaultShare,
+		constants.LoanRepaid, constants.CasinoID, constants.TxLoan, constants.EscrowID).Scan(&collected)
+	if err != nil {
+		logger.Error("ошибка при списании платежей по кредитам", zap.Error(err))
+		return 0, err
+	}
+
+	return collected, nil
+}
+
+// LoanInterest считает проценты по кредиту за полные сутки с AccruedAt до now с ежедневной капитализацией
+// и возвращает их вместе с новым временем начисления
+func LoanInterest(loan models.Loan, now time.Time) (int64, time.Time) {
+	debt := loan.Debt
+	accruedAt := loan.AccruedAt
+
+	for !accruedAt.Add(24 * time.Hour).After(now) {
+		accruedAt = accruedAt.Add(24 * time.Hour)
+		debt += debt * loan.Rate / 10000
+	}
+
+	return debt - loan.Debt, accruedAt
+}
+
+func (s Service) accrueLoans() error {
+	var loans []models.Loan
+	query := `SELECT ` + loanColumns + ` FROM loans WHERE status IN ($1, $2) AND accrued_at <= now() - INTERVAL '1 day'`
+	err := db.Conn.Select(&loans, query, constants.LoanActive, constants.LoanDefaulted)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы loans", zap.Error(err))
+		return err
+	}
+
+	for _, loan := range loans {
+		interest, accruedAt := LoanInterest(loan, time.Now())
+		if accruedAt.Equal(loan.AccruedAt) {
+			continue
+		}
+
+		// кредит мог измениться, пока считались проценты - тогда они пересчитаются при следующем запуске
+		_, err = db.Conn.Exec(`UPDATE loans SET debt = debt + $2, accrued_at = $3 WHERE id = $1 AND debt = $4 AND accrued_at = $5`,
+			loan.ID, interest, accruedAt, loan.Debt, loan.AccruedAt)
+		if err != nil {
+			logger.Error("ошибка при обновлении записи в таблице loans", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// defaultLoans отмечает просроченными кредиты, срок которых вышел, и забирает их залог: казино получает его
+// в счёт долга, а то, что осталось сверх долга, возвращается заёмщику. Кредит, долг по которому залог покрыл
+// целиком, сразу закрывается
+func (s Service) defaultLoans() error {
+	var loans []models.Loan
+	query := `SELECT ` + loanColumns + ` FROM loans WHERE status = $1 AND due_at <= now()`
+	err := db.Conn.Select(&loans, query, constants.LoanActive)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы loans", zap.Error(err))
+		return err
+	}
+
+	var errs []error
+	for _, loan := range loans {
+		seized := min(loan.Collateral, loan.Debt)
+		var ts []models.Transaction
+		if seized > 0 {
+			ts = append(ts, loanTransaction(loan.ChatID, loan.ID, constants.EscrowID, constants.CasinoID, seized))
+		}
+		if rest := loan.Collateral - seized; rest > 0 {
+			ts = append(ts, loanTransaction(loan.ChatID, loan.ID, constants.EscrowID, loan.UserID, rest))
+		}
+
+		err = s.transferLoan(ts, func(tx *sqlx.Tx) error {
+			// кредит мог измениться после выборки - тогда он просрочится при следующем запуске
+			res, err := tx.Exec(`UPDATE loans SET debt = debt - $2,
+				status = CASE WHEN debt = $2 THEN $3 ELSE $4 END,
+				repaid_at = CASE WHEN debt = $2 THEN now() ELSE repaid_at END
+				WHERE id = $1 AND debt = $5 AND status = $6`,
+				loan.ID, seized, constants.LoanRepaid, constants.LoanDefaulted, loan.Debt, constants.LoanActive)
+			if err != nil {
+				logger.Error("ошибка при обновлении записи в таблице loans", zap.Error(err))
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return errors.New("кредит уже изменился")
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Warn("не удалось забрать залог просроченного кредита", zap.Int64("loan", loan.ID), zap.Error(err))
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// transferLoan проводит переводы ts кредита и в той же транзакции выполняет fn; без переводов выполняется только fn
+func (s Service) transferLoan(ts []models.Transaction, fn func(tx *sqlx.Tx) error) error {
+	if len(ts) > 0 {
+		_, err := s.User.TransferBatch(ts, fn)
+		return err
+	}
+
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// repay переводит amount от заёмщика казино и в той же транзакции уменьшает долг; погашенный полностью кредит
+// закрывается, а залог кредита в срок возвращается заёмщику
+func (s Service) repay(loan models.Loan, amount int64) (models.Loan, int64, error) {
+	full := amount == loan.Debt
+	ts := []models.Transaction{loanTransaction(loan.ChatID, loan.ID, loan.UserID, constants.CasinoID, amount)}
+	if full && loan.Status == constants.LoanActive && loan.Collateral > 0 {
+		ts = append(ts, loanTransaction(loan.ChatID, loan.ID, constants.EscrowID, loan.UserID, loan.Collateral))
+	}
+
+	// погашение целиком проходит, только если долг и статус не изменились, иначе залог вернулся бы не по тому кредиту
+	condition, args := `debt > $2 AND status IN ($4, $5)`, []any{constants.LoanActive, constants.LoanDefaulted}
+	if full {
+		condition, args = `debt = $2 AND status = $4`, []any{loan.Status}
+	}
+
+	balances, err := s.User.TransferBatch(ts, func(tx *sqlx.Tx) error {
+		query := `UPDATE loans SET debt = debt - $2,
+			status = CASE WHEN debt - $2 = 0 THEN $3 ELSE status END,
+			repaid_at = CASE WHEN debt - $2 = 0 THEN now() ELSE repaid_at END
+			WHERE id = $1 AND ` + condition + ` RETURNING ` + loanColumns
+		err := tx.QueryRowx(query, append([]any{loan.ID, amount, constants.LoanRepaid}, args...)...).StructScan(&loan)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("кредит уже изменился, попробуйте ещё раз")
+		} else if err != nil {
+			logger.Error("ошибка при обновлении записи в таблице loans", zap.Error(err))
+		}
+		return err
+	})
+
+	return loan, balances[loan.UserID], err
+}
+
+func loanTransaction(chatID, loanID, from, to, amount int64) models.Transaction {
+	return models.Transaction{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Kind:      constants.TxLoan,
+		ChatID:    chatID,
+		Reference: loanReference(loanID),
+	}
+}
+
+func loanReference(id int64) string {
+	return fmt.Sprintf("loan #%d", id)
+}
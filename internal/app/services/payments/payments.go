@@ -2,11 +2,17 @@ package payments
 
 import (
 	"errors"
+	"github.com/jmoiron/sqlx"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
 )
 
 type User interface {
-	GetUserByUsername(username string) (map[string]interface{}, error)
-	SetUserBalance(id int64, balance int64) (int64, error)
+	GetUserById(chatID, id int64) (models.User, error)
+	GetUserByUsername(chatID int64, username string) (models.User, error)
+	Transfer(t models.Transaction) (int64, int64, error)
+	TransferWith(t models.Transaction, fn func(tx *sqlx.Tx) error) (int64, int64, error)
+	TransferBatch(ts []models.Transaction, fn func(tx *sqlx.Tx) error) (map[int64]int64, error)
 }
 
 type Service struct {
@@ -19,56 +25,70 @@ func New(User User) *Service {
 	}
 }
 
-func (s Service) Pay(from string, to string, amount int) (int64, error) {
-	dataTo, err := s.User.GetUserByUsername(to)
+func (s Service) Pay(from string, to string, amount int, chatID int64) (int64, error) {
+	return s.transfer(from, to, amount, chatID, constants.TxPay)
+}
+
+func (s Service) transfer(from string, to string, amount int, chatID int64, kind string) (int64, error) {
+	dataTo, err := s.User.GetUserByUsername(chatID, to)
 	if err != nil {
 		return 0, err
 	}
 
-	dataFrom, err := s.User.GetUserByUsername(from)
+	dataFrom, err := s.User.GetUserByUsername(chatID, from)
 	if err != nil {
 		return 0, err
 	}
 
-	balanceTo := dataTo["balance"].(int64)
-	balanceFrom := dataFrom["balance"].(int64)
+	balanceFrom := dataFrom.Balance
 
-	if balanceFrom < int64(amount) {
-		return balanceFrom, errors.New("недостаточно средств")
+	if amount < 0 {
+		return balanceFrom, errors.New("сумма не может быть отрицательной")
 	}
 
-	if dataTo["id"].(int64) == 0 {
+	if dataTo.ID == 0 {
 		return balanceFrom, errors.New("пользователь не зарегистрирован")
 	}
 
-	balance, err := s.User.SetUserBalance(dataFrom["id"].(int64), balanceFrom-int64(amount))
+	balance, _, err := s.User.Transfer(models.Transaction{
+		From:   dataFrom.ID,
+		To:     dataTo.ID,
+		Amount: int64(amount),
+		Kind:   kind,
+		ChatID: chatID,
+	})
 	if err != nil {
-		return 0, err
-	}
-	_, err = s.User.SetUserBalance(dataTo["id"].(int64), balanceTo+int64(amount))
-	if err != nil {
-		return 0, err
+		return balance, err
 	}
 
 	return balance, nil
 }
 
-func (s Service) PayAdm(to string, amount int) (int64, error) {
-	dataTo, err := s.User.GetUserByUsername(to)
+func (s Service) PayAdm(to string, amount int, chatID int64) (int64, error) {
+	dataTo, err := s.User.GetUserByUsername(chatID, to)
 	if err != nil {
 		return 0, err
 	}
 
-	balanceTo := dataTo["balance"].(int64)
+	balanceTo := dataTo.Balance
 
-	if dataTo["id"].(int64) == 0 {
+	if dataTo.ID == 0 {
 		return balanceTo, errors.New("пользователь не зарегистрирован")
 	}
 
-	_, err = s.User.SetUserBalance(dataTo["id"].(int64), balanceTo+int64(amount))
+	// положительная сумма выпускается служебным счётом, отрицательная списывается на него
+	t := models.Transaction{From: constants.SystemID, To: dataTo.ID, Amount: int64(amount), Kind: constants.TxAdmin, ChatID: chatID}
+	if amount < 0 {
+		t.From, t.To, t.Amount = dataTo.ID, constants.SystemID, -int64(amount)
+	}
+
+	fromBalance, toBalance, err := s.User.Transfer(t)
 	if err != nil {
 		return balanceTo, err
 	}
+	if amount < 0 {
+		return fromBalance, nil
+	}
 
-	return balanceTo, nil
+	return toBalance, nil
 }
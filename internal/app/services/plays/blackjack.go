@@ -0,0 +1,722 @@
+package plays
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/fair"
+	"hamsterbot/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Башмак чата - список chat:<chat>:bj:shoe, раздачи разных игроков берут карты из одного башмака.
+// Идущая раздача - строка chat:<chat>:bj:<user>, её меняют только под WATCH раздачи и башмака: карты
+// снимаются с башмака в том же MULTI, что и записывается ход, так что одновременные нажатия не сыграют
+// ход дважды. Множество bj:open хранит время автоматического stand для каждой раздачи. Ставка списывается
+// в казино, если казино покроет выигрыш: при раздаче - после того, как раздача записана в Redis, поэтому
+// раздачу, ставка по которой не отмечена (Staked), таймер закрывает и возвращает ставку, если она есть в журнале.
+// Завершённая раздача с выплатой остаётся в Redis с исходом и попадает в bj:settled, где вес - время повтора
+// выплаты. Выплаты и возвраты сверяются с журналом и не проводятся дважды; выплата, не прошедшая за handKeep,
+// записывается в failed_payouts для ручного разбора. Reference переводов - "bj #<id>"
+
+// handKeep - сколько раздача живёт в Redis после таймаута, если её никто не завершил,
+// и сколько повторяется выплата завершённой раздачи
+const handKeep = 24 * time.Hour
+
+// handRetry - через сколько повторяется выплата, если она не прошла или выплачивающий вызов не завершился
+const handRetry = time.Minute
+
+const (
+	handOpenKey    = "bj:open"
+	handSettledKey = "bj:settled"
+	handRoundKey   = "bj:hand"
+)
+
+var (
+	ErrHandFinished = errors.New("раздача уже завершена")
+	errHandActive   = errors.New("раздача ещё не просрочена")
+	errHandUnstaked = errors.New("ставка раздачи ещё не списана")
+)
+
+// reshuffleScript кладёт в башмак новые карты, если в нём осталось меньше ARGV[1]
+var reshuffleScript = redis.NewScript(`
+if redis.call('LLEN', KEYS[1]) >= tonumber(ARGV[1]) then return 0 end
+redis.call('DEL', KEYS[1])
+redis.call('RPUSH', KEYS[1], unpack(ARGV, 2))
+return 1
+`)
+
+// claimHandScript забирает завершённую раздачу на повтор выплаты, если время повтора наступило,
+// и откладывает следующую попытку. KEYS: bj:settled. ARGV: раздача, текущее время, время следующей попытки
+var claimHandScript = redis.NewScript(`
+local retry = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not retry or tonumber(retry) > tonumber(ARGV[2]) then return 0 end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// StartBlackjack раздаёт карты на ставку bet. Если у игрока или дилера блэкджек, раздача сразу завершается
+func (s Service) StartBlackjack(chatID, userID int64, username string, bet int64) (models.BlackjackHand, error) {
+	if err := s.checkLoan(chatID, userID); err != nil {
+		return models.BlackjackHand{}, err
+	}
+
+	key := handKey(chatID, userID)
+	exists, err := cache.Rdb.Exists(cache.Ctx, key).Result()
+	if err != nil {
+		return models.BlackjackHand{}, err
+	}
+	if exists > 0 {
+		return models.BlackjackHand{}, errors.New("у вас уже есть незаконченная раздача")
+	}
+
+	if err = s.checkBlackjackCover(chatID, games.BlackjackMaxPayout(bet, false), bet); err != nil {
+		return models.BlackjackHand{}, err
+	}
+
+	id, err := cache.Rdb.Incr(cache.Ctx, handRoundKey).Result()
+	if err != nil {
+		return models.BlackjackHand{}, err
+	}
+
+	hand := models.BlackjackHand{
+		ID:        id,
+		ChatID:    chatID,
+		UserID:    userID,
+		Username:  username,
+		Bet:       bet,
+		ExpiresAt: time.Now().Add(constants.BlackjackTimeout).Unix(),
+	}
+
+	if err = s.shuffleShoe(chatID); err != nil {
+		return hand, err
+	}
+	cards, err := s.drawCards(chatID, 4)
+	if err != nil {
+		return hand, err
+	}
+	hand.Player = []int{cards[0], cards[2]}
+	hand.Dealer = []int{cards[1], cards[3]}
+
+	// раздача записывается до списания ставки: если списание прервётся, таймер найдёт её в bj:open
+	data, err := json.Marshal(hand)
+	if err != nil {
+		return hand, err
+	}
+	pipe := cache.Rdb.TxPipeline()
+	setNX := pipe.SetNX(cache.Ctx, key, data, constants.BlackjackTimeout+handKeep)
+	pipe.ZAdd(cache.Ctx, handOpenKey, redis.Z{Score: float64(hand.ExpiresAt), Member: handMember(chatID, userID)})
+	if _, err = pipe.Exec(cache.Ctx); err != nil {
+		return hand, err
+	}
+	if !setNX.Val() {
+		return hand, errors.New("у вас уже есть незаконченная раздача")
+	}
+
+	hand.Balance, err = s.betBlackjack(hand, bet)
+	if err != nil {
+		if voidErr := s.voidHand(chatID, userID, hand.ID); voidErr != nil {
+			logger.Error("ошибка при закрытии раздачи без ставки", zap.Int64("hand", hand.ID), zap.Error(voidErr))
+		}
+		return hand, err
+	}
+
+	// при блэкджеке у игрока или дилера раздача сразу завершается
+	staked, finished, err := s.applyHand(chatID, userID, hand.ID, true, func(hand *models.BlackjackHand, draw drawFunc) (bool, error) {
+		hand.Staked = true
+		return games.IsBlackjack(hand.Player) || games.IsBlackjack(hand.Dealer), nil
+	})
+	if errors.Is(err, ErrHandFinished) {
+		// таймер успел закрыть раздачу без ставки - ставка возвращается, если таймер ещё не вернул её сам
+		if hand.Balance, err = s.refundBlackjack(hand, bet); err != nil {
+			logger.Error("ошибка при возврате ставки блэкджека", zap.Int64("hand", hand.ID), zap.Error(err))
+		}
+		return hand, errors.New("раздача не началась, ставка возвращена")
+	} else if err != nil {
+		// раздача осталась без отметки о ставке, таймер закроет её и вернёт ставку
+		return hand, err
+	}
+
+	if finished {
+		return s.payBlackjack(staked)
+	}
+	staked.Balance = hand.Balance
+	return staked, nil
+}
+
+// SetHandMessage запоминает сообщение с раздачей, чтобы обновить его при автоматическом stand
+func (s Service) SetHandMessage(chatID, userID, handID, messageID int64) error {
+	_, err := s.updateHand(chatID, userID, handID, func(hand *models.BlackjackHand, draw drawFunc) (bool, error) {
+		hand.MessageID = messageID
+		return false, nil
+	})
+	return err
+}
+
+// Hit добирает игроку карту. При переборе или 21 очке раздача завершается
+func (s Service) Hit(chatID, userID, handID int64) (models.BlackjackHand, error) {
+	return s.updateHand(chatID, userID, handID, func(hand *models.BlackjackHand, draw drawFunc) (bool, error) {
+		cards, err := draw(1)
+		if err != nil {
+			return false, err
+		}
+		hand.Player = append(hand.Player, cards...)
+		hand.ExpiresAt = time.Now().Add(constants.BlackjackTimeout).Unix()
+
+		total, _ := games.HandValue(hand.Player)
+		return total >= 21, nil
+	})
+}
+
+// Stand завершает ход игрока, дилер добирает карты
+func (s Service) Stand(chatID, userID, handID int64) (models.BlackjackHand, error) {
+	return s.updateHand(chatID, userID, handID, func(hand *models.BlackjackHand, draw drawFunc) (bool, error) {
+		return true, nil
+	})
+}
+
+// Double удваивает ставку, добирает игроку ровно одну карту и завершает его ход
+func (s Service) Double(chatID, userID, handID int64) (models.BlackjackHand, error) {
+	current, err := s.getHand(chatID, userID, handID)
+	if err != nil {
+		return current, err
+	}
+	if current.Result != "" || !current.Staked || current.Voided {
+		return current, ErrHandFinished
+	}
+	if len(current.Player) != 2 || current.Doubled {
+		return current, errors.New("удвоить ставку можно только на первых двух картах")
+	}
+
+	// первая ставка уже на счёте казино, а удвоение поступит вместе с ходом
+	if err = s.checkBlackjackCover(chatID, games.BlackjackMaxPayout(2*current.Bet, true), current.Bet); err != nil {
+		return current, err
+	}
+
+	if _, err = s.betBlackjack(current, current.Bet); err != nil {
+		return current, err
+	}
+
+	hand, _, err := s.commitHand(chatID, userID, handID, func(hand *models.BlackjackHand, draw drawFunc) (bool, error) {
+		if len(hand.Player) != 2 || hand.Doubled {
+			return false, errors.New("удвоить ставку можно только на первых двух картах")
+		}
+
+		cards, err := draw(1)
+		if err != nil {
+			return false, err
+		}
+		hand.Player = append(hand.Player, cards...)
+		hand.Bet *= 2
+		hand.Doubled = true
+		return true, nil
+	})
+	if err != nil {
+		if _, refundErr := s.refundBlackjack(current, current.Bet); refundErr != nil {
+			logger.Error("ошибка при возврате удвоения блэкджека", zap.Int64("hand", current.ID), zap.Error(refundErr))
+		}
+		return hand, err
+	}
+
+	return s.payBlackjack(hand)
+}
+
+// ExpireHands повторяет не прошедшие выплаты завершённых раздач и завершает автоматическим stand раздачи,
+// в которых игрок не сделал ход вовремя. Возвращает раздачи, которые завершились и выплачены
+func (s Service) ExpireHands() ([]models.BlackjackHand, error) {
+	hands, err := s.retryHandPayouts()
+	if err != nil {
+		return hands, err
+	}
+
+	members, err := cache.Rdb.ZRangeByScore(cache.Ctx, handOpenKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return hands, err
+	}
+
+	for _, member := range members {
+		chatID, userID, ok := parseHandMember(member)
+		if !ok {
+			cache.Rdb.ZRem(cache.Ctx, handOpenKey, member)
+			continue
+		}
+
+		// игрок мог сделать ход, пока выбирались просроченные раздачи
+		hand, err := s.updateHand(chatID, userID, 0, func(hand *models.BlackjackHand, draw drawFunc) (bool, error) {
+			if hand.ExpiresAt > time.Now().Unix() {
+				return false, errHandActive
+			}
+			return true, nil
+		})
+		if errors.Is(err, ErrHandFinished) {
+			cache.Rdb.ZRem(cache.Ctx, handOpenKey, member)
+			continue
+		} else if errors.Is(err, errHandUnstaked) {
+			// раздача, списание ставки по которой прервалось
+			if err = s.voidHand(chatID, userID, 0); err != nil {
+				logger.Error("ошибка при закрытии раздачи без ставки", zap.Int64("chat", chatID), zap.Int64("id", userID), zap.Error(err))
+			}
+			continue
+		} else if errors.Is(err, errHandActive) {
+			continue
+		} else if err != nil {
+			logger.Error("ошибка автоматического stand", zap.Int64("chat", chatID), zap.Int64("id", userID), zap.Error(err))
+			continue
+		}
+		hands = append(hands, hand)
+	}
+
+	return hands, nil
+}
+
+// voidHand закрывает раздачу, ставка по которой не отмечена: раздача помечается Voided, чтобы по ней уже нельзя
+// было начать игру, ставка возвращается, если она есть в журнале, и только потом раздача удаляется.
+// Если возврат не прошёл, раздача остаётся в bj:open и таймер повторит закрытие
+func (s Service) voidHand(chatID, userID, handID int64) error {
+	key := handKey(chatID, userID)
+
+	var hand models.BlackjackHand
+	err := cache.Rdb.Watch(cache.Ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(cache.Ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrHandFinished
+		} else if err != nil {
+			return err
+		}
+
+		hand = models.BlackjackHand{}
+		if err = json.Unmarshal(data, &hand); err != nil {
+			return err
+		}
+		if handID != 0 && hand.ID != handID {
+			return ErrHandFinished
+		}
+		if hand.Staked {
+			return errHandActive
+		}
+		if hand.Voided {
+			return nil
+		}
+
+		hand.Voided = true
+		if data, err = json.Marshal(hand); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(cache.Ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(cache.Ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, ErrHandFinished) {
+		if handID == 0 {
+			cache.Rdb.ZRem(cache.Ctx, handOpenKey, handMember(chatID, userID))
+		}
+		return nil
+	} else if errors.Is(err, errHandActive) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	staked, err := s.journaled(models.Transaction{
+		From:      hand.UserID,
+		To:        constants.CasinoID,
+		Kind:      constants.TxGame,
+		ChatID:    hand.ChatID,
+		Reference: handReference(hand.ID),
+	})
+	if err != nil {
+		return err
+	}
+	if staked {
+		if _, err = s.refundBlackjack(hand, hand.Bet); err != nil {
+			return err
+		}
+	}
+
+	pipe := cache.Rdb.TxPipeline()
+	pipe.Del(cache.Ctx, key)
+	pipe.ZRem(cache.Ctx, handOpenKey, handMember(chatID, userID))
+	_, err = pipe.Exec(cache.Ctx)
+	return err
+}
+
+// retryHandPayouts повторяет выплаты завершённых раздач, время повтора которых наступило. Выплату повторяет
+// только тот вызов, который забрал раздачу claimHandScript
+func (s Service) retryHandPayouts() ([]models.BlackjackHand, error) {
+	now := time.Now()
+	members, err := cache.Rdb.ZRangeByScore(cache.Ctx, handSettledKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var hands []models.BlackjackHand
+	for _, member := range members {
+		claimed, err := claimHandScript.Run(cache.Ctx, cache.Rdb, []string{handSettledKey}, member, now.Unix(), now.Add(handRetry).Unix()).Int()
+		if err != nil {
+			return hands, err
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		chatID, userID, ok := parseHandMember(member)
+		if !ok {
+			cache.Rdb.ZRem(cache.Ctx, handSettledKey, member)
+			continue
+		}
+
+		hand, err := s.getHand(chatID, userID, 0)
+		if errors.Is(err, ErrHandFinished) || (err == nil && hand.Result == "") {
+			// раздача истекла или уже выплачена и удалена
+			cache.Rdb.ZRem(cache.Ctx, handSettledKey, member)
+			continue
+		} else if err != nil {
+			logger.Error("ошибка при чтении завершённой раздачи", zap.Int64("chat", chatID), zap.Int64("id", userID), zap.Error(err))
+			continue
+		}
+
+		if hand, err = s.payBlackjack(hand); err != nil {
+			continue
+		}
+		hands = append(hands, hand)
+	}
+
+	return hands, nil
+}
+
+// updateHand применяет ход fn к раздаче и выплачивает выигрыш, если раздача завершилась
+func (s Service) updateHand(chatID, userID, handID int64, fn handFunc) (models.BlackjackHand, error) {
+	hand, finished, err := s.commitHand(chatID, userID, handID, fn)
+	if err != nil || !finished {
+		return hand, err
+	}
+	return s.payBlackjack(hand)
+}
+
+// drawFunc снимает n карт с башмака в транзакции хода
+type drawFunc func(n int) ([]int, error)
+
+// handFunc - ход по раздаче, true - ход игрока завершён
+type handFunc func(hand *models.BlackjackHand, draw drawFunc) (bool, error)
+
+// commitHand применяет ход игрока fn к раздаче, ставка по которой уже списана
+func (s Service) commitHand(chatID, userID, handID int64, fn handFunc) (models.BlackjackHand, bool, error) {
+	return s.applyHand(chatID, userID, handID, false, fn)
+}
+
+// applyHand применяет fn к раздаче под WATCH раздачи и башмака. Если fn вернул true, дилер добирает
+// карты и раздача получает исход: без выплаты она удаляется из Redis, с выплатой остаётся до неё в bj:settled.
+// Карты читаются с начала башмака и снимаются в том же MULTI. handID 0 - любая текущая раздача игрока.
+// staking - fn отмечает списанную ставку, иначе раздача без отметки о ставке не меняется
+func (s Service) applyHand(chatID, userID, handID int64, staking bool, fn handFunc) (models.BlackjackHand, bool, error) {
+	key := handKey(chatID, userID)
+	shoe := shoeKey(chatID)
+
+	// карт в башмаке должно хватить на ход, новый башмак под WATCH уже не положить
+	if err := s.shuffleShoe(chatID); err != nil {
+		return models.BlackjackHand{}, false, err
+	}
+
+	var hand models.BlackjackHand
+	var finished bool
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.Get(cache.Ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrHandFinished
+		} else if err != nil {
+			return err
+		}
+
+		hand = models.BlackjackHand{}
+		if err = json.Unmarshal(data, &hand); err != nil {
+			return err
+		}
+		if (handID != 0 && hand.ID != handID) || hand.Result != "" || (hand.Voided && staking) {
+			// раздача с исходом ждёт выплаты, ходить по ней нельзя
+			return ErrHandFinished
+		}
+		if !hand.Staked && !staking {
+			// в том числе закрытая раздача, возврат ставки по которой ещё не прошёл
+			return errHandUnstaked
+		}
+
+		var drawn []int
+		draw := func(n int) ([]int, error) {
+			cards, err := tx.LRange(cache.Ctx, shoe, int64(len(drawn)), int64(len(drawn)+n-1)).Result()
+			if err != nil {
+				return nil, err
+			}
+			if len(cards) < n {
+				return nil, errors.New("в башмаке кончились карты, попробуйте ещё раз")
+			}
+			for _, c := range cards {
+				card, err := strconv.Atoi(c)
+				if err != nil {
+					return nil, err
+				}
+				drawn = append(drawn, card)
+			}
+			return drawn[len(drawn)-n:], nil
+		}
+
+		finished, err = fn(&hand, draw)
+		if err != nil {
+			return err
+		}
+
+		if finished {
+			total, _ := games.HandValue(hand.Player)
+			// на блэкджек игрока дилер не добирает
+			for total <= 21 && !games.IsBlackjack(hand.Player) && games.DealerHits(hand.Dealer) {
+				cards, err := draw(1)
+				if err != nil {
+					return err
+				}
+				hand.Dealer = append(hand.Dealer, cards...)
+			}
+			hand.Result, hand.Payout = games.BlackjackSettle(hand.Player, hand.Dealer, hand.Bet)
+			hand.SettledAt = time.Now().Unix()
+		}
+
+		data, err = json.Marshal(hand)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(cache.Ctx, func(pipe redis.Pipeliner) error {
+			if len(drawn) > 0 {
+				pipe.LTrim(cache.Ctx, shoe, int64(len(drawn)), -1)
+			}
+			if finished {
+				pipe.ZRem(cache.Ctx, handOpenKey, handMember(chatID, userID))
+				if hand.Payout > 0 {
+					// раздача с выплатой не истекает: её удаляет выплата или запись в failed_payouts
+					pipe.Set(cache.Ctx, key, data, 0)
+					pipe.ZAdd(cache.Ctx, handSettledKey, redis.Z{Score: float64(time.Now().Add(handRetry).Unix()), Member: handMember(chatID, userID)})
+				} else {
+					pipe.Del(cache.Ctx, key)
+				}
+			} else {
+				pipe.Set(cache.Ctx, key, data, time.Until(time.Unix(hand.ExpiresAt, 0))+handKeep)
+				pipe.ZAdd(cache.Ctx, handOpenKey, redis.Z{Score: float64(hand.ExpiresAt), Member: handMember(chatID, userID)})
+			}
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < 3; i++ {
+		err = cache.Rdb.Watch(cache.Ctx, txf, key, shoe)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	return hand, finished, err
+}
+
+func (s Service) getHand(chatID, userID, handID int64) (models.BlackjackHand, error) {
+	var hand models.BlackjackHand
+	data, err := cache.Rdb.Get(cache.Ctx, handKey(chatID, userID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return hand, ErrHandFinished
+	} else if err != nil {
+		return hand, err
+	}
+
+	if err = json.Unmarshal(data, &hand); err != nil {
+		return hand, err
+	}
+	if handID != 0 && hand.ID != handID {
+		return hand, ErrHandFinished
+	}
+	return hand, nil
+}
+
+// payBlackjack выплачивает выигрыш завершённой раздачи из казино и удаляет её из Redis. Выплата сверяется
+// с журналом и дважды не проводится. Если выплата не прошла, раздача остаётся в bj:settled и выплата повторится
+// по таймеру, а не прошедшая за handKeep записывается в failed_payouts
+func (s Service) payBlackjack(hand models.BlackjackHand) (models.BlackjackHand, error) {
+	if hand.Payout == 0 {
+		balance, err := s.User.GetUserBalance(hand.ChatID, hand.UserID)
+		hand.Balance = balance
+		return hand, err
+	}
+
+	balance, _, err := s.payOnce(models.Transaction{
+		From:      constants.CasinoID,
+		To:        hand.UserID,
+		Amount:    hand.Payout,
+		Kind:      constants.TxGame,
+		ChatID:    hand.ChatID,
+		Reference: handReference(hand.ID),
+	})
+	if err != nil {
+		logger.Error("ошибка при выплате выигрыша блэкджека", zap.Int64("hand", hand.ID), zap.Int64("payout", hand.Payout), zap.Error(err))
+		if time.Since(time.Unix(hand.SettledAt, 0)) < handKeep {
+			return hand, fmt.Errorf("не удалось выплатить выигрыш %d зеток, выплата повторится автоматически", hand.Payout)
+		}
+
+		if failErr := s.failHandPayout(hand, err); failErr != nil {
+			logger.Error("ошибка при записи не прошедшей выплаты блэкджека", zap.Int64("hand", hand.ID), zap.Error(failErr))
+		}
+		return hand, fmt.Errorf("не удалось выплатить выигрыш %d зеток, выплата передана администратору", hand.Payout)
+	}
+	hand.Balance = balance
+
+	// если удалить раздачу не получится, повтор найдёт выплату в журнале и только удалит раздачу
+	pipe := cache.Rdb.TxPipeline()
+	pipe.Del(cache.Ctx, handKey(hand.ChatID, hand.UserID))
+	pipe.ZRem(cache.Ctx, handSettledKey, handMember(hand.ChatID, hand.UserID))
+	if _, err = pipe.Exec(cache.Ctx); err != nil {
+		logger.Error("ошибка при удалении выплаченной раздачи", zap.Int64("hand", hand.ID), zap.Error(err))
+	}
+
+	return hand, nil
+}
+
+// failHandPayout записывает выплату, которая так и не прошла, в failed_payouts и удаляет раздачу из Redis
+func (s Service) failHandPayout(hand models.BlackjackHand, cause error) error {
+	_, err := db.Conn.Exec(`INSERT INTO failed_payouts (chat_id, user_id, amount, reference, error) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (chat_id, reference, user_id) DO NOTHING`,
+		hand.ChatID, hand.UserID, hand.Payout, handReference(hand.ID), cause.Error())
+	if err != nil {
+		return err
+	}
+
+	pipe := cache.Rdb.TxPipeline()
+	pipe.Del(cache.Ctx, handKey(hand.ChatID, hand.UserID))
+	pipe.ZRem(cache.Ctx, handSettledKey, handMember(hand.ChatID, hand.UserID))
+	_, err = pipe.Exec(cache.Ctx)
+	return err
+}
+
+// checkBlackjackCover проверяет, что казино покроет выплату payout, получив ставку amount
+func (s Service) checkBlackjackCover(chatID, payout, amount int64) error {
+	balanceCasino, err := s.User.GetUserBalance(chatID, constants.CasinoID)
+	if err != nil {
+		return err
+	}
+	if maxWin := payout - amount; balanceCasino < maxWin {
+		return fmt.Errorf("у казино сейчас %d зеток, а выигрыш по этой ставке может достичь %d, уменьшите ставку", balanceCasino, maxWin)
+	}
+	return nil
+}
+
+func (s Service) betBlackjack(hand models.BlackjackHand, amount int64) (int64, error) {
+	balance, _, err := s.User.Transfer(models.Transaction{
+		From:      hand.UserID,
+		To:        constants.CasinoID,
+		Amount:    amount,
+		Kind:      constants.TxGame,
+		ChatID:    hand.ChatID,
+		Reference: handReference(hand.ID),
+	})
+	return balance, err
+}
+
+// refundBlackjack возвращает ставку amount; возврат сверяется с журналом и дважды не проводится
+func (s Service) refundBlackjack(hand models.BlackjackHand, amount int64) (int64, error) {
+	balance, _, err := s.payOnce(models.Transaction{
+		From:      constants.CasinoID,
+		To:        hand.UserID,
+		Amount:    amount,
+		Kind:      constants.TxRefund,
+		ChatID:    hand.ChatID,
+		Reference: handReference(hand.ID),
+	})
+	return balance, err
+}
+
+// shuffleShoe перемешивает башмак чата, если в нём осталось мало карт
+func (s Service) shuffleShoe(chatID int64) error {
+	left, err := cache.Rdb.LLen(cache.Ctx, shoeKey(chatID)).Result()
+	if err != nil {
+		return err
+	}
+	if left >= constants.BlackjackReshuffle {
+		return nil
+	}
+
+	seed, err := fair.NewSeed(32)
+	if err != nil {
+		return err
+	}
+
+	shoe := games.NewShoe(fair.New(seed, strconv.FormatInt(chatID, 10), 0), constants.BlackjackDecks)
+	args := make([]any, 0, len(shoe)+1)
+	args = append(args, constants.BlackjackReshuffle)
+	for _, card := range shoe {
+		args = append(args, card)
+	}
+
+	return reshuffleScript.Run(cache.Ctx, cache.Rdb, []string{shoeKey(chatID)}, args...).Err()
+}
+
+func (s Service) drawCards(chatID int64, n int) ([]int, error) {
+	cards := make([]int, 0, n)
+	for len(cards) < n {
+		card, err := cache.Rdb.LPop(cache.Ctx, shoeKey(chatID)).Int()
+		if errors.Is(err, redis.Nil) {
+			// башмак кончился посреди раздачи - перемешиваем новый
+			if err = s.shuffleShoe(chatID); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+func handKey(chatID, userID int64) string {
+	return fmt.Sprintf("chat:%d:bj:%d", chatID, userID)
+}
+
+func shoeKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:bj:shoe", chatID)
+}
+
+func handMember(chatID, userID int64) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+func parseHandMember(member string) (int64, int64, bool) {
+	chat, user, ok := strings.Cut(member, ":")
+	if !ok {
+		return 0, 0, false
+	}
+
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	userID, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return chatID, userID, true
+}
+
+func handReference(id int64) string {
+	return fmt.Sprintf("bj #%d", id)
+}
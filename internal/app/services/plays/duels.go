@@ -0,0 +1,225 @@
+package plays
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/fair"
+	"hamsterbot/pkg/logger"
+	"strings"
+	"time"
+)
+
+// Ставки дуэли лежат на счёте constants.EscrowID. Каждый перевод дуэли проводится в одной транзакции со сменой
+// её состояния, и смена выполняется только из ожидаемого состояния: деньги и состояние не расходятся,
+// а дуэль нельзя одновременно выплатить и вернуть. Все переводы дуэли записываются в журнал с reference "duel #<id>"
+
+const duelColumns = `id, chat_id, challenger_id, challenger_name, opponent_id, opponent_name, amount, status,
+	server_seed, server_seed_hash, client_seed, winner_id, result, message_id, created_at, updated_at, expires_at`
+
+// Challenge вызывает пользователя opponent на дуэль со ставкой amount. Ставка вызвавшего сразу переводится на счёт дуэлей
+func (s Service) Challenge(chatID, challengerID int64, challengerName, opponent string, amount int64) (models.Duel, error) {
+	if amount < 10 {
+		return models.Duel{}, errors.New(constants.ErrLessAmount)
+	}
+	if err := s.checkLoan(chatID, challengerID); err != nil {
+		return models.Duel{}, err
+	}
+
+	dataTo, err := s.User.GetUserByUsername(chatID, opponent)
+	if err != nil {
+		return models.Duel{}, err
+	}
+	if dataTo.ID == challengerID {
+		return models.Duel{}, errors.New("нельзя вызвать на дуэль самого себя")
+	}
+	if dataTo.ID <= constants.MaxServiceID {
+		return models.Duel{}, errors.New("пользователь не зарегистрирован")
+	}
+
+	serverSeed, err := fair.NewSeed(32)
+	if err != nil {
+		return models.Duel{}, err
+	}
+
+	var id int64
+	err = db.Conn.QueryRowx(`SELECT nextval('duels_id_seq')`).Scan(&id)
+	if err != nil {
+		logger.Error("ошибка при получении номера дуэли", zap.Error(err))
+		return models.Duel{}, err
+	}
+
+	var duel models.Duel
+	_, _, err = s.User.TransferWith(duelTransaction(chatID, id, challengerID, constants.EscrowID, amount), func(tx *sqlx.Tx) error {
+		query := `INSERT INTO duels (id, chat_id, challenger_id, challenger_name, opponent_id, opponent_name, amount, status,
+			server_seed, server_seed_hash, client_seed, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING ` + duelColumns
+		err := tx.QueryRowx(query, id, chatID, challengerID, strings.Trim(challengerName, "@"), dataTo.ID, dataTo.Username, amount,
+			constants.DuelPending, serverSeed, fair.Hash(serverSeed), fmt.Sprintf("%d:%d", challengerID, dataTo.ID),
+			time.Now().Add(constants.DuelTimeout)).StructScan(&duel)
+		if err != nil {
+			logger.Error("ошибка при добавлении записи в таблицу duels", zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return models.Duel{}, err
+	}
+
+	return duel, nil
+}
+
+// SetDuelMessage запоминает сообщение с кнопками дуэли, чтобы обновить его, когда дуэль истечёт
+func (s Service) SetDuelMessage(duelID, messageID int64) error {
+	_, err := db.Conn.Exec(`UPDATE duels SET message_id = $2 WHERE id = $1`, duelID, messageID)
+	if err != nil {
+		logger.Error("ошибка при обновлении записи в таблице duels", zap.Error(err))
+	}
+	return err
+}
+
+// AcceptDuel принимает вызов: ставка соперника вносится на счёт дуэлей, дуэль разыгрывается, и весь банк уходит
+// победителю. Переводы и завершение дуэли проводятся одной транзакцией, и только пока вызов ещё ждёт ответа
+func (s Service) AcceptDuel(duelID, opponentID int64) (models.Duel, error) {
+	duel, err := s.getDuel(duelID)
+	if err != nil {
+		return duel, err
+	}
+	if duel.Status != constants.DuelPending || duel.OpponentID != opponentID {
+		return duel, sql.ErrNoRows
+	}
+	if err = s.checkLoan(duel.ChatID, opponentID); err != nil {
+		return duel, err
+	}
+
+	winnerID, result := rollDuel(duel)
+
+	_, err = s.User.TransferBatch([]models.Transaction{
+		duelTransaction(duel.ChatID, duel.ID, opponentID, constants.EscrowID, duel.Amount),
+		duelTransaction(duel.ChatID, duel.ID, constants.EscrowID, winnerID, 2*duel.Amount),
+	}, func(tx *sqlx.Tx) error {
+		return closeDuel(tx, &duel, constants.DuelPending, constants.DuelFinished, &winnerID, result,
+			`opponent_id = $6 AND expires_at > now()`, opponentID)
+	})
+	return duel, err
+}
+
+// DeclineDuel закрывает ожидающий вызов: соперник его отклоняет, вызвавший - отменяет. Ставка возвращается вызвавшему
+// в той же транзакции, что и закрытие вызова
+func (s Service) DeclineDuel(duelID, userID int64) (models.Duel, error) {
+	duel, err := s.getDuel(duelID)
+	if err != nil {
+		return duel, err
+	}
+
+	var to, cond string
+	switch userID {
+	case duel.OpponentID:
+		to, cond = constants.DuelDeclined, `opponent_id = $6`
+	case duel.ChallengerID:
+		to, cond = constants.DuelCanceled, `challenger_id = $6`
+	default:
+		return duel, sql.ErrNoRows
+	}
+
+	_, _, err = s.User.TransferWith(duelTransaction(duel.ChatID, duel.ID, constants.EscrowID, duel.ChallengerID, duel.Amount), func(tx *sqlx.Tx) error {
+		return closeDuel(tx, &duel, constants.DuelPending, to, nil, "", cond, userID)
+	})
+	return duel, err
+}
+
+// ExpireDuels закрывает вызовы, на которые не ответили вовремя, возвращает ставки вызвавшим и отдаёт закрытые
+// дуэли, чтобы обновить их сообщения. Возврат и закрытие дуэли проводятся одной транзакцией: если возврат
+// не прошёл, вызов остаётся открытым и закроется при следующем запуске
+func (s Service) ExpireDuels() ([]models.Duel, error) {
+	var candidates []models.Duel
+	query := `SELECT ` + duelColumns + ` FROM duels WHERE status = $1 AND expires_at <= now()`
+	err := db.Conn.Select(&candidates, query, constants.DuelPending)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы duels", zap.Error(err))
+		return nil, err
+	}
+
+	var duels []models.Duel
+	var errs []error
+	for _, duel := range candidates {
+		// пока вызов ждёт ответа, на счёте дуэлей лежит только ставка вызвавшего
+		refund := duelTransaction(duel.ChatID, duel.ID, constants.EscrowID, duel.ChallengerID, duel.Amount)
+		_, _, err = s.User.TransferWith(refund, func(tx *sqlx.Tx) error {
+			// срок проверяется заново: вызов могли принять или отклонить после выборки
+			return closeDuel(tx, &duel, constants.DuelPending, constants.DuelExpired, nil, "", `expires_at <= now()`)
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // дуэль успели принять или отклонить
+		} else if err != nil {
+			logger.Error("не удалось закрыть просроченную дуэль", zap.Int64("duel", duel.ID), zap.Error(err))
+			errs = append(errs, err)
+			continue
+		}
+
+		duels = append(duels, duel)
+	}
+
+	return duels, errors.Join(errs...)
+}
+
+func (s Service) getDuel(duelID int64) (models.Duel, error) {
+	var duel models.Duel
+	err := db.Conn.Get(&duel, `SELECT `+duelColumns+` FROM duels WHERE id = $1`, duelID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("ошибка при выборке данных из таблицы duels", zap.Error(err))
+	}
+	return duel, err
+}
+
+// closeDuel переводит дуэль из состояния from в to и записывает победителя и результат. Условие cond ссылается
+// на args как на $6, $7 и т.д. Если дуэль уже не в состоянии from или не подходит под cond, возвращается
+// sql.ErrNoRows, и транзакция перевода, в которой вызвана closeDuel, откатывается
+func closeDuel(q sqlx.Queryer, duel *models.Duel, from, to string, winnerID *int64, result, cond string, args ...interface{}) error {
+	query := `UPDATE duels SET status = $3, winner_id = $4, result = $5, updated_at = now()
+		WHERE id = $1 AND status = $2 AND ` + cond + ` RETURNING ` + duelColumns
+	err := q.QueryRowx(query, append([]interface{}{duel.ID, from, to, winnerID, result}, args...)...).StructScan(duel)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("ошибка при обновлении записи в таблице duels", zap.Error(err))
+	}
+	return err
+}
+
+func duelTransaction(chatID, duelID, from, to, amount int64) models.Transaction {
+	return models.Transaction{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Kind:      constants.TxDuel,
+		ChatID:    chatID,
+		Reference: duelReference(duelID),
+	}
+}
+
+// rollDuel бросает по два кубика за каждого участника на генераторе дуэли, пока суммы не разойдутся.
+// Возвращает победителя и запись бросков вида "3+5:6+1"
+func rollDuel(duel models.Duel) (int64, string) {
+	rng := fair.New(duel.ServerSeed, duel.ClientSeed, duel.ID)
+
+	var throws []string
+	for {
+		c1, c2 := int64(rng.Intn(6)+1), int64(rng.Intn(6)+1)
+		o1, o2 := int64(rng.Intn(6)+1), int64(rng.Intn(6)+1)
+		throws = append(throws, fmt.Sprintf("%d+%d:%d+%d", c1, c2, o1, o2))
+
+		if c1+c2 > o1+o2 {
+			return duel.ChallengerID, strings.Join(throws, ",")
+		} else if c1+c2 < o1+o2 {
+			return duel.OpponentID, strings.Join(throws, ",")
+		}
+	}
+}
+
+func duelReference(id int64) string {
+	return fmt.Sprintf("duel #%d", id)
+}
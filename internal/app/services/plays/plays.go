@@ -4,412 +4,324 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/redis/go-redis/v9"
+	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/games"
 	"hamsterbot/internal/app/models"
 	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/fair"
 	"hamsterbot/pkg/logger"
 	"math/rand"
+	"strconv"
 	"time"
 )
 
 type User interface {
-	GetUserByUsername(username string) (map[string]interface{}, error)
-	GetUserBalance(id int64) (int64, error)
-	SetUserBalance(id int64, balance int64) (int64, error)
+	GetUserByUsername(chatID int64, username string) (models.User, error)
+	GetUserBalance(chatID, id int64) (int64, error)
+	Transfer(t models.Transaction) (int64, int64, error)
+	TransferWith(t models.Transaction, fn func(tx *sqlx.Tx) error) (int64, int64, error)
+	TransferBatch(ts []models.Transaction, fn func(tx *sqlx.Tx) error) (map[int64]int64, error)
+	GetUserMute(chatID, id int64, kind string) (models.Mute, error)
 }
 
 type Mute interface {
 	GetAmount(typeMute string, duration time.Duration) (int, error)
 	GetDuration(durationStr string) (time.Duration, error)
+	Save(record models.MuteRecord, current models.Mute, duration time.Duration, payment models.Transaction) (models.Mute, int64, int64, error)
+	Lift(kind string, targetID int64, payment models.Transaction) (int64, int64, error)
+}
+
+type Seed interface {
+	Next(userID int64) (*fair.RNG, models.Round, error)
+	ReserveRound() (int64, error)
+	SaveRound(tx *sqlx.Tx, round models.Round) error
+	GetRound(userID, roundID int64) (models.Round, models.Seed, error)
+}
+
+type Admin interface {
+	HasPermission(userID int64, permission string) bool
+}
+
+type Loan interface {
+	IsDefaulted(chatID, userID int64) (bool, error)
 }
 
 type Service struct {
-	User User
-	Mute Mute
+	User  User
+	Mute  Mute
+	Seed  Seed
+	Admin Admin
+	Loan  Loan
 }
 
-func New(User User, Mute Mute) *Service {
+func New(User User, Mute Mute, Seed Seed, Admin Admin, Loan Loan) *Service {
 	return &Service{
-		User: User,
-		Mute: Mute,
+		User:  User,
+		Mute:  Mute,
+		Seed:  Seed,
+		Admin: Admin,
+		Loan:  Loan,
 	}
 }
 
-func calculateWinChance(balanceCasino, amount int64) int64 {
-	maxChance := 100            // Максимальный шанс выигрыша в процентах (100%)
-	minChance := 0              // Минимальный шанс выигрыша в процентах (0%)
-	maxBalance := int64(100000) // Баланс для 100% шанса выигрыша
-	minBalance := int64(25000)  // Баланс для 0% шанса выигрыша
+// checkLoan не пускает в игры пользователя с просроченным кредитом. Без сервиса кредитов (в симуляции) проверки нет
+func (s Service) checkLoan(chatID, userID int64) error {
+	if s.Loan == nil {
+		return nil
+	}
 
-	chance := int64(float64(balanceCasino-minBalance) / float64(maxBalance-minBalance) * float64(maxChance-minChance))
-	if balanceCasino >= maxBalance {
-		chance = 100
+	defaulted, err := s.Loan.IsDefaulted(chatID, userID)
+	if err != nil {
+		return err
 	}
-	if balanceCasino <= minBalance || balanceCasino <= amount*10 {
-		chance = 0
+	if defaulted {
+		return errors.New(constants.ErrLoanDefault)
 	}
-	return chance
+	return nil
 }
 
-func (s Service) processLoss(id, amount, balance, balanceCasino int64) (int64, error) {
-	newBalance, err := s.User.SetUserBalance(id, balance-amount)
-	if err != nil {
-		return 0, err
+var errPaid = errors.New("выигрыш уже выплачен")
+
+// payOnce выплачивает выигрыш t из казино, если по журналу его ещё не выплачивали: выплата с тем же reference
+// тому же игроку откатывается в транзакции перевода. Перевод блокирует строки счетов, поэтому параллельная
+// выплата дождётся первой и увидит её в журнале. Возвращает баланс игрока и false, если выигрыш был выплачен раньше
+func (s Service) payOnce(t models.Transaction) (int64, bool, error) {
+	_, balance, err := s.User.TransferWith(t, func(tx *sqlx.Tx) error {
+		var paid int
+		err := tx.QueryRowx(`SELECT count(*) FROM transactions
+			WHERE chat_id = $1 AND reference = $2 AND from_id = $3 AND to_id = $4 AND kind = $5`,
+			t.ChatID, t.Reference, t.From, t.To, t.Kind).Scan(&paid)
+		if err != nil {
+			logger.Error("ошибка при выборке данных из таблицы transactions", zap.Error(err))
+			return err
+		}
+		// в журнале уже есть и эта выплата
+		if paid > 1 {
+			return errPaid
+		}
+		return nil
+	})
+	if errors.Is(err, errPaid) {
+		return balance, false, nil
 	}
-	_, err = s.User.SetUserBalance(1, balanceCasino+amount)
+	return balance, err == nil, err
+}
+
+// journaled сообщает, есть ли в журнале перевод с теми же участниками, видом и reference, что у t
+func (s Service) journaled(t models.Transaction) (bool, error) {
+	var exists bool
+	err := db.Conn.QueryRowx(`SELECT EXISTS(SELECT 1 FROM transactions
+		WHERE chat_id = $1 AND reference = $2 AND from_id = $3 AND to_id = $4 AND kind = $5)`,
+		t.ChatID, t.Reference, t.From, t.To, t.Kind).Scan(&exists)
 	if err != nil {
-		return 0, err
+		logger.Error("ошибка при выборке данных из таблицы transactions", zap.Error(err))
 	}
-	return newBalance, nil
+	return exists, err
 }
 
-func (s Service) processWin(id, amount, newAmount, balance, balanceCasino int64) (int64, error) {
-	newBalance, err := s.User.SetUserBalance(id, balance+newAmount-amount)
+// processLoss и processWin проводят ставку раунда вместе с его записью: раунд сохраняется в транзакции перевода,
+// и если перевод не прошёл, в rounds не остаётся раунда, по которому не двигались деньги
+func (s Service) processLoss(id, amount, chatID int64, round models.Round) (int64, error) {
+	newBalance, _, err := s.User.TransferWith(models.Transaction{
+		From:      id,
+		To:        constants.CasinoID,
+		Amount:    amount,
+		Kind:      constants.TxGame,
+		ChatID:    chatID,
+		Reference: roundReference(round),
+	}, s.saveRound(round))
 	if err != nil {
 		return 0, err
 	}
-	_, err = s.User.SetUserBalance(1, balanceCasino-newAmount+amount)
+	return newBalance, nil
+}
+
+func (s Service) processWin(id, amount, newAmount, chatID int64, round models.Round) (int64, error) {
+	_, newBalance, err := s.User.TransferWith(models.Transaction{
+		From:      constants.CasinoID,
+		To:        id,
+		Amount:    newAmount - amount,
+		Kind:      constants.TxGame,
+		ChatID:    chatID,
+		Reference: roundReference(round),
+	}, s.saveRound(round))
 	if err != nil {
 		return 0, err
 	}
 	return newBalance, nil
 }
 
-func (s Service) Slots(id, amount int64) (bool, bool, []string, int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
-	if err != nil {
-		return false, true, nil, 0, 0, err
+func (s Service) saveRound(round models.Round) func(tx *sqlx.Tx) error {
+	return func(tx *sqlx.Tx) error {
+		return s.Seed.SaveRound(tx, round)
 	}
+}
 
-	if balance < amount {
-		return false, true, nil, 0, balance, errors.New(constants.ErrLackBalance)
-	}
+func roundReference(round models.Round) string {
+	return fmt.Sprintf("%s #%d", round.Game, round.ID)
+}
 
-	symbols := []string{
-		"🍒", "🍒", "🍒", "🍒", "🍒",
-		"🍋", "🍋", "🍋", "🍋", "🍋",
-		"🍉", "🍉", "🍉", "🍉", "🍉",
-		"🍇", "🍇", "🍇", "🍇", "🍇",
-		"🔔", "🔔", "🔔",
-		"7️⃣",
+// Play проверяет баланс, разыгрывает раунд игры g на честном генераторе, сохраняет раунд
+// и проводит выигрыш или проигрыш через счёт казино
+func (s Service) Play(g games.Game, id, chatID int64, bet games.Bet) (games.Result, error) {
+	if err := s.checkLoan(chatID, id); err != nil {
+		return games.Result{Bet: bet}, err
 	}
 
-	balanceCasino, err := s.User.GetUserBalance(1)
+	balance, err := s.User.GetUserBalance(chatID, id)
 	if err != nil {
-		return false, true, nil, 0, 0, err
-	}
-
-	var newAmount, newBalance int64
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	result := []string{
-		symbols[rng.Intn(len(symbols))],
-		symbols[rng.Intn(len(symbols))],
-		symbols[rng.Intn(len(symbols))],
-	}
-	chance := calculateWinChance(balanceCasino, amount)
-
-	randomNumber := rng.Intn(100)
-	if int64(randomNumber) > chance { // проигрыш
-		for {
-			if (result[0] == result[1] && result[1] == result[2]) || (result[0] == result[1] || result[1] == result[2]) {
-				result = []string{
-					symbols[rng.Intn(len(symbols))],
-					symbols[rng.Intn(len(symbols))],
-					symbols[rng.Intn(len(symbols))],
-				}
-			} else {
-				break
-			}
-		}
-
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, nil, 0, 0, err
-		}
-	} else if result[0] == result[1] || result[1] == result[2] {
-		newAmount = amount * 2
-
-		if result[0] == result[1] && result[1] == result[2] {
-			switch result[0] {
-			case "7️⃣":
-				newAmount = amount * 100
-			case "🔔":
-				newAmount = amount * 20
-			default:
-				newAmount = amount * 10
-			}
-		}
-
-		newBalance, err = s.processWin(id, amount, newAmount, balance, balanceCasino)
-		if err != nil {
-			return false, true, nil, 0, 0, err
-		}
-	} else {
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, nil, 0, 0, err
-		}
+		return games.Result{}, err
 	}
 
-	return newAmount > 0, int64(randomNumber) > chance, result, amount, newBalance, nil
-}
+	if balance < bet.Amount {
+		return games.Result{Bet: bet, Balance: balance}, errors.New(constants.ErrLackBalance)
+	}
 
-func (s Service) RouletteNum(id, number, amount int64) (bool, bool, int64, int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
+	// ставка принимается, только если казино покроет самый крупный выигрыш по ней: исход раунда
+	// зависит лишь от сидов, и выигрыш не может сорваться из-за баланса казино
+	pt := games.CurrentPaytable()
+	balanceCasino, err := s.User.GetUserBalance(chatID, constants.CasinoID)
 	if err != nil {
-		return false, true, 0, 0, 0, err
+		return games.Result{}, err
 	}
-
-	if balance < amount {
-		return false, true, 0, 0, balance, errors.New(constants.ErrLackBalance)
+	if maxWin := g.MaxPayout(pt, bet) - bet.Amount; balanceCasino < maxWin {
+		return games.Result{Bet: bet, Balance: balance}, fmt.Errorf("у казино сейчас %d зеток, а выигрыш по этой ставке может достичь %d, уменьшите ставку", balanceCasino, maxWin)
 	}
 
-	balanceCasino, err := s.User.GetUserBalance(1)
+	rng, round, err := s.Seed.Next(id)
 	if err != nil {
-		return false, true, 0, 0, 0, err
-	}
-
-	var newAmount, newBalance int64
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	chance := calculateWinChance(balanceCasino, amount)
-	result := rng.Intn(36)
-
-	randomNumber := rng.Intn(100)
-	if int64(randomNumber) > chance {
-		for {
-			if int64(result+1) == number {
-				result = rng.Intn(36)
-			} else {
-				break
-			}
-		}
+		return games.Result{}, err
+	}
 
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, 0, 0, 0, err
-		}
-	} else if int64(result+1) == number {
-		newAmount = amount * 35
+	round.Paytable = pt.Version
+	outcome := g.Resolve(rng, pt, bet)
 
-		newBalance, err = s.processWin(id, amount, newAmount, balance, balanceCasino)
-		if err != nil {
-			return false, true, 0, 0, 0, err
-		}
+	round.Game = g.Name()
+	round.Bet = strconv.FormatInt(bet.Choice, 10)
+	round.Amount = bet.Amount
+	round.Payout = outcome.Payout
+	round.Result = outcome.Result
+	round.ID, err = s.Seed.ReserveRound()
+	if err != nil {
+		return games.Result{}, err
+	}
+
+	if outcome.Payout > 0 {
+		balance, err = s.processWin(id, bet.Amount, outcome.Payout, chatID, round)
 	} else {
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, 0, 0, 0, err
-		}
+		balance, err = s.processLoss(id, bet.Amount, chatID, round)
+	}
+	if err != nil {
+		return games.Result{}, err
 	}
 
-	return newAmount > 0, int64(randomNumber) > chance, int64(result + 1), newAmount, newBalance, nil
+	return games.Result{Bet: bet, Outcome: outcome, RoundID: round.ID, Balance: balance}, nil
 }
 
-func (s Service) RouletteColor(id int64, color int64, amount int64) (bool, bool, string, int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
+// Verify пересчитывает результат раунда по раскрытому серверному сиду.
+// Возвращает раунд, сид и пересчитанный результат, который должен совпасть с round.Result.
+func (s Service) Verify(userID, roundID int64) (models.Round, models.Seed, string, error) {
+	round, seed, err := s.Seed.GetRound(userID, roundID)
 	if err != nil {
-		return false, true, "", 0, 0, err
+		return models.Round{}, models.Seed{}, "", err
 	}
-
-	if balance < amount {
-		return false, true, "", 0, balance, errors.New(constants.ErrLackBalance)
+	if seed.ServerSeed == "" {
+		return round, seed, "", errors.New("серверный сид этого раунда ещё не раскрыт, смените его командой /seed rotate")
 	}
 
-	balanceCasino, err := s.User.GetUserBalance(1)
-	if err != nil {
-		return false, true, "", 0, 0, err
-	}
-
-	var newAmount, newBalance int64
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	chance := calculateWinChance(balanceCasino, amount)
-	result := rng.Intn(36)
-
-	randomNumber := rng.Intn(100)
-	if int64(randomNumber) > chance {
-		for {
-			if (result+1 == 0 && color == 0) || ((result+1)%2 == 0 && color == 1) || ((result+1)%2 != 0 && color == 2) {
-				result = rng.Intn(36)
-			} else {
-				break
-			}
-		}
+	g := games.Get(round.Game)
+	if g == nil {
+		return round, seed, "", errors.New("неизвестная игра")
+	}
 
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
+	var choice int64
+	if round.Bet != "" {
+		choice, err = strconv.ParseInt(round.Bet, 10, 64)
 		if err != nil {
-			return false, true, "", 0, 0, err
-		}
-	} else {
-		if result+1 == 0 && color == 0 { // зеленое
-			newAmount = amount * 35
-		} else if (result+1)%2 == 0 && color == 1 { // черное
-			newAmount = amount * 2
-		} else if (result+1)%2 != 0 && color == 2 { // красное
-			newAmount = amount * 2
-		}
-
-		if newAmount != 0 {
-			newBalance, err = s.processWin(id, amount, newAmount, balance, balanceCasino)
-			if err != nil {
-				return false, true, "", 0, 0, err
-			}
-		} else {
-			newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-			if err != nil {
-				return false, true, "", 0, 0, err
-			}
+			return round, seed, "", err
 		}
 	}
 
-	var colorStr string
-	if result+1 == 0 { // зеленое
-		colorStr = fmt.Sprintf("🟩%d", result+1)
-	} else if (result+1)%2 == 0 { // черное
-		colorStr = fmt.Sprintf("⬛%d", result+1)
-	} else if (result+1)%2 != 0 { // красное
-		colorStr = fmt.Sprintf("🟥%d", result+1)
+	pt, err := s.paytable(round.Paytable)
+	if err != nil {
+		return round, seed, "", err
 	}
 
-	return newAmount > 0, int64(randomNumber) > chance, colorStr, newAmount, newBalance, nil
+	outcome := g.Resolve(fair.New(seed.ServerSeed, seed.ClientSeed, round.Nonce), pt, games.Bet{Amount: round.Amount, Choice: choice})
+
+	return round, seed, outcome.Result, nil
 }
 
-func (s Service) Dice(id, number, amount int64) (bool, bool, []int64, int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
+// LoadPaytable загружает таблицу выплат из файла, сохраняет её копию для проверки раундов через /verify
+// и делает действующей. Возвращает отчёт с теоретическим RTP игр.
+func (s Service) LoadPaytable(path string) (string, error) {
+	pt, err := games.LoadPaytable(path)
 	if err != nil {
-		return false, true, nil, 0, 0, err
+		return "", err
 	}
 
-	if balance < amount {
-		return false, true, nil, 0, balance, errors.New(constants.ErrLackBalance)
+	body, err := json.Marshal(pt)
+	if err != nil {
+		return "", err
 	}
-
-	balanceCasino, err := s.User.GetUserBalance(1)
+	_, err = db.Conn.Exec(`INSERT INTO paytables (version, body) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING`, pt.Version, body)
 	if err != nil {
-		return false, true, nil, 0, 0, err
-	}
-
-	var newAmount, newBalance int64
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	chance := calculateWinChance(balanceCasino, amount)
-	resultOne := rng.Intn(6) + 1
-	resultTwo := rng.Intn(6) + 1
-	result := []int64{int64(resultOne), int64(resultTwo)}
-
-	randomNumber := rng.Intn(100)
-	if int64(randomNumber) > chance {
-		for {
-			if int64(resultOne+resultTwo) == number {
-				resultOne = rng.Intn(6) + 1
-				resultTwo = rng.Intn(6) + 1
-				result = []int64{int64(resultOne), int64(resultTwo)}
-			} else {
-				break
-			}
-		}
+		logger.Error("ошибка при добавлении таблицы выплат в таблицу paytables", zap.Error(err))
+		return "", err
+	}
 
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, nil, 0, 0, err
-		}
-	} else if int64(resultOne+resultTwo) == number {
-		newAmount = amount * 12
+	games.SetPaytable(pt)
+	logger.Info("таблица выплат загружена", zap.String("version", pt.Version), zap.String("path", path))
 
-		newBalance, err = s.processWin(id, amount, newAmount, balance, balanceCasino)
-		if err != nil {
-			return false, true, nil, 0, 0, err
-		}
-	} else {
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, nil, 0, 0, err
-		}
-	}
+	return pt.Report(), nil
+}
 
-	return newAmount > 0, int64(randomNumber) > chance, result, newAmount, newBalance, nil
+// GetPaytableReport возвращает отчёт по действующей таблице выплат
+func (s Service) GetPaytableReport() string {
+	return games.CurrentPaytable().Report()
 }
 
-func (s Service) RockPaperScissors(id, number, amount int64) (bool, bool, string, int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
-	if err != nil {
-		return false, true, "", 0, 0, err
+// paytable возвращает таблицу выплат, по которой был сыгран раунд
+func (s Service) paytable(version string) (*games.Paytable, error) {
+	if pt := games.CurrentPaytable(); pt.Version == version {
+		return pt, nil
 	}
-
-	if balance < amount {
-		return false, true, "", 0, balance, errors.New(constants.ErrLackBalance)
+	if version == "" { // раунды, сыгранные до появления таблицы выплат
+		return games.DefaultPaytable(), nil
 	}
 
-	balanceCasino, err := s.User.GetUserBalance(1)
+	var body []byte
+	err := db.Conn.QueryRowx(`SELECT body FROM paytables WHERE version = $1`, version).Scan(&body)
 	if err != nil {
-		return false, true, "", 0, 0, err
-	}
-
-	var newAmount, newBalance int64
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	chance := calculateWinChance(balanceCasino, amount)
-	result := rng.Intn(3) + 1
-
-	randomNumber := rng.Intn(100)
-	if int64(randomNumber) > chance {
-		for {
-			if int64(result) == number {
-				result = rng.Intn(3) + 1
-			} else {
-				break
-			}
-		}
-
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, "", 0, 0, err
-		}
-	} else if int64(result) == number {
-		newAmount = amount * 3
-
-		newBalance, err = s.processWin(id, amount, newAmount, balance, balanceCasino)
-		if err != nil {
-			return false, true, "", 0, 0, err
-		}
-	} else {
-		newBalance, err = s.processLoss(id, amount, balance, balanceCasino)
-		if err != nil {
-			return false, true, "", 0, 0, err
-		}
+		return nil, fmt.Errorf("таблица выплат %s не найдена: %w", version, err)
 	}
 
-	var choice string
-	switch result {
-	case 1:
-		choice = "камень"
-	case 2:
-		choice = "ножницы"
-	case 3:
-		choice = "бумага"
-	}
-
-	return newAmount > 0, int64(randomNumber) > chance, choice, newAmount, newBalance, nil
+	return games.ParsePaytable(body)
 }
 
-func (s Service) Steal(to string, from string, amount int) (bool, int64, error) {
-	dataTo, err := s.User.GetUserByUsername(to)
+func (s Service) Steal(to string, from string, amount int, chatID int64) (bool, int64, error) {
+	dataTo, err := s.User.GetUserByUsername(chatID, to)
 	if err != nil {
 		return false, 0, err
 	}
 
-	dataFrom, err := s.User.GetUserByUsername(from)
+	dataFrom, err := s.User.GetUserByUsername(chatID, from)
 	if err != nil {
 		return false, 0, err
 	}
 
-	balanceTo := dataTo["balance"].(int64)
-	balanceFrom := dataFrom["balance"].(int64)
+	balanceTo := dataTo.Balance
+	balanceFrom := dataFrom.Balance
 
-	if dataTo["id"].(int64) == dataFrom["id"].(int64) {
+	if dataTo.ID == dataFrom.ID {
 		return false, balanceFrom, errors.New("нельзя украсть деньги у самого себя")
 	}
 
-	cacheKey := fmt.Sprintf("user:%d:steal", dataTo["id"].(int64))
+	// перезарядка своя в каждом чате: экономики чатов независимы
+	cacheKey := fmt.Sprintf("user:%d:%d:steal", chatID, dataTo.ID)
 	exists, err := cache.Rdb.Exists(cache.Ctx, cacheKey).Result()
 	if err != nil {
 		logger.Warn("Ошибка проверки наличия ключа в кеше", zap.Error(err))
@@ -431,7 +343,7 @@ func (s Service) Steal(to string, from string, amount int) (bool, int64, error)
 	if chance < 0.0 {
 		chance = 0.0
 	}
-	if dataFrom["id"].(int64) == 1230045591 {
+	if s.Admin.HasPermission(dataFrom.ID, constants.PermSteal) {
 		chance = 1.0
 	}
 	randomNumber := rand.Float64()
@@ -442,19 +354,28 @@ func (s Service) Steal(to string, from string, amount int) (bool, int64, error)
 	}
 
 	if randomNumber < chance/5 {
-		balance, err := s.User.SetUserBalance(dataFrom["id"].(int64), balanceFrom+int64(amount))
-		if err != nil {
-			return false, balanceFrom, err
-		}
-
-		_, err = s.User.SetUserBalance(dataTo["id"].(int64), balanceTo-int64(amount))
+		_, balance, err := s.User.Transfer(models.Transaction{
+			From:      dataTo.ID,
+			To:        dataFrom.ID,
+			Amount:    int64(amount),
+			Kind:      constants.TxSteal,
+			ChatID:    chatID,
+			Reference: "success",
+		})
 		if err != nil {
 			return false, balanceFrom, err
 		}
 
 		return true, balance, nil
 	} else {
-		balance, err := s.User.SetUserBalance(dataFrom["id"].(int64), balanceFrom-int64(amount/4))
+		balance, _, err := s.User.Transfer(models.Transaction{
+			From:      dataFrom.ID,
+			To:        constants.SystemID,
+			Amount:    int64(amount / 4),
+			Kind:      constants.TxSteal,
+			ChatID:    chatID,
+			Reference: "fine @" + dataTo.Username,
+		})
 		if err != nil {
 			return false, balanceFrom, err
 		}
@@ -463,115 +384,78 @@ func (s Service) Steal(to string, from string, amount int) (bool, int64, error)
 	}
 }
 
-func (s Service) SelfMute(id int64, durationStr string) (int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
+func (s Service) SelfMute(id int64, durationStr string, chatID int64) (int64, int64, string, error) {
+	_, err := s.User.GetUserBalance(chatID, id)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
 	duration, err := s.Mute.GetDuration(durationStr)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
 	amount, err := s.Mute.GetAmount("selfmute", duration)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
-	var mute models.Mute
-	cacheKey := fmt.Sprintf("user:%d:selfmute", id)
-	jsonMute, err := cache.Rdb.Get(cache.Ctx, cacheKey).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return 0, 0, err
+	mute, err := s.User.GetUserMute(chatID, id, constants.SelfMuteKind)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	reward := models.Transaction{
+		From:      constants.SystemID,
+		To:        id,
+		Amount:    int64(amount),
+		Kind:      constants.TxSelfMute,
+		ChatID:    chatID,
+		Reference: durationStr,
+	}
+	mute, _, newBalance, err := s.Mute.Save(models.MuteRecord{
+		Kind:     constants.SelfMuteKind,
+		IssuerID: id,
+		TargetID: id,
+		ChatID:   chatID,
+		Price:    int64(amount),
+	}, mute, duration, reward)
+	if err != nil {
+		return newBalance, 0, "", err
 	}
 
-	if jsonMute != "" {
-		err = json.Unmarshal([]byte(jsonMute), &mute)
-		if err != nil {
-			return 0, 0, err
-		}
-
-		if mute != (models.Mute{}) {
-			jsonStartMute, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", mute.StartMute)
-			if err != nil {
-				return 0, 0, err
-			}
-			jsonDuration := time.Duration(mute.Duration)
-
-			startMute := time.Now().UTC()
-			oldDuration := startMute.Sub(jsonStartMute)
-
-			jsonDuration -= oldDuration
-			jsonDuration += duration
-			jsonStartMute = startMute
-
-			mute.StartMute = fmt.Sprint(jsonStartMute)
-			mute.Duration = int64(jsonDuration)
-		} else {
-			mute.StartMute = fmt.Sprint(time.Now().UTC())
-			mute.Duration = int64(duration)
-		}
-	} else {
-		mute.StartMute = fmt.Sprint(time.Now().UTC())
-		mute.Duration = int64(duration)
-	}
+	return newBalance, int64(amount), mute.Mode, nil
+}
 
-	newBalance, err := s.User.SetUserBalance(id, balance+int64(amount))
+func (s Service) SelfUnmute(id int64, chatID int64) (int64, int64, error) {
+	_, err := s.User.GetUserBalance(chatID, id)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	strMute, err := json.Marshal(mute)
-	err = cache.Rdb.Set(cache.Ctx, cacheKey, strMute, time.Duration(mute.Duration)).Err()
+	mute, err := s.User.GetUserMute(chatID, id, constants.SelfMuteKind)
 	if err != nil {
-		return 0, 0, errors.New("неизвестная ошибка, обратитесь к администратору")
+		return 0, 0, err
+	}
+	if mute == (models.Mute{}) {
+		return 0, 0, errors.New("вы не в муте")
 	}
 
-	return newBalance, int64(amount), nil
-}
-
-func (s Service) SelfUnmute(id int64) (int64, int64, error) {
-	balance, err := s.User.GetUserBalance(id)
+	amount, err := s.Mute.GetAmount("selfmute", time.Duration(mute.Duration))
 	if err != nil {
 		return 0, 0, err
 	}
 
-	var mute models.Mute
-	cacheKey := fmt.Sprintf("user:%d:selfmute", id)
-	jsonMute, err := cache.Rdb.Get(cache.Ctx, cacheKey).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return 0, 0, err
+	payment := models.Transaction{
+		From:   id,
+		To:     constants.SystemID,
+		Amount: int64(amount),
+		Kind:   constants.TxSelfUnmute,
+		ChatID: chatID,
 	}
-
-	var amount int
-	var newBalance int64
-	if jsonMute != "" {
-		err = json.Unmarshal([]byte(jsonMute), &mute)
-		if err != nil {
-			return 0, 0, err
-		}
-
-		if mute != (models.Mute{}) {
-			amount, err = s.Mute.GetAmount("selfmute", time.Duration(mute.Duration))
-			if err != nil {
-				return 0, 0, err
-			}
-
-			newBalance, err = s.User.SetUserBalance(id, balance-int64(amount))
-			if err != nil {
-				return 0, 0, err
-			}
-
-			err = cache.Rdb.Del(cache.Ctx, cacheKey).Err()
-			if err != nil {
-				return 0, 0, err
-			}
-		} else {
-			return 0, 0, errors.New("вы не в муте")
-		}
-	} else {
-		return 0, 0, errors.New("вы не в муте")
+	newBalance, _, err := s.Mute.Lift(constants.SelfMuteKind, id, payment)
+	if err != nil {
+		return newBalance, int64(amount), err
 	}
 
 	return newBalance, int64(amount), nil
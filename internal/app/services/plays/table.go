@@ -0,0 +1,359 @@
+package plays
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/games"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/fair"
+	"hamsterbot/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// Раунд стола хранится в Redis: хэш chat:<chat>:table с состоянием, список chat:<chat>:table:bets со ставками
+// и общее для всех чатов множество table:open, где вес - время вращения. По нему после перезапуска
+// бота находятся раунды, которые пора разыграть. Ставки списываются в казино сразу при приёме,
+// выигрыши выплачиваются из казино после вращения по таблице выплат, с которой раунд был открыт.
+// Все переводы раунда идут с reference "table #<id>". Разыгрываемый раунд переходит из table:open
+// в table:spinning, где вес - время следующей попытки выплат. Состояние раунда удаляется только после
+// всех выплат, поэтому раунд, выплаты которого не прошли или прервались, разыгрывается повторно с тем же
+// результатом. Выплата, которая уже есть в журнале, повторно не проводится, так что доплачивается только оставшимся
+
+// tableKeep - сколько состояние раунда живёт в Redis после времени вращения, если его никто не разыграл
+const tableKeep = 24 * time.Hour
+
+// tableRetry - через сколько повторяются выплаты раунда, если они не прошли или разыгрывающий вызов не завершился
+const tableRetry = time.Minute
+
+const (
+	tableOpenKey     = "table:open"
+	tableSpinningKey = "table:spinning"
+	tableRoundKey    = "table:round"
+)
+
+var ErrTableClosed = errors.New(constants.ErrTableClosed)
+
+// openTableScript открывает раунд, только если в чате нет открытого и выплаты прошлого раунда завершены.
+// KEYS: table:open, состояние, ставки, table:spinning. ARGV: чат, время вращения, время жизни состояния в секундах, поля состояния
+var openTableScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then return 0 end
+if redis.call('ZSCORE', KEYS[4], ARGV[1]) then return -1 end
+redis.call('DEL', KEYS[2], KEYS[3])
+redis.call('HSET', KEYS[2], unpack(ARGV, 4))
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// betTableScript принимает ставки, только если раунд ещё открыт и казино покроет все выигрыши раунда.
+// KEYS: table:open, состояние, ставки. ARGV: чат, раунд, текущее время, возможная выплата ставок, баланс казино, ставки
+var betTableScript = redis.NewScript(`
+local ends = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not ends or tonumber(ends) <= tonumber(ARGV[3]) then return -1 end
+if redis.call('HGET', KEYS[2], 'id') ~= ARGV[2] then return -1 end
+local exposure = tonumber(redis.call('HGET', KEYS[2], 'exposure') or '0') + tonumber(ARGV[4])
+if exposure > tonumber(ARGV[5]) then return -2 end
+redis.call('HSET', KEYS[2], 'exposure', exposure)
+redis.call('RPUSH', KEYS[3], unpack(ARGV, 6))
+local ttl = redis.call('TTL', KEYS[2])
+if ttl > 0 then redis.call('EXPIRE', KEYS[3], ttl) end
+return 1
+`)
+
+// claimTableScript забирает раунд на розыгрыш: закрытый по времени раунд из table:open или раунд из table:spinning,
+// время повтора которого наступило, и откладывает следующую попытку на время повтора.
+// KEYS: table:open, table:spinning. ARGV: чат, текущее время, время следующей попытки
+var claimTableScript = redis.NewScript(`
+local ends = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if ends and tonumber(ends) <= tonumber(ARGV[2]) then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+else
+	local retry = redis.call('ZSCORE', KEYS[2], ARGV[1])
+	if not retry or tonumber(retry) > tonumber(ARGV[2]) then return 0 end
+end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+// OpenTable открывает в чате раунд стола рулетки, ставки принимаются duration
+func (s Service) OpenTable(chatID, userID int64, username string, duration time.Duration) (models.TableRound, error) {
+	serverSeed, err := fair.NewSeed(32)
+	if err != nil {
+		return models.TableRound{}, err
+	}
+
+	id, err := cache.Rdb.Incr(cache.Ctx, tableRoundKey).Result()
+	if err != nil {
+		return models.TableRound{}, err
+	}
+
+	round := models.TableRound{
+		ID:             id,
+		ChatID:         chatID,
+		OpenedBy:       userID,
+		OpenedName:     username,
+		ServerSeed:     serverSeed,
+		ServerSeedHash: fair.Hash(serverSeed),
+		ClientSeed:     strconv.FormatInt(chatID, 10),
+		EndsAt:         time.Now().Add(duration).Unix(),
+		Paytable:       games.CurrentPaytable().Version,
+	}
+
+	keep := int64((duration + tableKeep).Seconds())
+	opened, err := openTableScript.Run(cache.Ctx, cache.Rdb, tableKeys(chatID), chatID, round.EndsAt, keep,
+		"id", round.ID, "chat_id", round.ChatID, "opened_by", round.OpenedBy, "opened_name", round.OpenedName,
+		"server_seed", round.ServerSeed, "server_seed_hash", round.ServerSeedHash, "client_seed", round.ClientSeed,
+		"ends_at", round.EndsAt, "message_id", 0, "paytable", round.Paytable, "exposure", 0).Int()
+	if err != nil {
+		logger.Error("ошибка при открытии стола", zap.Int64("chat", chatID), zap.Error(err))
+		return models.TableRound{}, err
+	}
+	if opened == 0 {
+		return models.TableRound{}, errors.New("в чате уже открыт раунд, делайте ставки командой /bet")
+	}
+	if opened < 0 {
+		return models.TableRound{}, errors.New("выигрыши прошлого раунда ещё выплачиваются, попробуйте позже")
+	}
+
+	return round, nil
+}
+
+// SetTableMessage запоминает сообщение об открытии раунда, чтобы ответить на него результатами
+func (s Service) SetTableMessage(chatID, roundID, messageID int64) error {
+	round, err := s.getTable(chatID)
+	if err != nil {
+		return err
+	}
+	if round.ID != roundID {
+		return nil
+	}
+
+	return cache.Rdb.HSet(cache.Ctx, tableKey(chatID), "message_id", messageID).Err()
+}
+
+// PlaceTableBets списывает сумму ставок в казино и записывает их в открытый раунд.
+// Если раунд закрылся или казино не покроет выигрыши, ставки возвращаются
+func (s Service) PlaceTableBets(chatID, userID int64, username string, bets []games.TableBet) (models.TableRound, int64, error) {
+	if err := s.checkLoan(chatID, userID); err != nil {
+		return models.TableRound{}, 0, err
+	}
+
+	round, err := s.getTable(chatID)
+	if err != nil {
+		return round, 0, err
+	}
+
+	pt, err := s.paytable(round.Paytable)
+	if err != nil {
+		return round, 0, err
+	}
+
+	var total, exposure int64
+	entries := make([]any, 0, len(bets))
+	for _, bet := range bets {
+		total += bet.Amount
+		exposure += bet.Amount * bet.Multiplier(pt)
+
+		entry, err := json.Marshal(games.TableEntry{TableBet: bet, UserID: userID, Username: username})
+		if err != nil {
+			return round, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	balanceCasino, err := s.User.GetUserBalance(chatID, constants.CasinoID)
+	if err != nil {
+		return round, 0, err
+	}
+
+	reference := tableReference(round.ID)
+	balance, _, err := s.User.Transfer(models.Transaction{
+		From:      userID,
+		To:        constants.CasinoID,
+		Amount:    total,
+		Kind:      constants.TxGame,
+		ChatID:    chatID,
+		Reference: reference,
+	})
+	if err != nil {
+		return round, balance, err
+	}
+
+	args := append([]any{chatID, round.ID, time.Now().Unix(), exposure, balanceCasino + total}, entries...)
+	placed, err := betTableScript.Run(cache.Ctx, cache.Rdb, tableKeys(chatID), args...).Int()
+	if err == nil && placed > 0 {
+		return round, balance, nil
+	}
+
+	if err != nil {
+		logger.Error("ошибка при записи ставок стола", zap.Int64("chat", chatID), zap.Error(err))
+	} else if placed == -1 {
+		err = ErrTableClosed
+	} else {
+		err = errors.New("в казино не хватит зеток на выплату всех ставок раунда, уменьшите ставку")
+	}
+
+	_, balance, refundErr := s.User.Transfer(models.Transaction{
+		From:      constants.CasinoID,
+		To:        userID,
+		Amount:    total,
+		Kind:      constants.TxRefund,
+		ChatID:    chatID,
+		Reference: reference,
+	})
+	if refundErr != nil {
+		logger.Error("ошибка при возврате ставок стола", zap.Int64("chat", chatID), zap.Int64("id", userID), zap.Error(refundErr))
+	}
+
+	return round, balance, err
+}
+
+// DueTables возвращает чаты, в которых пора вращать колесо или повторить выплаты
+func (s Service) DueTables() ([]int64, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	var chats []int64
+	for _, key := range []string{tableOpenKey, tableSpinningKey} {
+		members, err := cache.Rdb.ZRangeByScore(cache.Ctx, key, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			chatID, err := strconv.ParseInt(member, 10, 64)
+			if err != nil {
+				continue
+			}
+			chats = append(chats, chatID)
+		}
+	}
+	return chats, nil
+}
+
+// SpinTable закрывает раунд чата, вращает колесо и выплачивает выигрыши. Раунд разыгрывает
+// только тот вызов, который забрал его claimTableScript, остальные получают ErrTableClosed.
+// Если часть выплат не прошла, раунд остаётся в table:spinning и возвращается ошибка
+func (s Service) SpinTable(chatID int64) (models.TableRound, []games.TableEntry, error) {
+	now := time.Now()
+	claimed, err := claimTableScript.Run(cache.Ctx, cache.Rdb, []string{tableOpenKey, tableSpinningKey},
+		chatID, now.Unix(), now.Add(tableRetry).Unix()).Int()
+	if err != nil {
+		return models.TableRound{}, nil, err
+	}
+	if claimed == 0 {
+		return models.TableRound{}, nil, ErrTableClosed
+	}
+
+	round, err := s.getTable(chatID)
+	if errors.Is(err, ErrTableClosed) {
+		// состояние раунда истекло, повторять нечего
+		cache.Rdb.ZRem(cache.Ctx, tableSpinningKey, chatID)
+		return round, nil, err
+	}
+	if err != nil {
+		return round, nil, err
+	}
+
+	raw, err := cache.Rdb.LRange(cache.Ctx, tableBetsKey(chatID), 0, -1).Result()
+	if err != nil {
+		return round, nil, err
+	}
+
+	entries := make([]games.TableEntry, 0, len(raw))
+	for _, r := range raw {
+		var entry games.TableEntry
+		if err := json.Unmarshal([]byte(r), &entry); err != nil {
+			logger.Error("ошибка разбора ставки стола", zap.Int64("chat", chatID), zap.String("bet", r), zap.Error(err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	pt, err := s.paytable(round.Paytable)
+	if err != nil {
+		return round, nil, err
+	}
+	round.Pocket = games.SpinTable(fair.New(round.ServerSeed, round.ClientSeed, round.ID))
+
+	// выигрыши игрока по всем его ставкам выплачиваются одним переводом
+	payouts := make(map[int64]int64)
+	var winners []int64
+	for i := range entries {
+		entries[i].Payout = entries[i].Win(pt, round.Pocket)
+		if entries[i].Payout == 0 {
+			continue
+		}
+		if _, ok := payouts[entries[i].UserID]; !ok {
+			winners = append(winners, entries[i].UserID)
+		}
+		payouts[entries[i].UserID] += entries[i].Payout
+	}
+
+	var failed int
+	for _, userID := range winners {
+		_, _, err := s.payOnce(models.Transaction{
+			From:      constants.CasinoID,
+			To:        userID,
+			Amount:    payouts[userID],
+			Kind:      constants.TxGame,
+			ChatID:    chatID,
+			Reference: tableReference(round.ID),
+		})
+		if err != nil {
+			failed++
+			logger.Error("ошибка при выплате выигрыша стола", zap.Int64("chat", chatID), zap.Int64("id", userID),
+				zap.Int64("round", round.ID), zap.Int64("payout", payouts[userID]), zap.Error(err))
+		}
+	}
+	if failed > 0 {
+		return round, entries, fmt.Errorf("стол #%d: не прошло выплат: %d из %d, повтор через %s",
+			round.ID, failed, len(winners), tableRetry)
+	}
+
+	err = cache.Rdb.Del(cache.Ctx, tableKey(chatID), tableBetsKey(chatID)).Err()
+	if err != nil {
+		logger.Error("ошибка при удалении раунда стола", zap.Int64("chat", chatID), zap.Error(err))
+	}
+	if err = cache.Rdb.ZRem(cache.Ctx, tableSpinningKey, chatID).Err(); err != nil {
+		logger.Error("ошибка при закрытии раунда стола", zap.Int64("chat", chatID), zap.Error(err))
+	}
+
+	return round, entries, nil
+}
+
+func (s Service) getTable(chatID int64) (models.TableRound, error) {
+	var round models.TableRound
+	res := cache.Rdb.HGetAll(cache.Ctx, tableKey(chatID))
+	fields, err := res.Result()
+	if err != nil {
+		return round, err
+	}
+	if len(fields) == 0 {
+		return round, ErrTableClosed
+	}
+
+	err = res.Scan(&round)
+	return round, err
+}
+
+func tableKeys(chatID int64) []string {
+	return []string{tableOpenKey, tableKey(chatID), tableBetsKey(chatID), tableSpinningKey}
+}
+
+func tableKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:table", chatID)
+}
+
+func tableBetsKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:table:bets", chatID)
+}
+
+func tableReference(id int64) string {
+	return fmt.Sprintf("table #%d", id)
+}
@@ -0,0 +1,193 @@
+package seeds
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/fair"
+	"hamsterbot/pkg/logger"
+)
+
+type Service struct{}
+
+func New() *Service {
+	return &Service{}
+}
+
+func newSeed(userID int64, clientSeed string) (models.Seed, error) {
+	serverSeed, err := fair.NewSeed(32)
+	if err != nil {
+		return models.Seed{}, err
+	}
+	if clientSeed == "" {
+		clientSeed, err = fair.NewSeed(8)
+		if err != nil {
+			return models.Seed{}, err
+		}
+	}
+
+	return models.Seed{
+		UserID:         userID,
+		ServerSeed:     serverSeed,
+		ServerSeedHash: fair.Hash(serverSeed),
+		ClientSeed:     clientSeed,
+		Active:         true,
+	}, nil
+}
+
+// GetSeed возвращает активную пару сидов пользователя, создавая её при первом обращении.
+// Серверный сид в ответе не заполняется - до ротации публикуется только его хэш.
+func (s Service) GetSeed(userID int64) (models.Seed, error) {
+	seed, err := s.activeSeed(userID)
+	if err != nil {
+		return models.Seed{}, err
+	}
+
+	seed.ServerSeed = ""
+	return seed, nil
+}
+
+func (s Service) activeSeed(userID int64) (models.Seed, error) {
+	var seed models.Seed
+	err := db.Conn.Get(&seed, `SELECT * FROM seeds WHERE user_id = $1 AND active`, userID)
+	if err == nil {
+		return seed, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("ошибка при выборке данных из таблицы seeds", zap.Error(err))
+		return models.Seed{}, err
+	}
+
+	seed, err = newSeed(userID, "")
+	if err != nil {
+		return models.Seed{}, err
+	}
+
+	query := `INSERT INTO seeds (user_id, server_seed, server_seed_hash, client_seed) VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) WHERE active DO NOTHING`
+	_, err = db.Conn.Exec(query, seed.UserID, seed.ServerSeed, seed.ServerSeedHash, seed.ClientSeed)
+	if err != nil {
+		logger.Error("ошибка при добавлении сида в таблицу seeds", zap.Error(err))
+		return models.Seed{}, err
+	}
+
+	// перечитываем, так как параллельный запрос мог создать сид раньше нас
+	err = db.Conn.Get(&seed, `SELECT * FROM seeds WHERE user_id = $1 AND active`, userID)
+	if err != nil {
+		return models.Seed{}, err
+	}
+
+	return seed, nil
+}
+
+// Next резервирует следующий nonce активного сида и возвращает генератор для нового раунда
+func (s Service) Next(userID int64) (*fair.RNG, models.Round, error) {
+	seed, err := s.activeSeed(userID)
+	if err != nil {
+		return nil, models.Round{}, err
+	}
+
+	var nonce int64
+	err = db.Conn.QueryRowx(`UPDATE seeds SET nonce = nonce + 1 WHERE id = $1 AND active RETURNING nonce`, seed.ID).Scan(&nonce)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.Round{}, errors.New("сид был сменён во время игры, попробуйте ещё раз")
+	} else if err != nil {
+		return nil, models.Round{}, err
+	}
+
+	round := models.Round{
+		UserID: userID,
+		SeedID: seed.ID,
+		Nonce:  nonce,
+	}
+
+	return fair.New(seed.ServerSeed, seed.ClientSeed, nonce), round, nil
+}
+
+// ReserveRound выдаёт номер следующего раунда, чтобы сослаться на него в журнале до записи раунда
+func (s Service) ReserveRound() (int64, error) {
+	var id int64
+	err := db.Conn.QueryRowx(`SELECT nextval('rounds_id_seq')`).Scan(&id)
+	if err != nil {
+		logger.Error("ошибка при получении номера раунда", zap.Error(err))
+		return 0, err
+	}
+	return id, nil
+}
+
+// SaveRound записывает сыгранный раунд с номером round.ID в транзакции tx, в которой проводится его ставка
+func (s Service) SaveRound(tx *sqlx.Tx, round models.Round) error {
+	query := `INSERT INTO rounds (id, user_id, seed_id, nonce, game, bet, amount, payout, result, paytable)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := tx.Exec(query, round.ID, round.UserID, round.SeedID, round.Nonce, round.Game, round.Bet,
+		round.Amount, round.Payout, round.Result, round.Paytable)
+	if err != nil {
+		logger.Error("ошибка при добавлении раунда в таблицу rounds", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// Rotate раскрывает текущий серверный сид и создаёт новую пару сидов.
+// Возвращает раскрытый старый сид и хэш нового.
+func (s Service) Rotate(userID int64, clientSeed string) (models.Seed, models.Seed, error) {
+	oldSeed, err := s.activeSeed(userID)
+	if err != nil {
+		return models.Seed{}, models.Seed{}, err
+	}
+
+	seed, err := newSeed(userID, clientSeed)
+	if err != nil {
+		return models.Seed{}, models.Seed{}, err
+	}
+
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return models.Seed{}, models.Seed{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE seeds SET active = FALSE, revealed_at = now() WHERE id = $1`, oldSeed.ID)
+	if err != nil {
+		return models.Seed{}, models.Seed{}, err
+	}
+	err = tx.QueryRowx(`INSERT INTO seeds (user_id, server_seed, server_seed_hash, client_seed) VALUES ($1, $2, $3, $4) RETURNING id`,
+		seed.UserID, seed.ServerSeed, seed.ServerSeedHash, seed.ClientSeed).Scan(&seed.ID)
+	if err != nil {
+		logger.Error("ошибка при ротации сида в таблице seeds", zap.Error(err))
+		return models.Seed{}, models.Seed{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Seed{}, models.Seed{}, err
+	}
+
+	seed.ServerSeed = ""
+	return oldSeed, seed, nil
+}
+
+// GetRound возвращает раунд пользователя и сид, на котором он был сыгран.
+// Серверный сид заполняется только если он уже раскрыт.
+func (s Service) GetRound(userID, roundID int64) (models.Round, models.Seed, error) {
+	var round models.Round
+	err := db.Conn.Get(&round, `SELECT * FROM rounds WHERE id = $1 AND user_id = $2`, roundID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Round{}, models.Seed{}, errors.New("раунд не найден")
+	} else if err != nil {
+		return models.Round{}, models.Seed{}, err
+	}
+
+	var seed models.Seed
+	err = db.Conn.Get(&seed, `SELECT * FROM seeds WHERE id = $1`, round.SeedID)
+	if err != nil {
+		return models.Round{}, models.Seed{}, err
+	}
+	if seed.Active {
+		seed.ServerSeed = ""
+	}
+
+	return round, seed, nil
+}
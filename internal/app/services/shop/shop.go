@@ -0,0 +1,72 @@
+package shop
+
+import (
+	"errors"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"math"
+)
+
+type User interface {
+	GetUserById(chatID, id int64) (models.User, error)
+	Upgrade(chatID, id, lvl, price, bonus int64) (models.User, error)
+}
+
+type Service struct {
+	User User
+}
+
+func New(User User) *Service {
+	return &Service{
+		User: User,
+	}
+}
+
+// Offer возвращает следующее улучшение пользователя
+func (s Service) Offer(chatID, id int64) (models.User, models.Upgrade, error) {
+	user, err := s.User.GetUserById(chatID, id)
+	if err != nil {
+		return models.User{}, models.Upgrade{}, err
+	}
+	if user.Lvl >= constants.MaxLvl {
+		return user, models.Upgrade{}, errors.New("достигнут максимальный уровень")
+	}
+
+	return user, NextUpgrade(user), nil
+}
+
+// Upgrade покупает пользователю следующий уровень
+func (s Service) Upgrade(chatID, id int64) (models.User, models.Upgrade, error) {
+	user, upgrade, err := s.Offer(chatID, id)
+	if err != nil {
+		return user, upgrade, err
+	}
+	if user.Balance < upgrade.Price {
+		return user, upgrade, errors.New(constants.ErrLackBalance)
+	}
+
+	upgraded, err := s.User.Upgrade(chatID, id, user.Lvl, upgrade.Price, upgrade.Bonus)
+	if err != nil {
+		return user, upgrade, err
+	}
+
+	return upgraded, upgrade, nil
+}
+
+// NextUpgrade считает цену и прибавку к доходу для перехода пользователя на следующий уровень
+func NextUpgrade(user models.User) models.Upgrade {
+	lvl := max(user.Lvl, 1)
+	bonus := constants.UpgradeIncomeStep * (lvl + 1)
+
+	return models.Upgrade{
+		Lvl:    lvl + 1,
+		Price:  Price(lvl),
+		Bonus:  bonus,
+		Income: user.Income + bonus,
+	}
+}
+
+// Price - цена перехода с уровня lvl на lvl+1
+func Price(lvl int64) int64 {
+	return int64(math.Round(float64(constants.UpgradeBasePrice) * math.Pow(constants.UpgradePriceGrowth, float64(lvl-1))))
+}
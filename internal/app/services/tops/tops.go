@@ -0,0 +1,244 @@
+package tops
+
+import (
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Топы чата хранятся в сортированных множествах chat:<chat>:top:<показатель> (участник - id пользователя),
+// имена пользователей - в хэше chat:<chat>:top:names. Множества обновляются при каждом изменении
+// баланса или уровня, а раз в rebuildTTL (или если Redis их потерял) целиком пересобираются из базы.
+// В хэше chat:<chat>:top:versions лежит версия строки пользователя, с которой записаны его показатели:
+// обновления приходят после коммита в произвольном порядке, и более старое не перезаписывает новое
+const rebuildTTL = 24 * time.Hour
+
+// updateScript записывает участника ARGV[1] с версией ARGV[2] в множества KEYS[2..] со значениями ARGV[3..],
+// если в хэше версий KEYS[1] у него не записана более новая версия
+var updateScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1])
+if current and tonumber(current) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+for i = 2, #KEYS do
+	redis.call('ZADD', KEYS[i], ARGV[i + 1], ARGV[1])
+end
+return 1
+`)
+
+type Service struct{}
+
+func New() *Service {
+	return &Service{}
+}
+
+// Update записывает в топы все показатели пользователя
+func (s Service) Update(user models.User) {
+	if !ranked(user.ID) {
+		return
+	}
+
+	keys := []string{versionsKey(user.ChatID), topKey(user.ChatID, constants.TopBalance),
+		topKey(user.ChatID, constants.TopLvl), topKey(user.ChatID, constants.TopIncome)}
+	err := updateScript.Run(cache.Ctx, cache.Rdb, keys, user.ID, user.Version, user.Balance, user.Lvl, user.Income).Err()
+	if err == nil {
+		err = cache.Rdb.HSet(cache.Ctx, namesKey(user.ChatID), user.ID, user.Username).Err()
+	}
+	if err != nil {
+		logger.Error("ошибка при обновлении топов", zap.Int64("chat", user.ChatID), zap.Int64("id", user.ID), zap.Error(err))
+	}
+}
+
+// UpdateBalance записывает в топ по балансу баланс пользователя версии version
+func (s Service) UpdateBalance(chatID, id, balance, version int64) {
+	if !ranked(id) {
+		return
+	}
+
+	keys := []string{versionsKey(chatID), topKey(chatID, constants.TopBalance)}
+	err := updateScript.Run(cache.Ctx, cache.Rdb, keys, id, version, balance).Err()
+	if err != nil {
+		logger.Error("ошибка при обновлении топа по балансу", zap.Int64("chat", chatID), zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+// GetTop возвращает страницу page (с 1) топа чата по показателю metric и общее число участников
+func (s Service) GetTop(chatID int64, metric string, page int64) ([]models.UserTop, int64, error) {
+	if !slices.Contains(constants.TopMetrics, metric) {
+		return nil, 0, fmt.Errorf("неизвестный топ %s", metric)
+	}
+	if page < 1 {
+		return nil, 0, errors.New("номер страницы должен быть больше нуля")
+	}
+
+	err := s.ensure(chatID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key := topKey(chatID, metric)
+	total, err := cache.Rdb.ZCard(cache.Ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := (page - 1) * constants.TopPageSize
+	scores, err := cache.Rdb.ZRevRangeWithScores(cache.Ctx, key, start, start+constants.TopPageSize-1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(scores) == 0 {
+		return nil, total, nil
+	}
+
+	ids := make([]string, 0, len(scores))
+	for _, z := range scores {
+		ids = append(ids, z.Member.(string))
+	}
+	names, err := cache.Rdb.HMGet(cache.Ctx, namesKey(chatID), ids...).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	top := make([]models.UserTop, 0, len(scores))
+	for i, z := range scores {
+		id, err := strconv.ParseInt(ids[i], 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+		username, _ := names[i].(string)
+
+		top = append(top, models.UserTop{
+			Rank:     start + int64(i) + 1,
+			ID:       id,
+			Username: username,
+			Value:    int64(z.Score),
+		})
+	}
+
+	return top, total, nil
+}
+
+// GetRank возвращает место пользователя в топе чата по показателю metric. Если пользователя нет в топе, Rank равен 0
+func (s Service) GetRank(chatID int64, metric string, id int64) (models.UserTop, error) {
+	top := models.UserTop{ID: id}
+
+	err := s.ensure(chatID)
+	if err != nil {
+		return top, err
+	}
+
+	key := topKey(chatID, metric)
+	member := strconv.FormatInt(id, 10)
+	rank, err := cache.Rdb.ZRevRank(cache.Ctx, key, member).Result()
+	if errors.Is(err, redis.Nil) {
+		return top, nil
+	} else if err != nil {
+		return top, err
+	}
+
+	score, err := cache.Rdb.ZScore(cache.Ctx, key, member).Result()
+	if err != nil {
+		return top, err
+	}
+	username, err := cache.Rdb.HGet(cache.Ctx, namesKey(chatID), member).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return top, err
+	}
+
+	top.Rank = rank + 1
+	top.Username = username
+	top.Value = int64(score)
+	return top, nil
+}
+
+// Rebuild пересобирает топы чата из таблицы users
+func (s Service) Rebuild(chatID int64) error {
+	var users []models.User
+	query := `SELECT id, chat_id, username, balance, lvl, income, version FROM users WHERE chat_id = $1 AND id > $2`
+	err := db.Conn.Select(&users, query, chatID, constants.MaxServiceID)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы users для топов", zap.Error(err))
+		return err
+	}
+
+	keys := []string{namesKey(chatID), versionsKey(chatID), readyKey(chatID)}
+	for _, metric := range constants.TopMetrics {
+		keys = append(keys, topKey(chatID, metric))
+	}
+
+	pipe := cache.Rdb.TxPipeline()
+	pipe.Del(cache.Ctx, keys...)
+	for _, user := range users {
+		pipe.ZAdd(cache.Ctx, topKey(chatID, constants.TopBalance), redis.Z{Score: float64(user.Balance), Member: user.ID})
+		pipe.ZAdd(cache.Ctx, topKey(chatID, constants.TopLvl), redis.Z{Score: float64(user.Lvl), Member: user.ID})
+		pipe.ZAdd(cache.Ctx, topKey(chatID, constants.TopIncome), redis.Z{Score: float64(user.Income), Member: user.ID})
+		pipe.HSet(cache.Ctx, namesKey(chatID), user.ID, user.Username)
+		pipe.HSet(cache.Ctx, versionsKey(chatID), user.ID, user.Version)
+	}
+	pipe.Set(cache.Ctx, readyKey(chatID), 1, rebuildTTL)
+	_, err = pipe.Exec(cache.Ctx)
+	return err
+}
+
+// RebuildAll пересобирает топы всех чатов и возвращает их число
+func (s Service) RebuildAll() (int, error) {
+	var chats []int64
+	err := db.Conn.Select(&chats, `SELECT chat_id FROM chats`)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы chats", zap.Error(err))
+		return 0, err
+	}
+
+	for _, chatID := range chats {
+		if err = s.Rebuild(chatID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(chats), nil
+}
+
+// ensure пересобирает топы чата, если их ещё нет или они давно не сверялись с базой
+func (s Service) ensure(chatID int64) error {
+	ready, err := cache.Rdb.Exists(cache.Ctx, readyKey(chatID)).Result()
+	if err != nil {
+		return err
+	}
+	if ready > 0 {
+		return nil
+	}
+
+	return s.Rebuild(chatID)
+}
+
+// ranked отсекает служебные счета и банковские счета пользователей
+func ranked(id int64) bool {
+	return id > constants.MaxServiceID
+}
+
+func topKey(chatID int64, metric string) string {
+	return fmt.Sprintf("chat:%d:top:%s", chatID, metric)
+}
+
+func namesKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:top:names", chatID)
+}
+
+func versionsKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:top:versions", chatID)
+}
+
+func readyKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:top:ready", chatID)
+}
@@ -0,0 +1,101 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"hamsterbot/internal/app/models"
+	"hamsterbot/pkg/cache"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Пользователь хранится в кэше одним хэшем chat:<chat>:user:<id> (см. cache.SetHash) с полями username, balance,
+// lvl, income и полями mute/selfmute с JSON мута. Хэш без какого-либо из основных полей считается промахом
+
+func userKey(chatID, id int64) string {
+	return fmt.Sprintf("chat:%d:user:%d", chatID, id)
+}
+
+func usernameKey(chatID int64, username string) string {
+	return fmt.Sprintf("chat:%d:username:%s", chatID, strings.Trim(username, "@"))
+}
+
+// getCachedUser возвращает пользователя из кэша и все поля его хэша. Если в хэше
+// нет основных полей, пользователь равен nil, а поля всё равно возвращаются ради мутов
+func getCachedUser(chatID, id int64) (*models.User, map[string]string, error) {
+	fields, err := cache.GetHash(userKey(chatID, id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, ok := decodeUser(chatID, id, fields)
+	if !ok {
+		return nil, fields, nil
+	}
+	return &user, fields, nil
+}
+
+// setCachedUser записывает основные поля пользователя и индекс по username, поля мутов не трогает.
+// Поля не пишутся, если в кэше уже пользователь более новой версии
+func setCachedUser(user models.User) error {
+	_, err := cache.SetHashVersioned(userKey(user.ChatID, user.ID), user.Version, encodeUser(user))
+	if err != nil {
+		return err
+	}
+
+	return cache.Rdb.Set(cache.Ctx, usernameKey(user.ChatID, user.Username), user.ID, cache.TTL).Err()
+}
+
+func encodeUser(user models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"username": strings.Trim(user.Username, "@"),
+		"balance":  user.Balance,
+		"lvl":      user.Lvl,
+		"income":   user.Income,
+	}
+}
+
+func decodeUser(chatID, id int64, fields map[string]string) (models.User, bool) {
+	user := models.User{ID: id, ChatID: chatID}
+
+	username, ok := fields["username"]
+	if !ok {
+		return user, false
+	}
+	user.Username = username
+
+	for name, value := range map[string]*int64{"balance": &user.Balance, "lvl": &user.Lvl, "income": &user.Income} {
+		raw, ok := fields[name]
+		if !ok {
+			return user, false
+		}
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return user, false
+		}
+		*value = parsed
+	}
+
+	return user, true
+}
+
+func encodeMute(mute models.Mute) (string, error) {
+	value, err := json.Marshal(mute)
+	return string(value), err
+}
+
+// decodeMute разбирает мут из кэша. Закончившийся или повреждённый мут считается пустым
+func decodeMute(value string) models.Mute {
+	var mute models.Mute
+	if err := json.Unmarshal([]byte(value), &mute); err != nil || mute == (models.Mute{}) {
+		return models.Mute{}
+	}
+
+	end, err := mute.End()
+	if err != nil || !end.After(time.Now()) {
+		return models.Mute{}
+	}
+
+	return mute
+}
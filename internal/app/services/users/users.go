@@ -1,397 +1,532 @@
 package users
 
 import (
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"hamsterbot/internal/app/constants"
 	"hamsterbot/internal/app/models"
 	"hamsterbot/pkg/cache"
 	"hamsterbot/pkg/db"
 	"hamsterbot/pkg/logger"
-	"log"
 	"strconv"
 	"strings"
 	"time"
 )
 
-type Service struct{}
+// Board - топы чата, которые обновляются при каждом изменении баланса или уровня. version - версия строки
+// пользователя, значение старше уже записанного топы пропускают
+type Board interface {
+	Update(user models.User)
+	UpdateBalance(chatID, id, balance, version int64)
+}
 
-func New() *Service {
-	return &Service{}
+type Service struct {
+	Board Board
 }
 
-func (s Service) GetUserById(id int64) (map[string]interface{}, error) {
-	cacheKey := fmt.Sprintf("user:%d", id)
-	fields := []string{"username", "balance", "lvl", "income", "mute", "selfmute"}
-	data := map[string]interface{}{"id": id}
-	var err error
-
-	for _, field := range fields {
-		cacheValue, err := cache.Rdb.Get(cache.Ctx, fmt.Sprintf("%s:%s", cacheKey, field)).Result()
-		if (err != nil && !errors.Is(err, redis.Nil)) || (cacheValue == "" && field != "mute") {
-			data = nil
-			break
-		}
+// touchOperation - операция очереди отложенной записи, обновляющая время последней активности пользователя.
+// Она приходит на каждое сообщение, поэтому пишется в базу пачками, а не отдельным запросом
+const touchOperation = "user_touch"
 
-		switch field {
-		case "username":
-			data[field] = cacheValue
-		case "balance", "lvl", "income":
-			value, convErr := strconv.ParseInt(cacheValue, 10, 64)
-			if convErr != nil {
-				return nil, convErr
-			}
-			data[field] = value
-		case "mute", "selfmute":
-			var mute models.Mute
-			if cacheValue != "" {
-				err := json.Unmarshal([]byte(cacheValue), &mute)
-				if err != nil {
-					return nil, err
-				}
-			}
+func New(Board Board) *Service {
+	cache.Register(touchOperation, func(tx *sqlx.Tx, touch models.UserTouch) error {
+		_, err := tx.Exec(`UPDATE users SET last_seen_at = $3
+			WHERE chat_id = $1 AND id = $2 AND (last_seen_at IS NULL OR last_seen_at < $3)`,
+			touch.ChatID, touch.ID, touch.SeenAt)
+		return err
+	})
 
-			data[field] = mute
-		}
+	return &Service{
+		Board: Board,
 	}
+}
 
-	if data != nil {
-		return data, nil
-	}
+// Touch ставит в очередь отметку, что пользователь только что писал в чате
+func (s Service) Touch(chatID, id int64) error {
+	return cache.Enqueue(touchOperation, models.UserTouch{ChatID: chatID, ID: id, SeenAt: time.Now()})
+}
 
-	var username string
-	var balance, lvl, income int64
-	query := `SELECT username, balance, lvl, income FROM users WHERE id = $1`
-	err = db.Conn.QueryRowx(query, id).Scan(&username, &balance, &lvl, &income)
+func (s Service) GetUserById(chatID, id int64) (models.User, error) {
+	user, fields, err := getCachedUser(chatID, id)
 	if err != nil {
-		logger.Error("ошибка при выборке данных из таблицы users в функции getUserData", zap.Error(err))
-		return nil, err
+		return models.User{}, err
 	}
 
-	data = map[string]interface{}{
-		"id":       id,
-		"username": username,
-		"balance":  balance,
-		"lvl":      lvl,
-		"income":   income,
-		"mute":     models.Mute{},
-		"selfmute": models.Mute{},
-	}
+	if user == nil {
+		user = &models.User{}
+		query := `SELECT id, chat_id, username, balance, lvl, income, version FROM users WHERE chat_id = $1 AND id = $2`
+		err = db.Conn.Get(user, query, chatID, id)
+		if err != nil {
+			logger.Error("ошибка при выборке данных из таблицы users в функции GetUserById", zap.Error(err))
+			return models.User{}, err
+		}
 
-	err = cache.Rdb.Set(cache.Ctx, fmt.Sprintf("username:%s", username), id, 0).Err()
-	if err != nil {
-		return nil, err
+		err = setCachedUser(*user)
+		if err != nil {
+			return models.User{}, err
+		}
+		s.Board.Update(*user)
 	}
-	for field, value := range data {
-		if field == "id" {
-			continue
-		} else if field == "username" {
-			value = strings.Trim(username, "@")
-		} else if field == "mute" || field == "selfmute" {
-			value, err = json.Marshal(models.Mute{})
+
+	return s.withMutes(*user, fields)
+}
+
+// withMutes заполняет муты пользователя: из полей кэша, если они там есть, иначе из таблицы mutes
+func (s Service) withMutes(user models.User, fields map[string]string) (models.User, error) {
+	for _, kind := range []string{constants.MuteKind, constants.SelfMuteKind} {
+		var mute models.Mute
+		if value, ok := fields[kind]; ok {
+			mute = decodeMute(value)
+		} else {
+			var err error
+			mute, err = s.loadMute(user.ChatID, user.ID, kind)
 			if err != nil {
-				return nil, err
+				return models.User{}, err
 			}
 		}
 
-		err = cache.Rdb.Set(cache.Ctx, fmt.Sprintf("%s:%s", cacheKey, field), value, 0).Err()
-		if err != nil {
-			return nil, err
+		if kind == constants.MuteKind {
+			user.Mute = mute
+		} else {
+			user.SelfMute = mute
 		}
 	}
 
-	return data, nil
+	return user, nil
 }
 
-func (s Service) GetUserByUsername(username string) (map[string]interface{}, error) {
-	var data map[string]interface{}
-
-	idStr, err := cache.Rdb.Get(cache.Ctx, fmt.Sprintf("username:%s", strings.Trim(username, "@"))).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return nil, err
+// GetUserMute возвращает действующий в чате мут пользователя. Redis служит кэшем,
+// при промахе мут читается из таблицы mutes и сохраняется в кэш пользователя
+func (s Service) GetUserMute(chatID, id int64, kind string) (models.Mute, error) {
+	fields, err := cache.GetHash(userKey(chatID, id))
+	if err != nil {
+		return models.Mute{}, err
+	}
+	if value, ok := fields[kind]; ok {
+		return decodeMute(value), nil
 	}
-	if !errors.Is(err, redis.Nil) {
-		id, err := strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			return nil, err
-		}
 
-		data, err = s.GetUserById(id)
-		if err != nil {
-			return nil, err
-		}
+	return s.loadMute(chatID, id, kind)
+}
 
-		return data, err
+// SetCachedMute записывает мут пользователя в кэш, пустой мут означает его отсутствие
+func (s Service) SetCachedMute(chatID, id int64, kind string, mute models.Mute) error {
+	value, err := encodeMute(mute)
+	if err != nil {
+		return err
 	}
 
-	var id, balance, lvl, income int64
-	query := `SELECT id, balance, lvl, income FROM users WHERE username = $1`
-	err = db.Conn.QueryRowx(query, strings.Trim(username, "@")).Scan(&id, &balance, &lvl, &income)
+	return cache.SetHash(userKey(chatID, id), map[string]interface{}{kind: value})
+}
+
+// InvalidateUser удаляет пользователя из кэша, следующее чтение загрузит его из базы
+func (s Service) InvalidateUser(chatID, id int64) error {
+	return cache.Invalidate(userKey(chatID, id))
+}
+
+// RefreshUser перечитывает пользователя и его муты из базы и заново записывает в кэш
+func (s Service) RefreshUser(chatID, id int64) (models.User, error) {
+	err := s.InvalidateUser(chatID, id)
 	if err != nil {
-		logger.Error("ошибка при выборке данных из таблицы users в функции getUserData", zap.Error(err))
-		return nil, fmt.Errorf("пользователь не найден")
+		return models.User{}, err
 	}
 
-	data = map[string]interface{}{
-		"id":       id,
-		"username": strings.Trim(username, "@"),
-		"balance":  balance,
-		"lvl":      lvl,
-		"income":   income,
-		"mute":     models.Mute{},
-		"selfmute": models.Mute{},
-	}
+	return s.GetUserById(chatID, id)
+}
 
-	cacheKey := fmt.Sprintf("user:%d", id)
-	err = cache.Rdb.Set(cache.Ctx, fmt.Sprintf("username:%s", strings.Trim(username, "@")), id, 0).Err()
+func (s Service) loadMute(chatID, id int64, kind string) (models.Mute, error) {
+	var mute models.Mute
+	var startAt, endAt time.Time
+	var mode string
+	query := `SELECT start_at, end_at, mode FROM mutes
+		WHERE chat_id = $1 AND target_id = $2 AND kind = $3 AND unmuted_at IS NULL AND end_at > now()
+		ORDER BY id DESC LIMIT 1`
+	err := db.Conn.QueryRowx(query, chatID, id, kind).Scan(&startAt, &endAt, &mode)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("ошибка при выборке данных из таблицы mutes", zap.Error(err))
+		return mute, err
+	}
+	if err == nil {
+		mute = models.NewMute(startAt, endAt.Sub(startAt))
+		mute.ChatID = chatID
+		mute.Mode = mode
+	}
+
+	// отсутствие мута тоже кэшируется, чтобы не ходить в базу на каждое сообщение
+	err = s.SetCachedMute(chatID, id, kind, mute)
 	if err != nil {
-		return nil, err
+		logger.Error("ошибка при записи мута в кэш", zap.Error(err))
 	}
-	for field, value := range data {
-		if field == "id" {
-			continue
-		} else if field == "username" {
-			value = strings.Trim(username, "@")
-		} else if field == "mute" || field == "selfmute" {
-			value, err = json.Marshal(models.Mute{})
-			if err != nil {
-				return nil, err
-			}
-		}
 
-		err = cache.Rdb.Set(cache.Ctx, fmt.Sprintf("%s:%s", cacheKey, field), value, 0).Err()
+	return mute, nil
+}
+
+func (s Service) GetUserByUsername(chatID int64, username string) (models.User, error) {
+	idStr, err := cache.Rdb.Get(cache.Ctx, usernameKey(chatID, username)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return models.User{}, err
+	}
+	if err == nil {
+		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
-			return nil, err
+			return models.User{}, err
 		}
+
+		return s.GetUserById(chatID, id)
 	}
 
-	return data, nil
-}
+	var user models.User
+	query := `SELECT id, chat_id, username, balance, lvl, income, version FROM users WHERE chat_id = $1 AND username = $2`
+	err = db.Conn.Get(&user, query, chatID, strings.Trim(username, "@"))
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы users в функции GetUserByUsername", zap.Error(err))
+		return models.User{}, fmt.Errorf("пользователь не найден")
+	}
 
-func (s Service) GetUserBalance(id int64) (int64, error) {
-	balanceStr, err := cache.Rdb.Get(cache.Ctx, fmt.Sprintf("user:%d:balance", id)).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return 0, err
+	_, fields, err := getCachedUser(chatID, user.ID)
+	if err != nil {
+		return models.User{}, err
 	}
-	balance, err := strconv.ParseInt(balanceStr, 10, 64)
+	err = setCachedUser(user)
 	if err != nil {
-		return 0, err
+		return models.User{}, err
 	}
+	s.Board.Update(user)
 
-	return balance, nil
+	return s.withMutes(user, fields)
 }
 
-func (s Service) SetUserBalance(id int64, balance int64) (int64, error) {
-	rows, err := db.Conn.Queryx(`UPDATE users SET balance = $1 WHERE id = $2`, balance, id)
+func (s Service) GetUserBalance(chatID, id int64) (int64, error) {
+	fields, err := cache.GetHash(userKey(chatID, id))
 	if err != nil {
-		logger.Error("ошибка при добавлении пользователя в таблицу users", zap.Error(err))
 		return 0, err
 	}
-	defer rows.Close()
 
-	err = cache.Rdb.Set(cache.Ctx, fmt.Sprintf("user:%d:balance", id), balance, 0).Err()
-	if err != nil {
-		return 0, err
+	balance, convErr := strconv.ParseInt(fields["balance"], 10, 64)
+	if convErr != nil {
+		user, err := s.GetUserById(chatID, id)
+		if err != nil {
+			return 0, err
+		}
+		return user.Balance, nil
 	}
 
 	return balance, nil
 }
 
-func (s Service) IncrementAllUserBalances() error {
-	keys, err := cache.Rdb.Keys(cache.Ctx, "user:*:balance").Result()
+// Transfer атомарно проводит операцию t в одной транзакции: списывает t.Amount со счёта t.From,
+// зачисляет на счёт t.To в чате t.ChatID и записывает операцию в журнал transactions. Служебный счёт
+// constants.SystemID используется как вторая сторона при эмиссии и списании зеток.
+// Возвращает новые балансы отправителя и получателя. Кэш обновляется только после коммита.
+func (s Service) Transfer(t models.Transaction) (int64, int64, error) {
+	return s.TransferWith(t, nil)
+}
+
+// TransferWith проводит операцию t, как Transfer, и в той же транзакции выполняет fn. Если fn вернула ошибку,
+// откатывается и перевод, поэтому запись, которой он принадлежит, и деньги не расходятся
+func (s Service) TransferWith(t models.Transaction, fn func(tx *sqlx.Tx) error) (int64, int64, error) {
+	// при ошибке balances содержит балансы до перевода, их и показывают пользователю
+	balances, err := s.TransferBatch([]models.Transaction{t}, fn)
+	return balances[t.From], balances[t.To], err
+}
+
+// TransferBatch проводит операции ts одного чата по порядку в одной транзакции: проходят все или ни одной.
+// Счета всех операций блокируются сразу в порядке возрастания id. Возвращает новые балансы участников;
+// если транзакция откатилась после блокировки счетов (не хватило средств, ошибка fn или базы),
+// вместе с ошибкой возвращаются балансы до перевода
+func (s Service) TransferBatch(ts []models.Transaction, fn func(tx *sqlx.Tx) error) (map[int64]int64, error) {
+	if len(ts) == 0 {
+		return nil, errors.New("нет операций для перевода")
+	}
+	chatID := ts[0].ChatID
+	var ids []int64
+	for _, t := range ts {
+		if t.Amount < 0 {
+			return nil, errors.New(constants.ErrNegativeAmount)
+		}
+		if t.From == t.To {
+			return nil, errors.New("нельзя перевести деньги самому себе")
+		}
+		if t.ChatID != chatID {
+			return nil, errors.New("операции перевода должны относиться к одному чату")
+		}
+		ids = append(ids, t.From, t.To)
+	}
+
+	tx, err := db.Conn.Beginx()
 	if err != nil {
-		return fmt.Errorf("failed to get keys: %w", err)
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	for _, key := range keys {
-		idStr := strings.Trim(strings.Trim(key, "user:"), ":balance")
-		id, err := strconv.ParseInt(idStr, 10, 64)
-		if err != nil {
-			return err
+	// блокируем строки в порядке возрастания id, чтобы параллельные переводы не упирались в дедлок
+	rows, err := tx.Queryx(`SELECT id, balance FROM users WHERE chat_id = $1 AND id = ANY($2) ORDER BY id FOR UPDATE`, chatID, ids)
+	if err != nil {
+		logger.Error("ошибка при блокировке счетов в функции TransferBatch", zap.Error(err))
+		return nil, err
+	}
+	balances := make(map[int64]int64, len(ids))
+	for rows.Next() {
+		var id, balance int64
+		if err := rows.Scan(&id, &balance); err != nil {
+			rows.Close()
+			return nil, err
 		}
+		balances[id] = balance
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		balanceStr, err := cache.Rdb.Get(cache.Ctx, fmt.Sprintf("user:%s:balance", idStr)).Result()
-		if err != nil && !errors.Is(err, redis.Nil) {
-			return err
+	// проверяем операции по порядку на балансах, какими они станут после предыдущих
+	current := make(map[int64]int64, len(balances))
+	for id, balance := range balances {
+		current[id] = balance
+	}
+	for _, t := range ts {
+		if _, ok := current[t.From]; !ok && t.From != constants.SystemID {
+			return balances, errors.New("отправитель не зарегистрирован")
 		}
-		balance, err := strconv.ParseInt(balanceStr, 10, 64)
-		if err != nil {
-			return err
+		if _, ok := current[t.To]; !ok && t.To != constants.SystemID {
+			return balances, errors.New("пользователь не зарегистрирован")
+		}
+		if t.From != constants.SystemID && current[t.From] < t.Amount {
+			return balances, errors.New(constants.ErrLackBalance)
 		}
+		current[t.From] -= t.Amount
+		current[t.To] += t.Amount
+	}
 
-		incomeStr, err := cache.Rdb.Get(cache.Ctx, fmt.Sprintf("user:%s:income", idStr)).Result()
-		if err != nil && !errors.Is(err, redis.Nil) {
-			return err
+	versions := make(map[int64]int64, len(balances))
+	for _, t := range ts {
+		var balance, version int64
+		if t.From != constants.SystemID {
+			err = tx.QueryRowx(`UPDATE users SET balance = balance - $1 WHERE chat_id = $2 AND id = $3 RETURNING balance, version`, t.Amount, chatID, t.From).Scan(&balance, &version)
+			if err != nil {
+				logger.Error("ошибка при списании средств в функции TransferBatch", zap.Error(err))
+				return balances, err
+			}
+			current[t.From], versions[t.From] = balance, version
 		}
-		income, err := strconv.ParseInt(incomeStr, 10, 64)
-		if err != nil {
-			return err
+		if t.To != constants.SystemID {
+			err = tx.QueryRowx(`UPDATE users SET balance = balance + $1 WHERE chat_id = $2 AND id = $3 RETURNING balance, version`, t.Amount, chatID, t.To).Scan(&balance, &version)
+			if err != nil {
+				logger.Error("ошибка при зачислении средств в функции TransferBatch", zap.Error(err))
+				return balances, err
+			}
+			current[t.To], versions[t.To] = balance, version
 		}
 
-		_, err = s.SetUserBalance(id, balance+income)
+		_, err = tx.Exec(`INSERT INTO transactions (from_id, to_id, amount, kind, chat_id, reference) VALUES ($1, $2, $3, $4, $5, $6)`,
+			t.From, t.To, t.Amount, t.Kind, chatID, t.Reference)
 		if err != nil {
-			return fmt.Errorf("ошибка при обновлении баланса: %w", err)
+			logger.Error("ошибка при записи операции в таблицу transactions", zap.Error(err))
+			return balances, err
 		}
 	}
 
-	return nil
-}
+	if fn != nil {
+		if err = fn(tx); err != nil {
+			return balances, err
+		}
+	}
 
-func (s Service) AddUser(id int64, username string) error {
-	rows, err := db.Conn.Queryx(`INSERT INTO users (id, username, balance, lvl, income) VALUES ($1, $2, 1500, 1, 250)`, id, username)
-	if err != nil {
-		logger.Error("ошибка при добавлении пользователя в таблицу users", zap.Error(err))
-		return err
+	if err = tx.Commit(); err != nil {
+		return balances, err
 	}
-	defer rows.Close()
 
-	return nil
+	delete(current, constants.SystemID)
+	for id, balance := range current {
+		s.setCachedBalance(chatID, id, balance, versions[id])
+	}
+
+	return current, nil
 }
 
-func (s Service) GetTopByBalance() ([]models.UserTop, error) {
-	var top []models.UserTop
-	cacheValue, err := cache.Rdb.Get(cache.Ctx, "top:balance").Result()
-	if err == nil && cacheValue != "" {
-		err = json.Unmarshal([]byte(cacheValue), &top)
-		if err != nil {
-			log.Printf("Ошибка десериализации: %v", err)
-		}
-		return top, nil
-	} else if !errors.Is(err, redis.Nil) {
-		// Если ошибка не связана с отсутствием ключа, логируем её
-		log.Printf("Ошибка при получении данных из Redis: %v", err)
+// Upgrade списывает price со счёта пользователя, повышает его уровень с lvl на lvl+1 и увеличивает доход на bonus.
+// Если уровень успел измениться (например, после второй команды подряд), покупка отменяется
+func (s Service) Upgrade(chatID, id, lvl, price, bonus int64) (models.User, error) {
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return models.User{}, err
 	}
+	defer tx.Rollback()
 
-	rows, err := db.Conn.Query(`SELECT username, balance FROM users WHERE username NOT LIKE 'bank%' ORDER by balance DESC LIMIT 10`)
+	var balance, currentLvl int64
+	err = tx.QueryRowx(`SELECT balance, lvl FROM users WHERE chat_id = $1 AND id = $2 FOR UPDATE`, chatID, id).Scan(&balance, &currentLvl)
 	if err != nil {
-		return nil, err
+		logger.Error("ошибка при блокировке счёта в функции Upgrade", zap.Error(err))
+		return models.User{}, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var user models.UserTop
-		errScan := rows.Scan(&user.Username, &user.Value)
-		if errScan != nil {
-			return nil, errScan
-		}
-
-		top = append(top, user)
+	if currentLvl != lvl {
+		return models.User{}, errors.New("уровень уже изменился, попробуйте ещё раз")
+	}
+	if balance < price {
+		return models.User{}, errors.New(constants.ErrLackBalance)
 	}
 
-	cacheValueByte, err := json.Marshal(top)
+	var user models.User
+	query := `UPDATE users SET balance = balance - $3, lvl = lvl + 1, income = income + $4 WHERE chat_id = $1 AND id = $2
+		RETURNING id, chat_id, username, balance, lvl, income, version`
+	err = tx.QueryRowx(query, chatID, id, price, bonus).StructScan(&user)
 	if err != nil {
-		return nil, err
+		logger.Error("ошибка при повышении уровня в функции Upgrade", zap.Error(err))
+		return models.User{}, err
 	}
-	err = cache.Rdb.Set(cache.Ctx, "top:balance", cacheValueByte, 5*time.Minute).Err()
+
+	// цена улучшения списывается на служебный счёт и выходит из обращения
+	_, err = tx.Exec(`INSERT INTO transactions (from_id, to_id, amount, kind, chat_id, reference) VALUES ($1, $2, $3, $4, $5, $6)`,
+		id, constants.SystemID, price, constants.TxUpgrade, chatID, fmt.Sprintf("lvl %d", user.Lvl))
 	if err != nil {
-		log.Printf("Ошибка при сохранении данных в Redis: %v", err)
+		logger.Error("ошибка при записи операции в таблицу transactions", zap.Error(err))
+		return models.User{}, err
 	}
 
-	return top, nil
-}
-
-func (s Service) GetTopByLVL() ([]models.UserTop, error) {
-	var top []models.UserTop
-	cacheValue, err := cache.Rdb.Get(cache.Ctx, "top:lvl").Result()
-	if err == nil && cacheValue != "" {
-		err = json.Unmarshal([]byte(cacheValue), &top)
-		if err != nil {
-			log.Printf("Ошибка десериализации: %v", err)
-		}
-		return top, nil
-	} else if !errors.Is(err, redis.Nil) {
-		// Если ошибка не связана с отсутствием ключа, логируем её
-		log.Printf("Ошибка при получении данных из Redis: %v", err)
+	if err = tx.Commit(); err != nil {
+		return models.User{}, err
 	}
 
-	rows, err := db.Conn.Query(`SELECT username, lvl FROM users WHERE username NOT LIKE 'bank%' ORDER by lvl DESC LIMIT 10`)
+	err = setCachedUser(user)
 	if err != nil {
-		return nil, err
+		logger.Error("ошибка при обновлении пользователя в кэше", zap.Error(err))
 	}
-	defer rows.Close()
+	s.Board.Update(user)
 
-	for rows.Next() {
-		var user models.UserTop
-		errScan := rows.Scan(&user.Username, &user.Value)
-		if errScan != nil {
-			return nil, errScan
-		}
-
-		top = append(top, user)
-	}
+	return user, nil
+}
 
-	cacheValueByte, err := json.Marshal(top)
+// GetUserTransactions возвращает операции пользователя в чате, начиная с самых новых
+func (s Service) GetUserTransactions(chatID, id int64, limit, offset int) ([]models.Transaction, error) {
+	var history []models.Transaction
+	query := `SELECT t.id, t.from_id, t.to_id, COALESCE(uf.username, '') AS from_username, COALESCE(ut.username, '') AS to_username,
+       t.amount, t.kind, t.chat_id, t.reference, t.created_at
+FROM transactions t
+LEFT JOIN users uf ON uf.chat_id = t.chat_id AND uf.id = t.from_id
+LEFT JOIN users ut ON ut.chat_id = t.chat_id AND ut.id = t.to_id
+WHERE t.chat_id = $1 AND (t.from_id = $2 OR t.to_id = $2)
+ORDER BY t.id DESC
+LIMIT $3 OFFSET $4`
+	err := db.Conn.Select(&history, query, chatID, id, limit, offset)
 	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы transactions", zap.Error(err))
 		return nil, err
 	}
-	err = cache.Rdb.Set(cache.Ctx, "top:lvl", cacheValueByte, 5*time.Minute).Err()
+
+	return history, nil
+}
+
+// setCachedBalance обновляет баланс в кэше и топах, если там не записан баланс более новой версии version:
+// операции пишут в кэш после коммита в произвольном порядке. Ошибка не прерывает операцию: в БД данные уже закоммичены
+func (s Service) setCachedBalance(chatID, id, balance, version int64) {
+	_, err := cache.SetHashVersioned(userKey(chatID, id), version, map[string]interface{}{"balance": balance})
 	if err != nil {
-		log.Printf("Ошибка при сохранении данных в Redis: %v", err)
+		logger.Error("ошибка при обновлении баланса в кэше", zap.Int64("chat", chatID), zap.Int64("id", id), zap.Error(err))
 	}
-
-	return top, nil
+	s.Board.UpdateBalance(chatID, id, balance, version)
 }
 
-func (s Service) GetTopByIncome() ([]models.UserTop, error) {
-	var top []models.UserTop
-	cacheValue, err := cache.Rdb.Get(cache.Ctx, "top:income").Result()
-	if err == nil && cacheValue != "" {
-		err = json.Unmarshal([]byte(cacheValue), &top)
-		if err != nil {
-			log.Printf("Ошибка десериализации: %v", err)
-		}
-		return top, nil
-	} else if !errors.Is(err, redis.Nil) {
-		// Если ошибка не связана с отсутствием ключа, логируем её
-		log.Printf("Ошибка при получении данных из Redis: %v", err)
+// IncrementAllUserBalances начисляет почасовой доход и в той же транзакции выполняет fn (например, списание
+// платежей по кредитам из начисленного дохода). Если fn вернула ошибку, доход не начисляется
+func (s Service) IncrementAllUserBalances(fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	rows, err := db.Conn.Query(`SELECT username, income FROM users WHERE username NOT LIKE 'bank%' ORDER by income DESC LIMIT 10`)
+	// начисление и запись в журнал выполняются одним запросом, поэтому проходят либо вместе, либо никак
+	// чаты с отключённым доходом в настройках пропускаются
+	query := `WITH upd AS (
+    UPDATE users u SET balance = u.balance + u.income
+    FROM chats c
+    WHERE c.chat_id = u.chat_id AND c.income_enabled AND u.income > 0
+    RETURNING u.chat_id, u.id, u.income
+)
+INSERT INTO transactions (from_id, to_id, amount, kind, chat_id) SELECT $1, id, income, $2, chat_id FROM upd`
+	_, err = tx.Exec(query, constants.SystemID, constants.TxIncome)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("ошибка при обновлении баланса: %w", err)
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var user models.UserTop
-		errScan := rows.Scan(&user.Username, &user.Value)
-		if errScan != nil {
-			return nil, errScan
+	if fn != nil {
+		if err = fn(tx); err != nil {
+			return err
 		}
+	}
 
-		top = append(top, user)
+	// fn может менять балансы получателей дохода и казино, поэтому в кэш идут балансы после неё
+	type balance struct {
+		ChatID  int64 `db:"chat_id"`
+		ID      int64 `db:"id"`
+		Balance int64 `db:"balance"`
+		Version int64 `db:"version"`
+	}
+	var balances []balance
+	query = `SELECT u.chat_id, u.id, u.balance, u.version FROM users u
+    JOIN chats c ON c.chat_id = u.chat_id
+    WHERE c.income_enabled AND (u.income > 0 OR u.id = $1)`
+	if err = tx.Select(&balances, query, constants.CasinoID); err != nil {
+		return fmt.Errorf("ошибка при выборке балансов: %w", err)
 	}
 
-	cacheValueByte, err := json.Marshal(top)
-	if err != nil {
-		return nil, err
+	if err = tx.Commit(); err != nil {
+		return err
 	}
-	err = cache.Rdb.Set(cache.Ctx, "top:income", cacheValueByte, 5*time.Minute).Err()
+
+	for _, b := range balances {
+		s.setCachedBalance(b.ChatID, b.ID, b.Balance, b.Version)
+	}
+
+	return nil
+}
+
+// AddUser регистрирует пользователя в чате со стартовыми значениями из настроек чата
+func (s Service) AddUser(chatID, id int64, username string) error {
+	query := `INSERT INTO users (chat_id, id, username, balance, lvl, income)
+		SELECT chat_id, $2::BIGINT, $3::TEXT, start_balance, 1, start_income FROM chats WHERE chat_id = $1
+		ON CONFLICT (chat_id, id) DO NOTHING`
+	rows, err := db.Conn.Queryx(query, chatID, id, username)
 	if err != nil {
-		log.Printf("Ошибка при сохранении данных в Redis: %v", err)
+		logger.Error("ошибка при добавлении пользователя в таблицу users", zap.Error(err))
+		return err
 	}
+	defer rows.Close()
 
-	return top, nil
+	return nil
 }
 
-func (s Service) GetBankBalance() (map[string]interface{}, error) {
-	bankBalance, err := s.GetUserById(1)
+func (s Service) GetBankBalance(chatID int64) (models.BankBalance, error) {
+	casino, err := s.GetUserById(chatID, constants.CasinoID)
 	if err != nil {
-		return nil, err
+		return models.BankBalance{}, err
 	}
 
 	var usersBankBalance int64
-	query := `SELECT SUM(balance) FROM users WHERE username LIKE 'bank_%'`
-	err = db.Conn.QueryRowx(query).Scan(&usersBankBalance)
+	query := `SELECT COALESCE(SUM(balance), 0) FROM deposits WHERE chat_id = $1 AND status = $2`
+	err = db.Conn.QueryRowx(query, chatID, constants.DepositOpen).Scan(&usersBankBalance)
 	if err != nil {
-		logger.Error("ошибка при выборке данных из таблицы users в функции getUserData", zap.Error(err))
-		return nil, err
+		logger.Error("ошибка при выборке данных из таблицы deposits в функции GetBankBalance", zap.Error(err))
+		return models.BankBalance{}, err
+	}
+
+	// чистая эмиссия по журналу: всё, что выпущено служебным счётом, минус всё, что на него списано
+	var emitted int64
+	query = `SELECT COALESCE(SUM(CASE WHEN from_id = $1 THEN amount ELSE -amount END), 0) FROM transactions
+		WHERE chat_id = $2 AND (from_id = $1 OR to_id = $1)`
+	err = db.Conn.QueryRowx(query, constants.SystemID, chatID).Scan(&emitted)
+	if err != nil {
+		logger.Error("ошибка при выборке данных из таблицы transactions", zap.Error(err))
+		return models.BankBalance{}, err
 	}
 
-	return map[string]interface{}{
-		"bank":  bankBalance["balance"].(int64),
-		"users": usersBankBalance,
+	return models.BankBalance{
+		Casino:  casino.Balance,
+		Users:   usersBankBalance,
+		Emitted: emitted,
 	}, nil
 }
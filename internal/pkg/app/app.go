@@ -2,32 +2,63 @@ package app
 
 import (
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 	tele "gopkg.in/telebot.v3"
 	"hamsterbot/config"
+	"hamsterbot/internal/app/constants"
+	"hamsterbot/internal/app/endpoint/admins"
+	"hamsterbot/internal/app/endpoint/chats"
 	"hamsterbot/internal/app/endpoint/mutes"
 	"hamsterbot/internal/app/endpoint/payments"
 	"hamsterbot/internal/app/endpoint/plays"
+	"hamsterbot/internal/app/endpoint/seeds"
+	"hamsterbot/internal/app/endpoint/shop"
+	"hamsterbot/internal/app/endpoint/tops"
 	"hamsterbot/internal/app/endpoint/users"
 	"hamsterbot/internal/app/middleware"
+	adminsService "hamsterbot/internal/app/services/admins"
+	chatsService "hamsterbot/internal/app/services/chats"
+	depositsService "hamsterbot/internal/app/services/deposits"
 	mutesService "hamsterbot/internal/app/services/mutes"
 	paymentsService "hamsterbot/internal/app/services/payments"
 	playsService "hamsterbot/internal/app/services/plays"
+	seedsService "hamsterbot/internal/app/services/seeds"
+	shopService "hamsterbot/internal/app/services/shop"
+	topsService "hamsterbot/internal/app/services/tops"
 	usersService "hamsterbot/internal/app/services/users"
 	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/callback"
 	"hamsterbot/pkg/db"
 	"hamsterbot/pkg/logger"
 	"hamsterbot/pkg/metrics"
+	"hamsterbot/pkg/scheduler"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type App struct {
-	users    *usersService.Service
-	payments *paymentsService.Service
-	mutes    *mutesService.Service
-	plays    *playsService.Service
+	users     *usersService.Service
+	chats     *chatsService.Service
+	admins    *adminsService.Service
+	payments  *paymentsService.Service
+	deposits  *depositsService.Service
+	mutes     *mutesService.Service
+	plays     *playsService.Service
+	seeds     *seedsService.Service
+	shop      *shopService.Service
+	tops      *topsService.Service
+	flusher   *cache.Flusher
+	scheduler *scheduler.Scheduler
+	metrics   *metrics.Server
+	bot       *tele.Bot
+	webhook   *webhook
+	handlers  dispatcher
+	mu        sync.Mutex // защищает running
+	running   bool
 }
 
 func New() (*App, error) {
@@ -38,32 +69,60 @@ func New() (*App, error) {
 
 	logger.Init(cfg.LoggerLevel)
 
-	err = cache.Init(fmt.Sprintf("%s:%s", cfg.Redis.RedisAddr, cfg.Redis.RedisPort), cfg.Redis.RedisUsername, cfg.Redis.RedisPassword, cfg.Redis.RedisDBId)
+	err = cache.Init(fmt.Sprintf("%s:%s", cfg.Redis.RedisAddr, cfg.Redis.RedisPort), cfg.Redis.RedisUsername, cfg.Redis.RedisPassword, cfg.Redis.RedisDBId,
+		cfg.Redis.RedisCacheTTL, cfg.Redis.RedisLocalTTL)
 	if err != nil {
 		logger.Fatal("ошибка при инициализации кэша: ", zap.Error(err))
 		return nil, err
 	}
 
-	err = db.Init(cfg.DB.DBUser, cfg.DB.DBPassword, cfg.DB.DBHost, cfg.DB.DBName)
+	err = db.Init(cfg.DB.DBUser, cfg.DB.DBPassword, cfg.DB.DBHost, cfg.DB.DBName, cfg.DefaultChatID)
 	if err != nil {
 		logger.Fatal("ошибка при инициализации БД: ", zap.Error(err))
 		return nil, err
 	}
 
-	go metrics.Init()
-
 	a := &App{}
+	a.metrics = metrics.New(cfg.HTTPListen)
 
-	InitBot(cfg.TelegramAPI, a)
+	a.flusher, err = cache.NewFlusher(cache.QueueConfig{
+		BatchSize:  cfg.Redis.QueueBatchSize,
+		Interval:   cfg.Redis.QueueInterval,
+		MaxRetries: cfg.Redis.QueueMaxRetries,
+	})
+	if err != nil {
+		logger.Fatal("ошибка при инициализации очереди записи: ", zap.Error(err))
+		return nil, err
+	}
+
+	InitBot(cfg, a)
 
 	return a, nil
 }
 
-func InitBot(TelegramAPI string, a *App) {
+// InitBot создаёт бота, сервисы, обработчики и задачи планировщика. Запускает их Run
+func InitBot(cfg *config.Configuration, a *App) {
 	botLogger := logger.Named("bot")
+	// обработчики выполняет пул dispatcher, поэтому сам бот обрабатывает обновления синхронно
 	pref := tele.Settings{
-		Token:  TelegramAPI,
-		Poller: &tele.LongPoller{Timeout: 1 * time.Second},
+		Token:       cfg.TelegramAPI,
+		Poller:      &tele.LongPoller{Timeout: 1 * time.Second},
+		Synchronous: true,
+	}
+
+	// long polling остаётся режимом по умолчанию, вебхук включается для работы за обратным прокси
+	if cfg.Webhook.Enabled {
+		var err error
+		a.webhook, err = newWebhook(cfg)
+		if err != nil {
+			botLogger.Fatal("Ошибка при настройке вебхука", zap.Error(err))
+		}
+		pref.Poller = a.webhook
+
+		a.metrics.Handle(a.webhook.path, a.webhook)
+		if cfg.Webhook.Cert != "" {
+			a.metrics.UseTLS(cfg.Webhook.Cert, cfg.Webhook.Key)
+		}
 	}
 
 	b, err := tele.NewBot(pref)
@@ -71,34 +130,112 @@ func InitBot(TelegramAPI string, a *App) {
 		botLogger.Fatal("Ошибка при создании бота", zap.Error(err))
 	}
 
-	go func() {
-		ubLogger := logger.Named("updateBalance")
+	if cfg.CallbackSecret != "" {
+		callback.Init(cfg.CallbackSecret)
+	} else {
+		callback.Init(cfg.TelegramAPI)
+	}
 
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
+	a.tops = topsService.New()
+	a.users = usersService.New(a.tops)
+	a.chats = chatsService.New()
+	a.admins = adminsService.New()
+	a.payments = paymentsService.New(a.users)
+	a.deposits = depositsService.New(a.users)
+	a.mutes = mutesService.New(a.users, b)
+	a.seeds = seedsService.New()
+	a.plays = playsService.New(a.users, a.mutes, a.seeds, a.admins, a.payments)
+	a.shop = shopService.New(a.users)
 
-		for {
-			select {
-			case <-ticker.C:
-				if err := a.users.IncrementAllUserBalances(); err != nil {
-					ubLogger.Error("ошибка обновления баланса пользователей", zap.Error(err))
-				} else {
-					ubLogger.Info("баланс пользователей успешно обновлен")
-				}
-			}
-		}
-	}()
+	err = a.admins.EnsureOwner(cfg.OwnerID)
+	if err != nil {
+		botLogger.Fatal("Ошибка при назначении владельца бота", zap.Error(err))
+	}
 
-	a.users = usersService.New()
-	a.payments = paymentsService.New(a.users)
-	a.mutes = mutesService.New(a.users)
-	a.plays = playsService.New(a.users, a.mutes)
+	report, err := a.plays.LoadPaytable(cfg.PaytablePath)
+	if err != nil {
+		botLogger.Fatal("Ошибка при загрузке таблицы выплат", zap.Error(err))
+	}
+	botLogger.Info(report)
+
+	restored, err := a.mutes.RestoreCache()
+	if err != nil {
+		botLogger.Fatal("Ошибка при восстановлении кэша мутов", zap.Error(err))
+	}
+	botLogger.Info("Кэш мутов восстановлен", zap.Int("mutes", restored))
 
-	mwEndpoint := middleware.Endpoint{Bot: b, User: a.users}
+	mwEndpoint := middleware.Endpoint{Bot: b, User: a.users, Chat: a.chats, Admin: a.admins}
+	chatsEndpoint := chats.Endpoint{Chat: a.chats, Admin: a.admins}
+	adminsEndpoint := admins.Endpoint{Admin: a.admins, User: a.users}
 	usersEndpoint := users.Endpoint{User: a.users}
-	paymentsEndpoint := payments.Endpoint{Payment: a.payments, User: a.users}
+	paymentsEndpoint := payments.Endpoint{Payment: a.payments, User: a.users, Deposit: a.deposits, Loan: a.payments}
 	mutesEndpoint := mutes.Endpoint{Mute: a.mutes}
-	playsEndpoint := plays.Endpoint{Play: a.plays}
+	playsEndpoint := plays.Endpoint{Play: a.plays, Duel: a.plays, Table: a.plays, Blackjack: a.plays, Admin: a.admins, PaytablePath: cfg.PaytablePath}
+	seedsEndpoint := seeds.Endpoint{Seed: a.seeds}
+	shopEndpoint := shop.Endpoint{Shop: a.shop}
+	topsEndpoint := tops.Endpoint{Top: a.tops}
+
+	location, err := time.LoadLocation(cfg.Schedule.TZ)
+	if err != nil {
+		botLogger.Fatal("Неверный часовой пояс SCHEDULE_TZ", zap.String("tz", cfg.Schedule.TZ), zap.Error(err))
+	}
+	a.scheduler = scheduler.New(location)
+	addJob := func(job scheduler.Job) {
+		if err := a.scheduler.Add(job); err != nil {
+			botLogger.Fatal("Ошибка при добавлении задачи планировщика", zap.String("job", job.Name), zap.Error(err))
+		}
+	}
+
+	jobLogger := logger.Named("jobs")
+	// время запуска сохраняется в транзакции начисления, поэтому после сбоя доход не начислится дважды
+	addJob(scheduler.Job{Name: "income", Spec: cfg.Schedule.Income, CatchUp: true, LockTTL: 10 * time.Minute, RunTx: func(save func(tx *sqlx.Tx) error) error {
+		// проценты и просрочка обновляются до начисления, чтобы платёж считался по текущему долгу
+		if err := a.payments.UpdateLoans(); err != nil {
+			jobLogger.Error("ошибка обновления кредитов", zap.Error(err))
+		}
+
+		// платёж по кредиту списывается из только что начисленного дохода в той же транзакции
+		var collected int
+		err := a.users.IncrementAllUserBalances(func(tx *sqlx.Tx) (err error) {
+			if collected, err = a.payments.CollectLoans(tx); err != nil {
+				return err
+			}
+			return save(tx)
+		})
+		if err != nil {
+			return err
+		}
+		jobLogger.Info("баланс пользователей успешно обновлен")
+		if collected > 0 {
+			jobLogger.Info("платежи по кредитам списаны", zap.Int("loans", collected))
+		}
+		return nil
+	}})
+	// проценты начисляются за полные сутки, поэтому частый запуск ничего не начислит дважды
+	addJob(scheduler.Job{Name: "interest", Spec: cfg.Schedule.Interest, CatchUp: true, LockTTL: 10 * time.Minute, Run: func() error {
+		accrued, err := a.deposits.AccrueInterest()
+		if accrued > 0 {
+			jobLogger.Info("проценты по вкладам начислены", zap.Int("deposits", accrued))
+		}
+		return err
+	}})
+	addJob(scheduler.Job{Name: "tops", Spec: cfg.Schedule.Tops, LockTTL: 10 * time.Minute, Run: func() error {
+		_, err := a.tops.RebuildAll()
+		return err
+	}})
+	addJob(scheduler.Job{Name: "mutes", Spec: cfg.Schedule.Mutes, Run: func() error {
+		_, err := a.mutes.CleanupExpired()
+		return err
+	}})
+	addJob(scheduler.Job{Name: "duels", Spec: "@every 15s", Run: func() error {
+		return playsEndpoint.ExpireDuels(b)
+	}})
+	addJob(scheduler.Job{Name: "tables", Spec: "@every 2s", Run: func() error {
+		return playsEndpoint.SpinTables(b)
+	}})
+	addJob(scheduler.Job{Name: "blackjack", Spec: "@every 5s", Run: func() error {
+		return playsEndpoint.ExpireHands(b)
+	}})
 
 	b.Use(mwEndpoint.IsUser)
 
@@ -106,57 +243,84 @@ func InitBot(TelegramAPI string, a *App) {
 		err := c.Send("🚀 Базовые команды\n" +
 			"/user <username> - Посмотреть информацию о пользователе\n" +
 			"/pay <username> <amount> - Перевести необходимую сумму пользователю\n" +
+			"/history [n] [page] - Посмотреть последние операции по счёту\n" +
+			"/bank - Банк и вклады под проценты: /bank info, /bank open <amount> [days], /bank add <id> <amount>, /bank withdraw <id> [amount]\n" +
+			"/loan <amount> - Взять кредит у казино, /loan status - ваш кредит и лимит, /loan repay [amount] - погасить\n" +
+			"/duel <username> <amount> - Вызвать пользователя на дуэль, победитель забирает обе ставки\n" +
+			"/shop - Следующее улучшение уровня и дохода, /upgrade - купить его\n" +
+			"/top <balance/lvl/income> [page] - Топ чата и ваше место в нём (/topb, /topl, /topi)\n" +
+			"/settings - Настройки экономики чата\n" +
 			"/mute <username> <duration> - Замутить пользователя на какое-то количество времени (формат - 5s/11m/23h)\n" +
 			"/unmute <username> - Размутить пользователя\n\n" +
-			"🎰 Мини-игры\n" +
-			"/slots <amount> - Сыграть в казино (коэффициенты от x2 до x100 ❗)")
+			"🎰 Мини-игры (правила - /rule <игра>, команда без аргументов - ставка кнопками)\n" +
+			playsEndpoint.Help() +
+			"/bj <amount> - Блэкджек с дилером: ещё, хватит или удвоить кнопками\n" +
+			"/table [секунды] - Открыть общий стол рулетки, /bet <ставка> <сумма> - поставить на нём (число, ч/к, дюжина, чет/нечет)\n\n" +
+			"🔐 Честная игра\n" +
+			"/seed - Посмотреть хэш серверного сида, /seed rotate [client seed] - сменить сиды\n" +
+			"/verify <round> - Проверить результат раунда по раскрытому сиду")
 		if err != nil {
 			return err
 		}
 		return nil
 	})
-	//b.Handle("/rule", playsEndpoint.Rules)
+	b.Handle("/rule", playsEndpoint.Rules)
 
 	// user команды
 	b.Handle("/user", usersEndpoint.GetUserData)
-	//b.Handle("/top", usersEndpoint.TopHandler)
-	//b.Handle("/topb", func(c tele.Context) error {
-	//	return usersEndpoint.TopHandlerCommand(c, "balance")
-	//})
-	//b.Handle("/topl", func(c tele.Context) error {
-	//	return usersEndpoint.TopHandlerCommand(c, "lvl")
-	//})
-	//b.Handle("/topi", func(c tele.Context) error {
-	//	return usersEndpoint.TopHandlerCommand(c, "income")
-	//})
+	b.Handle("/top", topsEndpoint.TopHandler)
+	b.Handle("/topb", func(c tele.Context) error {
+		return topsEndpoint.TopHandlerCommand(c, constants.TopBalance, c.Args())
+	})
+	b.Handle("/topl", func(c tele.Context) error {
+		return topsEndpoint.TopHandlerCommand(c, constants.TopLvl, c.Args())
+	})
+	b.Handle("/topi", func(c tele.Context) error {
+		return topsEndpoint.TopHandlerCommand(c, constants.TopIncome, c.Args())
+	})
 	b.Handle("/bank", paymentsEndpoint.BankHandler)
+	b.Handle("/loan", paymentsEndpoint.LoanHandler)
 	b.Handle("/pay", paymentsEndpoint.PayHandler)
+	b.Handle("/history", paymentsEndpoint.HistoryHandler)
+	b.Handle("/shop", shopEndpoint.ShopHandler)
+	b.Handle("/upgrade", shopEndpoint.UpgradeHandler)
 	b.Handle("/mute", mutesEndpoint.MuteHandler)
 	b.Handle("/unmute", mutesEndpoint.UnmuteHandler)
-	b.Handle("/slots", playsEndpoint.SlotsHandler)
-	//b.Handle("/rln", playsEndpoint.RouletteNumHandler)
-	//b.Handle("/rlc", playsEndpoint.RouletteColorHandler)
-	//b.Handle("/dice", playsEndpoint.DiceHandler)
-	//b.Handle("/rsp", playsEndpoint.RockPaperScissorsHandler)
+	playsEndpoint.RegisterGames(b)
+	playsEndpoint.RegisterKeyboards(b)
+	playsEndpoint.RegisterDuels(b)
+	playsEndpoint.RegisterBlackjack(b)
 	//b.Handle("/selfmute", playsEndpoint.SelfMuteHandler)
 	//b.Handle("/selfunmute", playsEndpoint.SelfUnmuteHandler)
 	b.Handle("/steal", playsEndpoint.StealHandler)
+	b.Handle("/duel", playsEndpoint.DuelHandler)
+	b.Handle("/table", playsEndpoint.TableHandler)
+	b.Handle("/bet", playsEndpoint.BetHandler)
+	b.Handle("/bj", playsEndpoint.BlackjackHandler)
+	b.Handle("/seed", seedsEndpoint.SeedHandler)
+	b.Handle("/verify", playsEndpoint.VerifyHandler)
 
 	// adm команды
-	b.Handle("/payd", paymentsEndpoint.PayAdmHandler)
+	b.Handle("/payd", paymentsEndpoint.PayAdmHandler, mwEndpoint.Require(constants.PermPay))
+	b.Handle("/paytable", playsEndpoint.PaytableHandler)
+	b.Handle("/settings", chatsEndpoint.SettingsHandler)
+	b.Handle("/admin", adminsEndpoint.AdminHandler, mwEndpoint.Require(constants.PermRoles))
 	b.Handle("/send", func(c tele.Context) error {
-		if c.Sender().ID != 1230045591 {
-			return nil
-		}
-
 		args := c.Args()
 
-		chatID := int64(-1002138316635)
+		// /send [chat_id] <текст>, без chat_id сообщение уходит в чат по умолчанию
+		chatID := cfg.DefaultChatID
+		if len(args) > 1 {
+			if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+				chatID = id
+				args = args[1:]
+			}
+		}
 
 		// Используем метод Send у объекта бота для отправки сообщения
 		_, err := c.Bot().Send(tele.ChatID(chatID), strings.Join(args, " "))
 		return err
-	})
+	}, mwEndpoint.Require(constants.PermSend))
 
 	// обработчики для всех типов сообщений
 	// необходимо для того, чтобы правильно работал
@@ -172,5 +336,5 @@ func InitBot(TelegramAPI string, a *App) {
 	b.Handle(tele.OnVideo, func(c tele.Context) error { return nil })
 	b.Handle(tele.OnVoice, func(c tele.Context) error { return nil })
 
-	b.Start()
+	a.bot = b
 }
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	tele "gopkg.in/telebot.v3"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"sync"
+)
+
+// Run запускает метрики, запись очереди, планировщик и получение обновлений и работает, пока не отменён ctx.
+// После возврата приложение нужно остановить через Shutdown
+func (a *App) Run(ctx context.Context) error {
+	if err := a.start(); err != nil {
+		return err
+	}
+
+	logger.Info("бот запущен")
+	<-ctx.Done()
+	return nil
+}
+
+func (a *App) start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		return errors.New("приложение уже запущено")
+	}
+
+	if err := a.metrics.Start(); err != nil {
+		// без HTTP-сервера вебхук не получит обновлений, а в режиме long polling теряются только метрики
+		if a.webhook != nil {
+			return fmt.Errorf("не удалось запустить HTTP-сервер: %w", err)
+		}
+		logger.Error("Ошибка при запуске HTTP-сервера", zap.Error(err))
+	}
+
+	if a.webhook != nil {
+		if err := a.bot.SetWebhook(a.webhook.hook); err != nil {
+			return fmt.Errorf("не удалось установить вебхук: %w", err)
+		}
+		logger.Info("вебхук установлен", zap.String("url", a.webhook.hook.Endpoint.PublicURL))
+	} else if err := a.bot.RemoveWebhook(); err != nil {
+		// getUpdates не работает, пока у бота установлен вебхук
+		logger.Warn("не удалось снять вебхук", zap.Error(err))
+	}
+
+	a.running = true
+	// операции очереди регистрируются конструкторами сервисов, поэтому запись запускается после них
+	go a.flusher.Run()
+	a.scheduler.Start()
+	a.handlers.start(a.bot, updateWorkers)
+	return nil
+}
+
+// Shutdown останавливает приложение: прекращает получать обновления, дожидается выполняющихся обработчиков
+// и задач, записывает остаток очереди в базу и закрывает соединения. ctx ограничивает время ожидания
+func (a *App) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	log := logger.Named("shutdown")
+	var errs []error
+
+	if a.running {
+		a.handlers.stopPolling()
+		log.Info("получение обновлений остановлено")
+
+		if err := wait(ctx, a.handlers.wait); err != nil {
+			errs = append(errs, fmt.Errorf("обработчики: %w", err))
+		}
+		if err := wait(ctx, a.scheduler.Stop); err != nil {
+			errs = append(errs, fmt.Errorf("планировщик: %w", err))
+		}
+
+		// задачи и обработчики завершены, поэтому после остановки фоновой записи в очередь больше ничего не попадёт
+		a.flusher.Stop()
+		if n, err := a.flusher.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("запись очереди: %w", err))
+		} else {
+			log.Info("очередь записана в базу", zap.Int("operations", n))
+		}
+
+		if err := a.metrics.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("сервер метрик: %w", err))
+		}
+		a.running = false
+	}
+
+	if err := db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("база данных: %w", err))
+	}
+	if err := cache.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("redis: %w", err))
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		log.Error("приложение остановлено с ошибками", zap.Error(err))
+	} else {
+		log.Info("приложение остановлено")
+	}
+	return err
+}
+
+// wait выполняет блокирующую остановку fn, пока не истёк ctx
+func wait(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// updateWorkers - сколько обновлений обрабатывается одновременно
+const updateWorkers = 32
+
+// dispatcher получает обновления от поллера бота и обрабатывает их пулом горутин. Бот работает в режиме
+// Synchronous, и ProcessUpdate возвращается только после обработчика, поэтому остановка дожидается
+// каждого принятого обновления, включая оставшиеся в буфере b.Updates
+type dispatcher struct {
+	bot    *tele.Bot
+	stop   chan struct{} // останавливает поллер
+	polled chan struct{} // закрыт, когда поллер вернулся
+	wg     sync.WaitGroup
+}
+
+func (d *dispatcher) start(b *tele.Bot, workers int) {
+	d.bot = b
+	d.stop = make(chan struct{})
+	d.polled = make(chan struct{})
+
+	go func() {
+		b.Poller.Poll(b, b.Updates, d.stop)
+		close(d.polled)
+	}()
+
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+}
+
+func (d *dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case u := <-d.bot.Updates:
+			d.bot.ProcessUpdate(u)
+		case <-d.polled:
+			// поллер больше ничего не пришлёт, дообрабатываем буфер
+			for {
+				select {
+				case u := <-d.bot.Updates:
+					d.bot.ProcessUpdate(u)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopPolling останавливает получение обновлений
+func (d *dispatcher) stopPolling() {
+	close(d.stop)
+	<-d.polled
+}
+
+// wait дожидается обработки всех полученных обновлений
+func (d *dispatcher) wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"hamsterbot/config"
+	"hamsterbot/pkg/db"
+	"strconv"
+)
+
+// Migrate выполняет подкоманду migrate: up применяет все миграции, down [n] откатывает n последних (по умолчанию одну),
+// status выводит список миграций
+func Migrate(args []string) error {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+
+	err = db.Connect(cfg.DB.DBUser, cfg.DB.DBPassword, cfg.DB.DBHost, cfg.DB.DBName)
+	if err != nil {
+		return err
+	}
+	defer db.Conn.Close()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		count, err := db.Migrate(cfg.DefaultChatID)
+		fmt.Printf("Применено миграций: %d\n", count)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New("количество откатываемых миграций должно быть положительным числом")
+			}
+		}
+
+		count, err := db.Rollback(steps, cfg.DefaultChatID)
+		fmt.Printf("Откачено миграций: %d\n", count)
+		return err
+	case "status":
+		migrations, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			status := "не применена"
+			if m.AppliedAt != nil {
+				status = "применена " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s: %s\n", m.Version, m.Name, status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда migrate %s (up/down/status)", command)
+	}
+}
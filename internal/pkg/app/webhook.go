@@ -0,0 +1,127 @@
+package app
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	tele "gopkg.in/telebot.v3"
+	"hamsterbot/config"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+)
+
+// secretPattern - допустимые Telegram символы секрета вебхука
+var secretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// webhook принимает обновления на HTTP-сервере метрик и передаёт их боту, как поллер.
+// Вебхук регистрируется в Telegram при запуске и не снимается при остановке: пока бот выключен,
+// Telegram копит обновления, а запросы, пришедшие во время остановки, получают 503 и повторяются позже
+type webhook struct {
+	hook   *tele.Webhook // параметры setWebhook
+	path   string
+	secret string
+
+	mu   sync.RWMutex
+	dest chan tele.Update
+	stop chan struct{}
+}
+
+func newWebhook(cfg *config.Configuration) (*webhook, error) {
+	public, err := url.Parse(cfg.Webhook.PublicURL)
+	if err != nil || public.Scheme != "https" || public.Host == "" {
+		return nil, errors.New("WEBHOOK_PUBLIC_URL должен быть https-адресом")
+	}
+
+	secret := cfg.Webhook.Secret
+	if secret == "" {
+		sum := sha256.Sum256([]byte("webhook:" + cfg.TelegramAPI))
+		secret = hex.EncodeToString(sum[:])
+	}
+	if !secretPattern.MatchString(secret) {
+		return nil, errors.New("WEBHOOK_SECRET может содержать только латинские буквы, цифры, _ и - (до 256 символов)")
+	}
+
+	if (cfg.Webhook.Cert == "") != (cfg.Webhook.Key == "") {
+		return nil, errors.New("для TLS нужны и WEBHOOK_CERT, и WEBHOOK_KEY")
+	}
+	if cfg.Webhook.SelfSigned && cfg.Webhook.Cert == "" {
+		return nil, errors.New("для самоподписанного сертификата нужен WEBHOOK_CERT")
+	}
+
+	endpoint := &tele.WebhookEndpoint{PublicURL: public.String()}
+	if cfg.Webhook.SelfSigned {
+		endpoint.Cert = cfg.Webhook.Cert
+	}
+
+	path := public.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return &webhook{
+		hook:   &tele.Webhook{SecretToken: secret, Endpoint: endpoint},
+		path:   path,
+		secret: secret,
+	}, nil
+}
+
+// Poll передаёт боту обновления, принятые ServeHTTP, пока бот не остановлен
+func (w *webhook) Poll(b *tele.Bot, dest chan tele.Update, stop chan struct{}) {
+	w.mu.Lock()
+	w.dest, w.stop = dest, stop
+	w.mu.Unlock()
+
+	<-stop
+
+	w.mu.Lock()
+	w.dest, w.stop = nil, nil
+	w.mu.Unlock()
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(w.secret)) != 1 {
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	var update tele.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(rw, fmt.Sprintf("не удалось разобрать обновление: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// блокировка держится до передачи обновления: Poll возвращается только после неё,
+	// и обновление не попадёт в буфер бота, который уже дообработан при остановке
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.dest == nil {
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case <-w.stop:
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	select {
+	case w.dest <- update:
+	case <-w.stop:
+		http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
@@ -2,14 +2,10 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
-	"go.uber.org/zap"
-	"hamsterbot/pkg/db"
-	"hamsterbot/pkg/logger"
-	"log"
+	"time"
 )
 
 var (
@@ -17,16 +13,9 @@ var (
 	Rdb *redis.Client
 )
 
-type Queue struct {
-	Query string
-	Args  []Args
-}
-
-type Args struct {
-	Value string
-}
-
-func Init(Addr string, Username string, Password string, DB int) error {
+// Init подключается к Redis и подписывается на сброс кэша другими репликами.
+// Нулевые ttl и localTTL оставляют значения по умолчанию
+func Init(Addr string, Username string, Password string, DB int, ttl, localTTL time.Duration) error {
 	Rdb = redis.NewClient(&redis.Options{
 		Addr:     Addr,
 		Username: Username,
@@ -39,104 +28,36 @@ func Init(Addr string, Username string, Password string, DB int) error {
 		return err
 	}
 
-	return nil
-}
-
-func InsertCache(query string, args []Args) error {
-	var insert []Queue
-	cacheValue, err := Rdb.Get(Ctx, "cache:insert").Result()
-	if err == nil && cacheValue != "" {
-		err = json.Unmarshal([]byte(cacheValue), &insert)
-		if err != nil {
-			log.Printf("Ошибка десериализации: %v", err)
-		}
-		return nil
-	} else if !errors.Is(err, redis.Nil) {
-		// Если ошибка не связана с отсутствием ключа, логируем её
-		log.Printf("Ошибка при получении данных из Redis: %v", err)
-	}
-
-	newInsert := Queue{
-		Query: query,
-		Args:  args,
+	if ttl > 0 {
+		TTL = ttl
 	}
-	insert = append(insert, newInsert)
-
-	cacheValueByte, err := json.Marshal(insert)
-	if err != nil {
-		return err
-	}
-	err = Rdb.Set(Ctx, "cache:insert", cacheValueByte, 0).Err()
-	if err != nil {
-		log.Printf("Ошибка при сохранении данных в Redis: %v", err)
+	if localTTL != 0 {
+		LocalTTL = localTTL
 	}
+	subscribeInvalidations()
 
 	return nil
 }
 
-func AddToDB() error {
-	var insert []Queue
-	cacheValue, err := Rdb.Get(Ctx, "cache:insert").Result()
-	if err == nil && cacheValue != "" {
-		err = json.Unmarshal([]byte(cacheValue), &insert)
-		if err != nil {
-			log.Printf("Ошибка десериализации: %v", err)
-		}
-		return nil
-	} else if !errors.Is(err, redis.Nil) {
-		// Если ошибка не связана с отсутствием ключа, логируем её
-		log.Printf("Ошибка при получении данных из Redis: %v", err)
+// Close отписывается от сброса кэша и закрывает подключение к Redis
+func Close() error {
+	var errs []error
+	if pubsub != nil {
+		errs = append(errs, pubsub.Close())
 	}
-
-	tx, err := db.Conn.Begin()
-	if err != nil {
-		return err
+	if Rdb != nil {
+		errs = append(errs, Rdb.Close())
 	}
-
-	// В случае ошибки откатываем транзакцию
-	defer func() {
-		if p := recover(); p != nil {
-			_ = tx.Rollback()
-			logger.Error("Ошибка применения insert-значений в БД", zap.Error(p.(error)))
-		} else if err != nil {
-			_ = tx.Rollback()
-		}
-	}()
-
-	for _, i := range insert {
-		rows, err := tx.Query(i.Query, i.Args)
-		if err != nil {
-			return err
-		}
-		defer rows.Close()
-	}
-
-	if err = Rdb.Del(Ctx, "cache:insert").Err(); err != nil {
-		_ = tx.Rollback()
-		return err
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return errors.Join(errs...)
 }
 
 func ClearCacheByPattern(pattern string) error {
-	keys, err := Rdb.Keys(Ctx, pattern).Result()
-	if err != nil {
-		return fmt.Errorf("failed to get keys: %w", err)
-	}
-
-	// Удаление всех ключей
-	if len(keys) > 0 {
-		if err := Rdb.Del(context.Background(), keys...).Err(); err != nil {
+	return ScanKeys(pattern, func(keys []string) error {
+		if err := Invalidate(keys...); err != nil {
 			return fmt.Errorf("failed to delete keys: %w", err)
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
 func ClearCache(Rdb *redis.Client) error {
@@ -145,5 +66,5 @@ func ClearCache(Rdb *redis.Client) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return publish(invalidateAllToken)
 }
@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/pkg/logger"
+	"sync"
+	"time"
+)
+
+// SchemaVersion - версия формата хэшей в кэше. Хэш другой версии считается промахом и удаляется,
+// поэтому при изменении набора или формата полей достаточно увеличить версию
+const SchemaVersion = "1"
+
+const (
+	versionField       = "_v"
+	rowVersionField    = "_rv"
+	invalidateChannel  = "cache:invalidate"
+	scanBatch          = 500
+	defaultTTL         = 24 * time.Hour
+	defaultLocalTTL    = 5 * time.Second
+	invalidateAllToken = "*"
+)
+
+var (
+	// TTL - время жизни хэша в Redis, продлевается при каждой записи
+	TTL = defaultTTL
+	// LocalTTL - время жизни копии хэша в памяти процесса. Копии сбрасываются
+	// сообщениями в канал cache:invalidate, которые публикует любая реплика при записи
+	LocalTTL = defaultLocalTTL
+
+	local = struct {
+		sync.RWMutex
+		entries map[string]localEntry
+		// generation увеличивается при каждом сбросе копий: значение, прочитанное из Redis до сброса,
+		// может быть уже устаревшим и в память не кладётся
+		generation uint64
+		// sweepAt - время следующей очистки просроченных копий
+		sweepAt time.Time
+	}{entries: map[string]localEntry{}}
+
+	pubsub *redis.PubSub
+
+	// setVersionedScript записывает поля в хэш KEYS[1], только если ARGV[1] не меньше версии в хэше.
+	// ARGV[2] - версия формата, ARGV[3] - TTL в секундах, дальше пары поле-значение
+	setVersionedScript = redis.NewScript(`
+local current = redis.call('HMGET', KEYS[1], '` + versionField + `', '` + rowVersionField + `')
+if current[1] == ARGV[2] and current[2] and tonumber(current[2]) > tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('HSET', KEYS[1], '` + versionField + `', ARGV[2], '` + rowVersionField + `', ARGV[1], unpack(ARGV, 4))
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+)
+
+type localEntry struct {
+	fields  map[string]string
+	expires time.Time
+}
+
+// GetHash возвращает поля хэша key без служебного поля версии. Отсутствующий хэш
+// и хэш другой версии возвращаются как nil
+func GetHash(key string) (map[string]string, error) {
+	fields, generation, ok := getLocal(key)
+	if ok {
+		return fields, nil
+	}
+
+	fields, err := Rdb.HGetAll(Ctx, key).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	if fields[versionField] != SchemaVersion {
+		return nil, Rdb.Del(Ctx, key).Err()
+	}
+	delete(fields, versionField)
+	delete(fields, rowVersionField)
+
+	setLocal(key, fields, generation)
+	return fields, nil
+}
+
+// SetHash записывает поля в хэш key, продлевает его TTL и оповещает реплики об изменении
+func SetHash(key string, fields map[string]interface{}) error {
+	values := make([]interface{}, 0, 2*len(fields)+2)
+	values = append(values, versionField, SchemaVersion)
+	for field, value := range fields {
+		values = append(values, field, value)
+	}
+
+	pipe := Rdb.TxPipeline()
+	pipe.HSet(Ctx, key, values...)
+	pipe.Expire(Ctx, key, TTL)
+	_, err := pipe.Exec(Ctx)
+	if err != nil {
+		return err
+	}
+
+	return publish(key)
+}
+
+// SetHashVersioned записывает поля в хэш key, как SetHash, если version не старше версии, с которой хэш
+// записан в прошлый раз. Так значение, прочитанное из базы раньше, не затрёт более новое. Возвращает false,
+// если в хэше уже более новая версия
+func SetHashVersioned(key string, version int64, fields map[string]interface{}) (bool, error) {
+	args := make([]interface{}, 0, 2*len(fields)+3)
+	args = append(args, version, SchemaVersion, int64(TTL.Seconds()))
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	written, err := setVersionedScript.Run(Ctx, Rdb, []string{key}, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	if written == 0 {
+		return false, nil
+	}
+
+	return true, publish(key)
+}
+
+// Invalidate удаляет ключи из Redis и из памяти всех реплик
+func Invalidate(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := Rdb.Del(Ctx, keys...).Err()
+	if err != nil {
+		return err
+	}
+
+	return publish(keys...)
+}
+
+// Refresh удаляет хэш key и сразу заполняет его заново значениями из load
+func Refresh(key string, load func() (map[string]interface{}, error)) error {
+	err := Invalidate(key)
+	if err != nil {
+		return err
+	}
+
+	fields, err := load()
+	if err != nil {
+		return err
+	}
+
+	return SetHash(key, fields)
+}
+
+// ScanKeys обходит ключи по шаблону через SCAN пачками, не блокируя Redis, как это делает KEYS
+func ScanKeys(pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := Rdb.Scan(Ctx, cursor, pattern, scanBatch).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan keys: %w", err)
+		}
+
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// subscribeInvalidations слушает канал cache:invalidate и сбрасывает копии ключей в памяти процесса
+func subscribeInvalidations() {
+	pubsub = Rdb.Subscribe(Ctx, invalidateChannel)
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			dropLocal(msg.Payload)
+		}
+	}()
+}
+
+func publish(keys ...string) error {
+	for _, key := range keys {
+		dropLocal(key)
+		err := Rdb.Publish(Ctx, invalidateChannel, key).Err()
+		if err != nil {
+			logger.Error("ошибка при публикации сброса кэша", zap.String("key", key), zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getLocal возвращает копию хэша из памяти. При промахе возвращается текущее поколение сбросов,
+// его нужно передать в setLocal вместе с прочитанным из Redis значением
+func getLocal(key string) (map[string]string, uint64, bool) {
+	local.RLock()
+	defer local.RUnlock()
+
+	entry, ok := local.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, local.generation, false
+	}
+
+	fields := make(map[string]string, len(entry.fields))
+	for field, value := range entry.fields {
+		fields[field] = value
+	}
+	return fields, local.generation, true
+}
+
+// setLocal кладёт копию хэша в память, если с чтения в поколении generation не было сбросов.
+// Заодно не чаще раза в LocalTTL удаляет просроченные копии, чтобы память не росла с числом прочитанных ключей
+func setLocal(key string, fields map[string]string, generation uint64) {
+	if LocalTTL <= 0 {
+		return
+	}
+
+	copied := make(map[string]string, len(fields))
+	for field, value := range fields {
+		copied[field] = value
+	}
+
+	local.Lock()
+	defer local.Unlock()
+	if local.generation != generation {
+		return
+	}
+
+	now := time.Now()
+	if now.After(local.sweepAt) {
+		for k, entry := range local.entries {
+			if now.After(entry.expires) {
+				delete(local.entries, k)
+			}
+		}
+		local.sweepAt = now.Add(LocalTTL)
+	}
+
+	local.entries[key] = localEntry{fields: copied, expires: now.Add(LocalTTL)}
+}
+
+func dropLocal(key string) {
+	local.Lock()
+	defer local.Unlock()
+
+	local.generation++
+	if key == invalidateAllToken {
+		local.entries = map[string]localEntry{}
+		return
+	}
+	delete(local.entries, key)
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalCopies(t *testing.T) {
+	defer func(ttl time.Duration) { LocalTTL = ttl }(LocalTTL)
+	LocalTTL = time.Minute
+	dropLocal(invalidateAllToken)
+
+	// сброс, пришедший, пока значение читалось из Redis, не даёт положить устаревшую копию
+	_, generation, _ := getLocal("user:1")
+	dropLocal("user:1")
+	setLocal("user:1", map[string]string{"balance": "10"}, generation)
+	if _, _, ok := getLocal("user:1"); ok {
+		t.Fatal("копия, прочитанная до сброса, попала в память")
+	}
+
+	_, generation, _ = getLocal("user:1")
+	setLocal("user:1", map[string]string{"balance": "20"}, generation)
+	if fields, _, ok := getLocal("user:1"); !ok || fields["balance"] != "20" {
+		t.Fatalf("getLocal = %v, %v", fields, ok)
+	}
+
+	// просроченные копии удаляются при следующей записи, а не копятся в памяти
+	local.Lock()
+	for key, entry := range local.entries {
+		entry.expires = time.Now().Add(-time.Second)
+		local.entries[key] = entry
+	}
+	local.sweepAt = time.Time{}
+	local.Unlock()
+
+	_, generation, _ = getLocal("user:2")
+	setLocal("user:2", map[string]string{"balance": "30"}, generation)
+	local.RLock()
+	defer local.RUnlock()
+	if _, ok := local.entries["user:1"]; ok || len(local.entries) != 1 {
+		t.Errorf("после очистки в памяти остались ключи: %v", local.entries)
+	}
+}
@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Отложенная запись в базу: операции складываются в поток Redis queueStream и применяются
+// фоновым Flusher пачками в одной транзакции. Поток читается через группу потребителей,
+// поэтому несколько реплик делят операции между собой, а операции упавшей реплики
+// подбираются остальными. Операция, не применившаяся MaxRetries раз, уходит в queueDeadStream
+
+const (
+	queueStream     = "cache:queue"
+	queueDeadStream = "cache:queue:dead"
+	queueGroup      = "flusher"
+)
+
+// QueueConfig - настройки фоновой записи очереди
+type QueueConfig struct {
+	BatchSize  int64         // сколько операций применять за одну транзакцию
+	Interval   time.Duration // как часто проверять очередь
+	MaxRetries int64         // после стольких неудачных попыток операция уходит в dead-letter
+}
+
+// Apply применяет одну операцию внутри транзакции пачки
+type Apply func(tx *sqlx.Tx, payload []byte) error
+
+var (
+	operations = struct {
+		sync.RWMutex
+		apply map[string]Apply
+	}{apply: map[string]Apply{}}
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hamsterbot_queue_depth",
+		Help: "Количество операций в очереди отложенной записи",
+	})
+	queueDeadDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "hamsterbot_queue_dead_depth",
+		Help: "Количество операций в dead-letter очереди",
+	})
+	queueOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hamsterbot_queue_operations_total",
+		Help: "Обработанные операции очереди по результату",
+	}, []string{"kind", "result"})
+	queueFlushSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hamsterbot_queue_flush_seconds",
+		Help:    "Длительность записи одной пачки очереди в базу",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// Register регистрирует вид операции kind. Полезная нагрузка операции хранится в очереди
+// в JSON и перед применением разбирается обратно в T
+func Register[T any](kind string, apply func(tx *sqlx.Tx, op T) error) {
+	operations.Lock()
+	defer operations.Unlock()
+
+	operations.apply[kind] = func(tx *sqlx.Tx, payload []byte) error {
+		var op T
+		if err := json.Unmarshal(payload, &op); err != nil {
+			return err
+		}
+		return apply(tx, op)
+	}
+}
+
+// Enqueue ставит операцию kind в очередь отложенной записи
+func Enqueue(kind string, op interface{}) error {
+	if _, ok := getOperation(kind); !ok {
+		return fmt.Errorf("неизвестная операция очереди %s", kind)
+	}
+
+	payload, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	return Rdb.XAdd(Ctx, &redis.XAddArgs{
+		Stream: queueStream,
+		Values: map[string]interface{}{"kind": kind, "payload": payload},
+	}).Err()
+}
+
+// Flusher переносит операции из очереди в базу
+type Flusher struct {
+	cfg      QueueConfig
+	consumer string
+	mu       sync.Mutex // одна пачка за раз: фоновая и ручная запись не пересекаются
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewFlusher(cfg QueueConfig) (*Flusher, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+
+	err := Rdb.XGroupCreateMkStream(Ctx, queueStream, queueGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	return &Flusher{
+		cfg:      cfg,
+		consumer: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Run записывает очередь раз в Interval, пока не вызван Stop
+func (f *Flusher) Run() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if _, err := f.Flush(); err != nil {
+				logger.Error("ошибка при записи очереди в базу", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Stop останавливает фоновую запись и дожидается текущей пачки
+func (f *Flusher) Stop() {
+	close(f.stop)
+	<-f.done
+}
+
+// Flush записывает в базу всё, что сейчас есть в очереди, и возвращает число применённых операций
+func (f *Flusher) Flush() (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	defer f.updateDepth()
+
+	applied := 0
+	for {
+		messages, err := f.next()
+		if err != nil {
+			return applied, err
+		}
+		if len(messages) == 0 {
+			return applied, nil
+		}
+
+		n, err := f.flushBatch(messages)
+		applied += n
+		if err != nil {
+			return applied, err
+		}
+		if int64(len(messages)) < f.cfg.BatchSize {
+			return applied, nil
+		}
+	}
+}
+
+// next возвращает очередную пачку: сначала давно не подтверждённые операции
+// (упавших реплик или не применившиеся ранее), затем новые
+func (f *Flusher) next() ([]redis.XMessage, error) {
+	claimed, _, err := Rdb.XAutoClaim(Ctx, &redis.XAutoClaimArgs{
+		Stream:   queueStream,
+		Group:    queueGroup,
+		Consumer: f.consumer,
+		MinIdle:  f.cfg.Interval,
+		Start:    "0",
+		Count:    f.cfg.BatchSize,
+	}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if len(claimed) > 0 {
+		return claimed, nil
+	}
+
+	streams, err := Rdb.XReadGroup(Ctx, &redis.XReadGroupArgs{
+		Group:    queueGroup,
+		Consumer: f.consumer,
+		Streams:  []string{queueStream, ">"},
+		Count:    f.cfg.BatchSize,
+		Block:    -1,
+	}).Result()
+	if errors.Is(err, redis.Nil) || len(streams) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return streams[0].Messages, nil
+}
+
+// flushBatch применяет пачку одной транзакцией. Если транзакция не прошла, операции
+// применяются по одной, чтобы одна сломанная операция не держала остальные
+func (f *Flusher) flushBatch(messages []redis.XMessage) (int, error) {
+	start := time.Now()
+	defer func() { queueFlushSeconds.Observe(time.Since(start).Seconds()) }()
+
+	err := applyMessages(messages)
+	if err == nil {
+		for _, msg := range messages {
+			queueOperations.WithLabelValues(messageKind(msg), "applied").Inc()
+		}
+		return len(messages), f.ack(messages...)
+	}
+	if len(messages) == 1 {
+		return 0, f.fail(messages[0], err)
+	}
+
+	applied := 0
+	for _, msg := range messages {
+		n, err := f.flushBatch([]redis.XMessage{msg})
+		if err != nil {
+			return applied, err
+		}
+		applied += n
+	}
+
+	return applied, nil
+}
+
+func applyMessages(messages []redis.XMessage) error {
+	tx, err := db.Conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, msg := range messages {
+		kind := messageKind(msg)
+		apply, ok := getOperation(kind)
+		if !ok {
+			return fmt.Errorf("неизвестная операция очереди %s", kind)
+		}
+
+		payload, _ := msg.Values["payload"].(string)
+		if err = apply(tx, []byte(payload)); err != nil {
+			return fmt.Errorf("операция %s %s: %w", kind, msg.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fail оставляет операцию в очереди для повтора, а исчерпавшую попытки переносит в dead-letter
+func (f *Flusher) fail(msg redis.XMessage, cause error) error {
+	kind := messageKind(msg)
+
+	pending, err := Rdb.XPendingExt(Ctx, &redis.XPendingExtArgs{
+		Stream: queueStream,
+		Group:  queueGroup,
+		Start:  msg.ID,
+		End:    msg.ID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 && pending[0].RetryCount < f.cfg.MaxRetries {
+		queueOperations.WithLabelValues(kind, "retry").Inc()
+		logger.Warn("операция очереди не применилась, будет повторена", zap.String("id", msg.ID),
+			zap.String("kind", kind), zap.Int64("attempt", pending[0].RetryCount), zap.Error(cause))
+		return nil
+	}
+
+	values := map[string]interface{}{"id": msg.ID, "error": cause.Error()}
+	for field, value := range msg.Values {
+		values[field] = value
+	}
+	err = Rdb.XAdd(Ctx, &redis.XAddArgs{Stream: queueDeadStream, Values: values}).Err()
+	if err != nil {
+		return err
+	}
+
+	queueOperations.WithLabelValues(kind, "dead").Inc()
+	logger.Error("операция очереди перенесена в dead-letter", zap.String("id", msg.ID),
+		zap.String("kind", kind), zap.Error(cause))
+	return f.ack(msg)
+}
+
+func (f *Flusher) ack(messages ...redis.XMessage) error {
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+
+	pipe := Rdb.TxPipeline()
+	pipe.XAck(Ctx, queueStream, queueGroup, ids...)
+	pipe.XDel(Ctx, queueStream, ids...)
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+func (f *Flusher) updateDepth() {
+	if depth, err := Rdb.XLen(Ctx, queueStream).Result(); err == nil {
+		queueDepth.Set(float64(depth))
+	}
+	if depth, err := Rdb.XLen(Ctx, queueDeadStream).Result(); err == nil {
+		queueDeadDepth.Set(float64(depth))
+	}
+}
+
+func getOperation(kind string) (Apply, bool) {
+	operations.RLock()
+	defer operations.RUnlock()
+
+	apply, ok := operations.apply[kind]
+	return apply, ok
+}
+
+func messageKind(msg redis.XMessage) string {
+	kind, _ := msg.Values["kind"].(string)
+	return kind
+}
@@ -0,0 +1,62 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Данные inline-кнопок подписываются HMAC: к полям кнопки дописываются id пользователя, которому
+// она предназначена, и подпись. Так кнопку нельзя нажать за другого пользователя или подделать её данные.
+// Telegram ограничивает данные кнопки 64 байтами, поэтому подпись укорочена до sigLen символов
+
+const sigLen = 12
+
+var (
+	ErrForeign = errors.New("это не ваша кнопка")
+	ErrInvalid = errors.New("кнопка устарела или повреждена")
+)
+
+var secret []byte
+
+// Init задаёт ключ подписи
+func Init(key string) {
+	secret = []byte(key)
+}
+
+// Sign возвращает данные кнопки unique для пользователя userID: поля fields, id пользователя и подпись
+func Sign(unique string, userID int64, fields ...string) []string {
+	data := append(append([]string{}, fields...), strconv.FormatInt(userID, 10))
+	return append(data, sign(unique, data))
+}
+
+// Verify проверяет подпись данных кнопки unique и то, что её нажал пользователь userID, и возвращает исходные поля
+func Verify(unique string, data []string, userID int64) ([]string, error) {
+	if len(data) < 2 {
+		return nil, ErrInvalid
+	}
+
+	signed, sig := data[:len(data)-1], data[len(data)-1]
+	if !hmac.Equal([]byte(sig), []byte(sign(unique, signed))) {
+		return nil, ErrInvalid
+	}
+
+	owner, err := strconv.ParseInt(signed[len(signed)-1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if owner != userID {
+		return nil, ErrForeign
+	}
+
+	return signed[:len(signed)-1], nil
+}
+
+func sign(unique string, data []string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unique + "|" + strings.Join(data, "|")))
+	return hex.EncodeToString(mac.Sum(nil))[:sigLen]
+}
@@ -0,0 +1,61 @@
+package callback
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	Init("secret")
+	// данные кнопки ставки: игра|выбор|сумма, как их подписывает клавиатура игр
+	data := Sign("gbet", 42, "rln", "17", "1000")
+
+	// replace возвращает копию data с заменённым элементом i
+	replace := func(i int, v string) []string {
+		out := append([]string{}, data...)
+		out[i] = v
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		unique string
+		data   []string
+		userID int64
+		err    error
+	}{
+		{"valid", "gbet", data, 42, nil},
+		{"tampered game", "gbet", replace(0, "slots"), 42, ErrInvalid},
+		{"tampered amount", "gbet", replace(2, "999999"), 42, ErrInvalid},
+		{"tampered user", "gbet", replace(3, "43"), 43, ErrInvalid},
+		{"tampered signature", "gbet", replace(4, "000000000000"), 42, ErrInvalid},
+		{"other button", "gchoice", data, 42, ErrInvalid},
+		{"dropped field", "gbet", data[1:], 42, ErrInvalid},
+		{"short data", "gbet", data[4:], 42, ErrInvalid},
+		{"foreign user", "gbet", data, 43, ErrForeign},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := Verify(tt.unique, tt.data, tt.userID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify вернул ошибку %v, ожидалось %v", err, tt.err)
+			}
+			if err == nil && (len(fields) != 3 || fields[0] != "rln" || fields[1] != "17" || fields[2] != "1000") {
+				t.Errorf("Verify вернул поля %v", fields)
+			}
+		})
+	}
+}
+
+func TestVerifyOtherKey(t *testing.T) {
+	Init("secret")
+	// данные кнопки дуэли: действие|дуэль
+	data := Sign("duel", 42, "a", "7")
+
+	Init("rotated")
+	defer Init("secret")
+	if _, err := Verify("duel", data, 42); !errors.Is(err, ErrInvalid) {
+		t.Errorf("кнопка со старым ключом: ошибка %v, ожидалось %v", err, ErrInvalid)
+	}
+}
@@ -10,7 +10,18 @@ import (
 
 var Conn *sqlx.DB
 
-func Init(DBUser string, DBPassword string, DBHost string, DBName string) error {
+// Init подключается к базе данных и применяет неприменённые миграции
+func Init(DBUser string, DBPassword string, DBHost string, DBName string, DefaultChatID int64) error {
+	err := Connect(DBUser, DBPassword, DBHost, DBName)
+	if err != nil {
+		return err
+	}
+
+	_, err = Migrate(DefaultChatID)
+	return err
+}
+
+func Connect(DBUser string, DBPassword string, DBHost string, DBName string) error {
 	connStr := fmt.Sprintf("postgresql://%s:%s@%s:5432/%s", DBUser, DBPassword, DBHost, DBName)
 
 	var err error
@@ -25,10 +36,13 @@ func Init(DBUser string, DBPassword string, DBHost string, DBName string) error
 	Conn.SetConnMaxLifetime(time.Hour)
 
 	// Проверка подключения к базе данных
-	err = Conn.Ping()
-	if err != nil {
-		return err
-	}
+	return Conn.Ping()
+}
 
-	return nil
+// Close закрывает пул соединений с базой
+func Close() error {
+	if Conn == nil {
+		return nil
+	}
+	return Conn.Close()
 }
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationsLock - ключ advisory-блокировки, чтобы миграции не запускались одновременно из нескольких процессов
+const migrationsLock = 7340142
+
+// Migration - версия схемы из файлов migrations/<версия>_<название>.up.sql и .down.sql
+type Migration struct {
+	Version   int64
+	Name      string
+	Up        string
+	Down      string
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("неверное имя файла миграции %s", base)
+		}
+		versionStr, name, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("неверное имя файла миграции %s", base)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверная версия миграции %s: %w", base, err)
+		}
+
+		body, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s нет up или down файла", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func ensureMigrationsTable() error {
+	_, err := Conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    BIGINT PRIMARY KEY,
+	name       TEXT        NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	return err
+}
+
+// MigrationStatus возвращает все миграции с временем применения, у неприменённых оно пустое
+func MigrationStatus() ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err = ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := Conn.Queryx(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range migrations {
+		if appliedAt, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return migrations, nil
+}
+
+// Migrate применяет все неприменённые миграции, каждую в своей транзакции.
+// defaultChatID доступен миграциям как current_setting('hamsterbot.default_chat_id').
+// Возвращает количество применённых миграций
+func Migrate(defaultChatID int64) (int, error) {
+	migrations, err := MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, m := range migrations {
+		if m.AppliedAt != nil {
+			continue
+		}
+
+		applied, err := runMigration(m, m.Up, defaultChatID, true)
+		if err != nil {
+			return count, fmt.Errorf("ошибка миграции %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if applied {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Rollback откатывает steps последних применённых миграций. Возвращает количество откаченных миграций
+func Rollback(steps int, defaultChatID int64) (int, error) {
+	migrations, err := MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if m.AppliedAt == nil {
+			continue
+		}
+
+		rolledBack, err := runMigration(m, m.Down, defaultChatID, false)
+		if err != nil {
+			return count, fmt.Errorf("ошибка отката миграции %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if rolledBack {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// runMigration выполняет up или down файл миграции и отмечает версию в schema_migrations.
+// Если другой процесс уже выполнил эту миграцию, ничего не делает и возвращает false
+func runMigration(m Migration, body string, defaultChatID int64, up bool) (bool, error) {
+	tx, err := Conn.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationsLock); err != nil {
+		return false, err
+	}
+
+	var applied bool
+	err = tx.QueryRowx(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	// SET LOCAL не принимает параметры, значение - число, поэтому подставляется напрямую
+	if _, err = tx.Exec(fmt.Sprintf(`SET LOCAL hamsterbot.default_chat_id = '%d'`, defaultChatID)); err != nil {
+		return false, err
+	}
+	if _, err = tx.Exec(body); err != nil {
+		return false, err
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS users (
+	id       BIGINT PRIMARY KEY,
+	username TEXT   NOT NULL DEFAULT '',
+	balance  BIGINT NOT NULL DEFAULT 0,
+	lvl      BIGINT NOT NULL DEFAULT 1,
+	income   BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,3 @@
+-- счёт казино (id 1), с которого выплачиваются выигрыши и на который уходят проигрыши
+INSERT INTO users (id, username, balance, lvl, income) VALUES (1, 'bank', 50000, 0, 0)
+ON CONFLICT (id) DO NOTHING;
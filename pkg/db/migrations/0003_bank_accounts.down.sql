@@ -0,0 +1 @@
+DELETE FROM users WHERE username LIKE 'bank\_%' AND balance = 0;
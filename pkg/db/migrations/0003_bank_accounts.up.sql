@@ -0,0 +1,6 @@
+-- личные счета в банке хранятся в users под именем bank_<id>_<username> и отрицательным id владельца
+INSERT INTO users (id, username, balance, lvl, income)
+SELECT -id, 'bank_' || id || '_' || username, 0, 0, 0 FROM users
+WHERE id > 1 AND username NOT LIKE 'bank%'
+  AND NOT EXISTS (SELECT 1 FROM users b WHERE b.username = 'bank_' || users.id || '_' || users.username)
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS transactions (
+	id         BIGSERIAL PRIMARY KEY,
+	from_id    BIGINT      NOT NULL,
+	to_id      BIGINT      NOT NULL,
+	amount     BIGINT      NOT NULL CHECK (amount >= 0),
+	kind       TEXT        NOT NULL,
+	chat_id    BIGINT      NOT NULL DEFAULT 0,
+	reference  TEXT        NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS transactions_from_id_idx ON transactions (from_id, id DESC);
+CREATE INDEX IF NOT EXISTS transactions_to_id_idx ON transactions (to_id, id DESC);
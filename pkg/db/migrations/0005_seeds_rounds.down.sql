@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS rounds;
+DROP TABLE IF EXISTS seeds;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS seeds (
+	id               BIGSERIAL PRIMARY KEY,
+	user_id          BIGINT      NOT NULL,
+	server_seed      TEXT        NOT NULL,
+	server_seed_hash TEXT        NOT NULL,
+	client_seed      TEXT        NOT NULL,
+	nonce            BIGINT      NOT NULL DEFAULT 0,
+	active           BOOLEAN     NOT NULL DEFAULT TRUE,
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revealed_at      TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS seeds_user_id_active_idx ON seeds (user_id) WHERE active;
+
+CREATE TABLE IF NOT EXISTS rounds (
+	id         BIGSERIAL PRIMARY KEY,
+	user_id    BIGINT      NOT NULL,
+	seed_id    BIGINT      NOT NULL REFERENCES seeds (id),
+	nonce      BIGINT      NOT NULL,
+	game       TEXT        NOT NULL,
+	bet        TEXT        NOT NULL DEFAULT '',
+	amount     BIGINT      NOT NULL,
+	payout     BIGINT      NOT NULL,
+	result     TEXT        NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS rounds_user_id_idx ON rounds (user_id, id DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE rounds DROP COLUMN IF EXISTS paytable;
+DROP TABLE IF EXISTS paytables;
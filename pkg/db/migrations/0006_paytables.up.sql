@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS paytables (
+	version   TEXT PRIMARY KEY,
+	body      JSONB       NOT NULL,
+	loaded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE rounds ADD COLUMN IF NOT EXISTS paytable TEXT NOT NULL DEFAULT '';
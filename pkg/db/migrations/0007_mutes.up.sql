@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS mutes (
+	id           BIGSERIAL PRIMARY KEY,
+	kind         TEXT        NOT NULL,
+	issuer_id    BIGINT      NOT NULL,
+	target_id    BIGINT      NOT NULL,
+	chat_id      BIGINT      NOT NULL DEFAULT 0,
+	start_at     TIMESTAMPTZ NOT NULL,
+	end_at       TIMESTAMPTZ NOT NULL,
+	price        BIGINT      NOT NULL,
+	unmuted_at   TIMESTAMPTZ,
+	unmuted_by   BIGINT,
+	unmute_price BIGINT
+);
+ALTER TABLE mutes ADD COLUMN IF NOT EXISTS mode TEXT NOT NULL DEFAULT 'delete';
+CREATE INDEX IF NOT EXISTS mutes_active_idx ON mutes (target_id, kind, id DESC) WHERE unmuted_at IS NULL;
@@ -0,0 +1,6 @@
+-- при откате остаётся только экономика чата по умолчанию
+DELETE FROM users WHERE chat_id <> current_setting('hamsterbot.default_chat_id')::BIGINT;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+ALTER TABLE users DROP COLUMN IF EXISTS chat_id;
+ALTER TABLE users ADD PRIMARY KEY (id);
+DROP TABLE IF EXISTS chats;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS chats (
+	chat_id        BIGINT PRIMARY KEY,
+	title          TEXT        NOT NULL DEFAULT '',
+	start_balance  BIGINT      NOT NULL DEFAULT 1500,
+	start_income   BIGINT      NOT NULL DEFAULT 250,
+	casino_balance BIGINT      NOT NULL DEFAULT 50000,
+	income_enabled BOOLEAN     NOT NULL DEFAULT TRUE,
+	created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- балансы, операции и муты, накопленные до разделения экономик, относятся к чату по умолчанию
+DO $$
+DECLARE
+	default_chat BIGINT := current_setting('hamsterbot.default_chat_id')::BIGINT;
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'chat_id') THEN
+		ALTER TABLE users ADD COLUMN chat_id BIGINT;
+		UPDATE users SET chat_id = default_chat;
+		ALTER TABLE users ALTER COLUMN chat_id SET NOT NULL;
+		ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pkey;
+		ALTER TABLE users ADD PRIMARY KEY (chat_id, id);
+		UPDATE transactions SET chat_id = default_chat WHERE chat_id = 0;
+		UPDATE mutes SET chat_id = default_chat WHERE chat_id = 0;
+	END IF;
+
+	INSERT INTO chats (chat_id) VALUES (default_chat) ON CONFLICT (chat_id) DO NOTHING;
+END $$;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS admins (
+	user_id    BIGINT PRIMARY KEY,
+	role       TEXT        NOT NULL,
+	granted_by BIGINT      NOT NULL,
+	granted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS admin_log (
+	id         BIGSERIAL PRIMARY KEY,
+	actor_id   BIGINT      NOT NULL,
+	action     TEXT        NOT NULL,
+	target_id  BIGINT      NOT NULL,
+	role       TEXT        NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
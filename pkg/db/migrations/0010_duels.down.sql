@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS duels;
+DELETE FROM users WHERE id = 2 AND username = 'escrow' AND balance = 0;
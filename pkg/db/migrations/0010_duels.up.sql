@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS duels (
+	id               BIGSERIAL PRIMARY KEY,
+	chat_id          BIGINT      NOT NULL,
+	challenger_id    BIGINT      NOT NULL,
+	challenger_name  TEXT        NOT NULL DEFAULT '',
+	opponent_id      BIGINT      NOT NULL,
+	opponent_name    TEXT        NOT NULL DEFAULT '',
+	amount           BIGINT      NOT NULL CHECK (amount > 0),
+	status           TEXT        NOT NULL,
+	server_seed      TEXT        NOT NULL,
+	server_seed_hash TEXT        NOT NULL,
+	client_seed      TEXT        NOT NULL,
+	winner_id        BIGINT,
+	result           TEXT        NOT NULL DEFAULT '',
+	message_id       BIGINT      NOT NULL DEFAULT 0,
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at       TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS duels_pending_idx ON duels (expires_at) WHERE status = 'pending';
+
+-- счёт для ставок дуэлей в каждом чате
+INSERT INTO users (chat_id, id, username, balance, lvl, income)
+SELECT chat_id, 2, 'escrow', 0, 0, 0 FROM chats
+ON CONFLICT (chat_id, id) DO NOTHING;
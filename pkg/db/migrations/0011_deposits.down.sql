@@ -0,0 +1,11 @@
+-- открытые вклады возвращаются на личные счета bank_<id>_<username>
+INSERT INTO users (chat_id, id, username, balance, lvl, income)
+SELECT u.chat_id, -u.id, 'bank_' || u.id || '_' || u.username, COALESCE(SUM(d.balance), 0), 0, 0
+FROM users u
+LEFT JOIN deposits d ON d.chat_id = u.chat_id AND d.user_id = u.id AND d.status = 'open'
+WHERE u.id > 3
+GROUP BY u.chat_id, u.id, u.username
+ON CONFLICT (chat_id, id) DO NOTHING;
+
+DELETE FROM users WHERE id = 3 AND username = 'deposits';
+DROP TABLE IF EXISTS deposits;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS deposits (
+	id         BIGSERIAL PRIMARY KEY,
+	chat_id    BIGINT      NOT NULL,
+	user_id    BIGINT      NOT NULL,
+	balance    BIGINT      NOT NULL DEFAULT 0 CHECK (balance >= 0),
+	rate       INT         NOT NULL, -- дневная ставка в сотых долях процента
+	term_days  INT         NOT NULL DEFAULT 0, -- 0 - вклад до востребования
+	matures_at TIMESTAMPTZ,
+	status     TEXT        NOT NULL DEFAULT 'open',
+	accrued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	closed_at  TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS deposits_user_idx ON deposits (chat_id, user_id) WHERE status = 'open';
+
+-- счёт, на котором лежат деньги вкладов
+INSERT INTO users (chat_id, id, username, balance, lvl, income)
+SELECT chat_id, 3, 'deposits', 0, 0, 0 FROM chats
+ON CONFLICT (chat_id, id) DO NOTHING;
+
+-- личные счета bank_<id>_<username> становятся вкладами до востребования, деньги переходят на счёт вкладов.
+-- Владелец берётся из имени счёта: счета заводились вручную с любым id, а отрицательные id появились только в 0003
+WITH bank AS (
+	SELECT chat_id, id AS account_id, substring(username FROM '^bank_([0-9]+)_')::BIGINT AS user_id, balance,
+		nextval('deposits_id_seq') AS deposit_id
+	FROM users WHERE username ~ '^bank_[0-9]+_' AND balance > 0
+), moved AS (
+	INSERT INTO deposits (id, chat_id, user_id, balance, rate)
+	SELECT deposit_id, chat_id, user_id, balance, 100 FROM bank
+)
+INSERT INTO transactions (from_id, to_id, amount, kind, chat_id, reference)
+SELECT account_id, 3, balance, 'bank', chat_id, 'deposit #' || deposit_id FROM bank;
+
+UPDATE users d SET balance = d.balance + b.total
+FROM (SELECT chat_id, SUM(balance) AS total FROM users WHERE username ~ '^bank_[0-9]+_' GROUP BY chat_id) b
+WHERE d.chat_id = b.chat_id AND d.id = 3;
+
+DELETE FROM users WHERE username ~ '^bank_[0-9]+_';
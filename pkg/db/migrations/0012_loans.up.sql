@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS loans (
+	id         BIGSERIAL PRIMARY KEY,
+	chat_id    BIGINT      NOT NULL,
+	user_id    BIGINT      NOT NULL,
+	principal  BIGINT      NOT NULL CHECK (principal > 0),
+	debt       BIGINT      NOT NULL CHECK (debt >= 0),
+	collateral BIGINT      NOT NULL CHECK (collateral >= 0), -- залог на счёте EscrowID, пока кредит в срок
+	rate       INT         NOT NULL, -- дневная ставка в сотых долях процента
+	status     TEXT        NOT NULL DEFAULT 'active',
+	accrued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	due_at     TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	repaid_at  TIMESTAMPTZ
+);
+-- у пользователя в чате может быть только один непогашенный кредит
+CREATE UNIQUE INDEX IF NOT EXISTS loans_unpaid_idx ON loans (chat_id, user_id) WHERE status IN ('active', 'defaulted');
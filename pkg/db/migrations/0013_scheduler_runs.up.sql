@@ -0,0 +1,5 @@
+-- время последнего успешного запуска задач планировщика
+CREATE TABLE IF NOT EXISTS scheduler_runs (
+	name        TEXT PRIMARY KEY,
+	last_run_at TIMESTAMPTZ NOT NULL
+);
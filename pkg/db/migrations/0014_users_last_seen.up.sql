@@ -0,0 +1,2 @@
+-- время последнего сообщения пользователя в чате, пишется очередью отложенной записи
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS transactions_reference_idx;
@@ -0,0 +1,2 @@
+-- по reference выплаты игр проверяют, что выигрыш ещё не выплачен
+CREATE INDEX IF NOT EXISTS transactions_reference_idx ON transactions (chat_id, reference) WHERE reference <> '';
@@ -0,0 +1,11 @@
+-- выигрыши, которые не удалось выплатить автоматически, разбираются вручную
+CREATE TABLE IF NOT EXISTS failed_payouts (
+	id         BIGSERIAL PRIMARY KEY,
+	chat_id    BIGINT      NOT NULL,
+	user_id    BIGINT      NOT NULL,
+	amount     BIGINT      NOT NULL CHECK (amount > 0),
+	reference  TEXT        NOT NULL,
+	error      TEXT        NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS failed_payouts_reference_idx ON failed_payouts (chat_id, reference, user_id);
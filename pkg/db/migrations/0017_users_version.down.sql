@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS users_version ON users;
+DROP FUNCTION IF EXISTS users_bump_version();
+ALTER TABLE users DROP COLUMN IF EXISTS version;
@@ -0,0 +1,15 @@
+-- версия строки пользователя растёт при каждом изменении баланса, уровня или дохода. Кэш и топы
+-- принимают значение, только если его версия не старше записанной, поэтому запись после коммита
+-- не затрёт более новое значение, записанное параллельной операцией
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION users_bump_version() RETURNS trigger AS $$
+BEGIN
+	NEW.version := OLD.version + 1;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_version ON users;
+CREATE TRIGGER users_version BEFORE UPDATE OF balance, lvl, income ON users
+	FOR EACH ROW EXECUTE FUNCTION users_bump_version();
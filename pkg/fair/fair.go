@@ -0,0 +1,70 @@
+package fair
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// RNG - детерминированный генератор на основе HMAC-SHA256(serverSeed, "clientSeed:nonce:block").
+// Зная серверный сид, клиентский сид и nonce, любой может воспроизвести ту же последовательность чисел.
+type RNG struct {
+	serverSeed string
+	clientSeed string
+	nonce      int64
+	block      int
+	buf        []byte
+}
+
+func New(serverSeed, clientSeed string, nonce int64) *RNG {
+	return &RNG{
+		serverSeed: serverSeed,
+		clientSeed: clientSeed,
+		nonce:      nonce,
+	}
+}
+
+// NewSeed генерирует случайный сид длиной size байт в hex-представлении
+func NewSeed(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Hash возвращает sha256 от сида, который публикуется до раскрытия самого сида
+func Hash(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *RNG) nextBytes(n int) []byte {
+	for len(r.buf) < n {
+		mac := hmac.New(sha256.New, []byte(r.serverSeed))
+		mac.Write([]byte(fmt.Sprintf("%s:%d:%d", r.clientSeed, r.nonce, r.block)))
+		r.buf = append(r.buf, mac.Sum(nil)...)
+		r.block++
+	}
+
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// Float64 возвращает число в диапазоне [0, 1), собранное из 4 байт потока
+func (r *RNG) Float64() float64 {
+	var f, div float64 = 0, 1
+	for _, b := range r.nextBytes(4) {
+		div *= 256
+		f += float64(b) / div
+	}
+	return f
+}
+
+// Intn возвращает число в диапазоне [0, n)
+func (r *RNG) Intn(n int) int {
+	return int(r.Float64() * float64(n))
+}
@@ -0,0 +1,66 @@
+package fair
+
+import "testing"
+
+func sequence(r *RNG, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = r.Intn(1000)
+	}
+	return out
+}
+
+func equal(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestNewReproducible(t *testing.T) {
+	// 20 чисел по 4 байта выходят за первый блок HMAC, так что проверяется и переход между блоками
+	base := sequence(New("server", "client", 1), 20)
+
+	tests := []struct {
+		name       string
+		server     string
+		client     string
+		nonce      int64
+		reproduced bool
+	}{
+		{"same seeds", "server", "client", 1, true},
+		{"other nonce", "server", "client", 2, false},
+		{"other client seed", "server", "client2", 1, false},
+		{"other server seed", "server2", "client", 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sequence(New(tt.server, tt.client, tt.nonce), 20)
+			if equal(got, base) != tt.reproduced {
+				t.Errorf("последовательность %v, исходная %v", got, base)
+			}
+		})
+	}
+}
+
+func TestIntnRange(t *testing.T) {
+	for _, n := range []int{1, 2, 6, 37, 100} {
+		r := New("server", "client", int64(n))
+		for i := 0; i < 1000; i++ {
+			if v := r.Intn(n); v < 0 || v >= n {
+				t.Fatalf("Intn(%d) = %d", n, v)
+			}
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	// sha256("abc")
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := Hash("abc"); got != want {
+		t.Errorf("Hash(abc) = %s, ожидалось %s", got, want)
+	}
+}
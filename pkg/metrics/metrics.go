@@ -1,20 +1,64 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"hamsterbot/pkg/logger"
+	"net"
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
-func Init() {
+// Server - HTTP-сервер с метриками Prometheus на /metrics. Через Handle на нём можно принимать и другие запросы
+type Server struct {
+	srv       *http.Server
+	mux       *http.ServeMux
+	cert, key string
+}
+
+func New(addr string) *Server {
 	mux := http.NewServeMux()
 
 	mux.Handle("/metrics", promhttp.Handler())
 
-	err := http.ListenAndServe(":4000", mux)
+	return &Server{srv: &http.Server{Addr: addr, Handler: mux}, mux: mux}
+}
+
+// Handle добавляет обработчик пути pattern. Обработчики добавляются до Start
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// UseTLS включает TLS с сертификатом и ключом из файлов
+func (s *Server) UseTLS(cert, key string) {
+	s.cert, s.key = cert, key
+}
+
+// Start открывает порт и обслуживает запросы в фоне. Возвращает ошибку, если порт открыть не удалось
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
 	if err != nil {
-		logger.Fatal("Ошибка при запуске HTTP-сервера", zap.Error(err))
+		return err
 	}
+
+	go func() {
+		var err error
+		if s.cert != "" {
+			err = s.srv.ServeTLS(ln, s.cert, s.key)
+		} else {
+			err = s.srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Ошибка HTTP-сервера", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown останавливает сервер, дожидаясь текущих запросов
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
 }
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Расписание задаётся cron-выражением из пяти полей "минута час день месяц день_недели"
+// (поддерживаются *, списки через запятую, диапазоны a-b и шаг /n) или одним из сокращений
+// @hourly, @daily, @weekly и @every <длительность>. Время cron-выражения считается в часовом поясе,
+// переданном в Parse
+
+// Schedule возвращает ближайшее время запуска строго после t
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// every - запуск через равные промежутки, отсчитанные от начала эпохи
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// cron - множества разрешённых значений каждого поля, бит i означает значение i
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	anyDom, anyDow                bool
+	loc                           *time.Location
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"минута", 0, 59},
+	{"час", 0, 23},
+	{"день", 1, 31},
+	{"месяц", 1, 12},
+	{"день недели", 0, 7},
+}
+
+// Parse разбирает выражение расписания, cron-выражение читается в часовом поясе loc
+func Parse(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	}
+
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		duration, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || duration < time.Second {
+			return nil, fmt.Errorf("неверный интервал расписания %q", spec)
+		}
+		return every(duration), nil
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("в расписании %q должно быть %d полей", spec, len(fields))
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("расписание %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+
+	// воскресенье можно записать и как 0, и как 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDom: parts[2] == "*",
+		anyDow: parts[4] == "*",
+		loc:    loc,
+	}, nil
+}
+
+func parseField(part string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("неверный шаг в поле «%s»: %s", f.name, item)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("неверное значение в поле «%s»: %s", f.name, item)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("неверное значение в поле «%s»: %s", f.name, item)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("значение поля «%s» вне диапазона %d-%d: %s", f.name, f.min, f.max, item)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Next перебирает минуты после t; год без подходящей минуты означает невыполнимое расписание (например, 31 февраля)
+func (c *cron) Next(t time.Time) time.Time {
+	local := t.In(c.loc)
+	next := local.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(1, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case c.month&(1<<uint(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, c.loc)
+		case c.hour&(1<<uint(next.Hour())) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, c.loc)
+		case c.minute&(1<<uint(next.Minute())) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next.In(t.Location())
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches повторяет правило cron: если заданы и день месяца, и день недели, подходит любой из них
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
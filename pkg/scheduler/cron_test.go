@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// зона без перехода на летнее время, чтобы результат не зависел от даты
+	msk := time.FixedZone("UTC+3", 3*60*60)
+	// понедельник, 05.01.2026 10:07:30 UTC
+	from := time.Date(2026, 1, 5, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"@every 15s", time.UTC, time.Date(2026, 1, 5, 10, 7, 45, 0, time.UTC)},
+		{"@every 1h", time.UTC, time.Date(2026, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.UTC, time.Date(2026, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.UTC, time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.UTC, time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"*/10 * * * *", time.UTC, time.Date(2026, 1, 5, 10, 10, 0, 0, time.UTC)},
+		{"5,35 * * * *", time.UTC, time.Date(2026, 1, 5, 10, 35, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.UTC, time.Date(2026, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * 6,7", time.UTC, time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.UTC, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// заданы и день месяца, и день недели: подходит любой из них
+		{"0 0 20 * 3", time.UTC, time.Date(2026, 1, 7, 0, 0, 0, 0, time.UTC)},
+		// 04:00 по UTC+3 - это 01:00 UTC, сегодняшнее уже прошло
+		{"0 4 * * *", msk, time.Date(2026, 1, 6, 1, 0, 0, 0, time.UTC)},
+		{"0 14 * * *", msk, time.Date(2026, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.UTC, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"@every",
+		"@every 10ms",
+		"@every x",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("Parse(%q) без ошибки", spec)
+		}
+	}
+}
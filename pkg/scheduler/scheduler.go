@@ -0,0 +1,286 @@
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"hamsterbot/pkg/cache"
+	"hamsterbot/pkg/db"
+	"hamsterbot/pkg/logger"
+	"os"
+	"sync"
+	"time"
+)
+
+// Задачи запускаются по расписанию на каждой реплике, но выполняет запуск только та, что взяла блокировку
+// задачи в Redis. Для задач с CatchUp время последнего успешного запуска хранится в таблице scheduler_runs:
+// пропущенные запуски (например, пока бот был выключен) после старта выполняются один раз, а реплика,
+// взявшая блокировку сразу после другой, видит, что запуск уже был, и пропускает его. Время запуска
+// сохраняется, только если с момента проверки его никто не изменил. Задачи, которые двигают деньги, задают
+// RunTx и сохраняют время запуска в своей транзакции, чтобы после сбоя запуск не повторился
+
+// LockTTL - время жизни блокировки задачи по умолчанию. Если реплика упадёт посреди запуска,
+// задачу сможет взять другая реплика не раньше, чем через это время
+const LockTTL = time.Minute
+
+// Job - периодическая задача
+type Job struct {
+	Name    string
+	Spec    string // расписание, см. Parse
+	CatchUp bool   // хранить время запуска и выполнить пропущенный запуск после старта
+	LockTTL time.Duration
+	Run     func() error
+	// RunTx - вместо Run для задач с CatchUp: задача вызывает save в своей транзакции, и время запуска
+	// фиксируется вместе с её результатом
+	RunTx func(save func(tx *sqlx.Tx) error) error
+}
+
+type entry struct {
+	Job
+	schedule Schedule
+}
+
+type Scheduler struct {
+	jobs     []*entry
+	location *time.Location // часовой пояс cron-выражений задач
+	owner    string
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	log      *zap.Logger
+}
+
+var (
+	unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hamsterbot_scheduler_runs_total",
+		Help: "Запуски задач планировщика по результату: ok, error, skipped (уже выполнена), locked (выполняет другая реплика)",
+	}, []string{"job", "result"})
+	jobSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hamsterbot_scheduler_run_seconds",
+		Help:    "Длительность выполнения задачи планировщика",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"job"})
+	jobLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hamsterbot_scheduler_last_success_timestamp_seconds",
+		Help: "Время последнего успешного выполнения задачи на этой реплике",
+	}, []string{"job"})
+)
+
+// New создаёт планировщик, расписания задач которого читаются в часовом поясе location
+func New(location *time.Location) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		location: location,
+		owner:    fmt.Sprintf("%s-%d", host, os.Getpid()),
+		stop:     make(chan struct{}),
+		log:      logger.Named("scheduler"),
+	}
+}
+
+// Add регистрирует задачу. Задачи добавляются до Start
+func (s *Scheduler) Add(job Job) error {
+	if job.Name == "" || (job.Run == nil) == (job.RunTx == nil) {
+		return errors.New("у задачи должны быть имя и одна из функций Run или RunTx")
+	}
+	if job.RunTx != nil && !job.CatchUp {
+		return fmt.Errorf("RunTx задачи %s требует CatchUp", job.Name)
+	}
+	for _, e := range s.jobs {
+		if e.Name == job.Name {
+			return fmt.Errorf("задача %s уже добавлена", job.Name)
+		}
+	}
+
+	schedule, err := Parse(job.Spec, s.location)
+	if err != nil {
+		return err
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("расписание задачи %s никогда не наступит", job.Name)
+	}
+	if job.LockTTL <= 0 {
+		job.LockTTL = LockTTL
+	}
+
+	s.jobs = append(s.jobs, &entry{Job: job, schedule: schedule})
+	return nil
+}
+
+// Start запускает задачи по расписанию
+func (s *Scheduler) Start() {
+	for _, e := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+}
+
+// Stop останавливает расписание и дожидается выполняющихся задач
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(e *entry) {
+	defer s.wg.Done()
+
+	next := s.first(e)
+	for !next.IsZero() {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.run(e)
+		next = e.schedule.Next(time.Now())
+	}
+}
+
+// first возвращает время первого запуска: сразу, если задача с CatchUp пропустила запуск, иначе по расписанию
+func (s *Scheduler) first(e *entry) time.Time {
+	now := time.Now()
+	if !e.CatchUp {
+		return e.schedule.Next(now)
+	}
+
+	last, err := lastRun(e.Name)
+	if err != nil {
+		s.log.Error("ошибка при чтении времени последнего запуска задачи", zap.String("job", e.Name), zap.Error(err))
+		return e.schedule.Next(now)
+	}
+	if last.IsZero() {
+		return e.schedule.Next(now)
+	}
+
+	due := e.schedule.Next(last)
+	if due.Before(now) {
+		s.log.Info("задача пропустила запуск, выполняем его сейчас", zap.String("job", e.Name), zap.Time("last", last))
+		return now
+	}
+	return due
+}
+
+func (s *Scheduler) run(e *entry) {
+	key := lockKey(e.Name)
+	token := fmt.Sprintf("%s-%d", s.owner, time.Now().UnixNano())
+
+	locked, err := cache.Rdb.SetNX(cache.Ctx, key, token, e.LockTTL).Result()
+	if err != nil {
+		jobRuns.WithLabelValues(e.Name, "error").Inc()
+		s.log.Error("ошибка при взятии блокировки задачи", zap.String("job", e.Name), zap.Error(err))
+		return
+	}
+	if !locked {
+		jobRuns.WithLabelValues(e.Name, "locked").Inc()
+		return
+	}
+	defer func() {
+		if err := unlockScript.Run(cache.Ctx, cache.Rdb, []string{key}, token).Err(); err != nil {
+			s.log.Warn("не удалось снять блокировку задачи", zap.String("job", e.Name), zap.Error(err))
+		}
+	}()
+
+	start := time.Now()
+	var last time.Time
+	if e.CatchUp {
+		last, err = lastRun(e.Name)
+		if err != nil {
+			jobRuns.WithLabelValues(e.Name, "error").Inc()
+			s.log.Error("ошибка при чтении времени последнего запуска задачи", zap.String("job", e.Name), zap.Error(err))
+			return
+		}
+		if !last.IsZero() && e.schedule.Next(last).After(start) {
+			jobRuns.WithLabelValues(e.Name, "skipped").Inc()
+			return
+		}
+	}
+
+	if e.RunTx != nil {
+		var saved bool
+		err = call(func() error {
+			return e.RunTx(func(tx *sqlx.Tx) error {
+				if err := saveRun(tx, e.Name, last, start); err != nil {
+					return err
+				}
+				saved = true
+				return nil
+			})
+		})
+		if err == nil && !saved {
+			err = errors.New("задача не сохранила время запуска")
+		}
+	} else {
+		err = call(e.Run)
+	}
+	jobSeconds.WithLabelValues(e.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		jobRuns.WithLabelValues(e.Name, "error").Inc()
+		s.log.Error("ошибка выполнения задачи", zap.String("job", e.Name), zap.Error(err))
+		return
+	}
+
+	if e.CatchUp && e.RunTx == nil {
+		if err = saveRun(db.Conn, e.Name, last, start); err != nil {
+			s.log.Error("ошибка при сохранении времени запуска задачи", zap.String("job", e.Name), zap.Error(err))
+		}
+	}
+	jobRuns.WithLabelValues(e.Name, "ok").Inc()
+	jobLastSuccess.WithLabelValues(e.Name).Set(float64(start.Unix()))
+}
+
+// call выполняет задачу, превращая панику в ошибку, чтобы она не остановила расписание
+func call(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("паника: %v", r)
+		}
+	}()
+	return run()
+}
+
+func lastRun(name string) (time.Time, error) {
+	var last time.Time
+	err := db.Conn.QueryRowx(`SELECT last_run_at FROM scheduler_runs WHERE name = $1`, name).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return last, err
+}
+
+// saveRun записывает время запуска at, если последний запуск всё ещё last (нулевое - запусков не было).
+// Иначе задачу уже выполнила другая реплика, и возвращается ошибка, откатывающая транзакцию задачи
+func saveRun(e sqlx.Execer, name string, last, at time.Time) error {
+	var prev *time.Time
+	if !last.IsZero() {
+		prev = &last
+	}
+
+	res, err := e.Exec(`INSERT INTO scheduler_runs (name, last_run_at) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET last_run_at = EXCLUDED.last_run_at
+		WHERE scheduler_runs.last_run_at IS NOT DISTINCT FROM $3::TIMESTAMPTZ`, name, at, prev)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("задачу %s уже выполнила другая реплика", name)
+	}
+	return nil
+}
+
+func lockKey(name string) string {
+	return fmt.Sprintf("scheduler:lock:%s", name)
+}